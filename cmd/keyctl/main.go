@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/zomzem/identity-service/internal/config"
+	"github.com/zomzem/identity-service/internal/repository"
+	"github.com/zomzem/identity-service/internal/usecase"
+)
+
+// keyctl manages the access token signing key ring.
+//
+//	keyctl list     show all signing keys and their state
+//	keyctl rotate   promote the NEXT key, retire the ACTIVE one and generate a new NEXT key
+//
+// Running servers pick up the change on their next JWT_KEY_REFRESH_INTERVAL tick.
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	ctx := context.Background()
+	dbPool, err := pgxpool.New(ctx, cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Unable to connect to database: %v", err)
+	}
+	defer dbPool.Close()
+
+	keyUC, err := usecase.NewKeyUseCase(repository.NewStore(dbPool), cfg, nil)
+	if err != nil {
+		log.Fatalf("Invalid key configuration: %v", err)
+	}
+
+	var keys []usecase.SigningKeyResponse
+	switch os.Args[1] {
+	case "list":
+		keys, err = keyUC.ListKeys(ctx)
+	case "rotate":
+		keys, err = keyUC.Rotate(ctx)
+	default:
+		usage()
+	}
+	if err != nil {
+		log.Fatalf("%s failed: %v", os.Args[1], err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KID\tALG\tSTATE\tACTIVATED\tRETIRE AT\tCREATED")
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			k.Kid, k.Algorithm, k.State, formatTime(k.ActivatedAt), formatTime(k.RetireAt), formatTime(k.CreatedAt))
+	}
+	w.Flush()
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: keyctl <list|rotate>")
+	os.Exit(2)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
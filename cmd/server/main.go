@@ -14,7 +14,11 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/zomzem/identity-service/internal/config"
 	deliveryHttp "github.com/zomzem/identity-service/internal/delivery/http"
+	"github.com/zomzem/identity-service/internal/notify"
+	"github.com/zomzem/identity-service/internal/password"
+	"github.com/zomzem/identity-service/internal/ratelimit"
 	"github.com/zomzem/identity-service/internal/repository"
+	"github.com/zomzem/identity-service/internal/signing"
 	"github.com/zomzem/identity-service/internal/usecase"
 )
 
@@ -40,15 +44,97 @@ func main() {
 
 	// 3. Initialize Clean Architecture Layers
 	store := repository.NewStore(dbPool)
-	authUC := usecase.NewAuthUseCase(store, cfg)
-	roleUC := usecase.NewRoleUseCase(store)
-	userUC := usecase.NewUserUseCase(store)
+
+	bgCtx, stopBackground := context.WithCancel(ctx)
+	defer stopBackground()
+
+	var (
+		signer signing.Signer
+		keyUC  usecase.KeyUseCase
+	)
+	if cfg.UsesKeyRing() {
+		ring := signing.NewKeyRing()
+		keyUC, err = usecase.NewKeyUseCase(store, cfg, ring)
+		if err != nil {
+			log.Fatalf("Invalid key configuration: %v", err)
+		}
+		if err := keyUC.Bootstrap(ctx); err != nil {
+			log.Fatalf("Failed to load signing keys: %v", err)
+		}
+		go keyUC.Run(bgCtx)
+		signer = ring
+	} else {
+		log.Println("⚠️  No asymmetric signing configured, signing access tokens with HS256 shared secret")
+		signer = signing.NewHMACSigner(cfg.JWTSecret)
+	}
+
+	var notifier notify.Notifier
+	switch cfg.Notifier {
+	case "smtp":
+		notifier, err = notify.NewSMTPNotifier(notify.SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.SMTPFrom,
+		})
+		if err != nil {
+			log.Fatalf("Invalid SMTP configuration: %v", err)
+		}
+	case "file":
+		notifier = notify.NewFileNotifier(cfg.NotifierFile)
+	default:
+		notifier = notify.NewLogNotifier()
+	}
+
+	securityEvents := usecase.NewLogSecurityEventSink()
+	wa, err := usecase.NewWebAuthn(cfg)
+	if err != nil {
+		log.Fatalf("Invalid WebAuthn configuration: %v", err)
+	}
+	identityProviders, err := usecase.NewIdentityProviders(cfg)
+	if err != nil {
+		log.Fatalf("Invalid identity provider configuration: %v", err)
+	}
+	directory, err := usecase.NewDirectory(cfg)
+	if err != nil {
+		log.Fatalf("Invalid LDAP configuration: %v", err)
+	}
+	authUC := usecase.NewAuthUseCase(store, cfg, signer, securityEvents, wa, identityProviders, directory, notifier)
+	roleUC := usecase.NewRoleUseCase(store, cfg)
+	blocklist, err := password.LoadBlocklist(cfg.PasswordBlocklist, cfg.PasswordBlocklistFile)
+	if err != nil {
+		log.Fatalf("Failed to load password blocklist: %v", err)
+	}
+	userUC := usecase.NewUserUseCase(store, cfg, blocklist)
+	passwordUC := usecase.NewPasswordUseCase(store, cfg, blocklist, notifier)
+	sessionUC := usecase.NewSessionUseCase(store)
+	loginEventUC := usecase.NewLoginEventUseCase(store)
+	mfaUC := usecase.NewMFAUseCase(store, cfg, securityEvents)
+	webAuthnUC := usecase.NewWebAuthnUseCase(store, cfg, wa, securityEvents)
+	identityUC := usecase.NewIdentityUseCase(store, identityProviders, securityEvents)
 
 	// 4. Setup Router
+	trustedProxies, err := deliveryHttp.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RequestID)
+	r.Use(deliveryHttp.ClientIPMiddleware(trustedProxies))
+	if cfg.RateLimitEnabled {
+		limiter := ratelimit.NewMemoryLimiter()
+		go limiter.Run(bgCtx)
+		r.Use(deliveryHttp.RateLimitMiddleware(limiter, []deliveryHttp.RateLimitRule{
+			{Name: "login-username", Match: deliveryHttp.MatchPathPrefix("/auth/login"), Key: deliveryHttp.RateLimitByUsername, Policy: cfg.RateLimitUsername},
+			{Name: "login-email", Match: deliveryHttp.MatchPathPrefix("/auth/email/"), Key: deliveryHttp.RateLimitByEmail, Policy: cfg.RateLimitUsername},
+			{Name: "auth-ip", Match: deliveryHttp.MatchPathPrefix("/auth/"), Key: deliveryHttp.RateLimitByClientIP, Policy: cfg.RateLimitAuth},
+			{Name: "ip", Match: deliveryHttp.MatchNonPublic, Key: deliveryHttp.RateLimitByClientIP, Policy: cfg.RateLimitDefault},
+		}))
+	}
 	r.Use(deliveryHttp.InternalAPIKeyMiddleware(cfg.InternalAPIKey))
 
 	// API Routes
@@ -61,6 +147,16 @@ func main() {
 	deliveryHttp.NewAuthHandler(r, authUC)
 	deliveryHttp.NewRoleHandler(r, roleUC)
 	deliveryHttp.NewUserHandler(r, userUC)
+	deliveryHttp.NewSessionHandler(r, sessionUC, authUC)
+	deliveryHttp.NewPasswordHandler(r, passwordUC, authUC)
+	deliveryHttp.NewLoginEventHandler(r, loginEventUC)
+	deliveryHttp.NewMFAHandler(r, mfaUC, authUC)
+	deliveryHttp.NewWebAuthnHandler(r, webAuthnUC, authUC)
+	deliveryHttp.NewIdentityHandler(r, identityUC, authUC)
+	deliveryHttp.NewJWKSHandler(r, signer)
+	if keyUC != nil {
+		deliveryHttp.NewKeyHandler(r, keyUC)
+	}
 
 	// 5. Start Server
 	srv := &http.Server{
@@ -80,6 +176,7 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	log.Println("Shutting down server...")
+	stopBackground()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -89,3 +186,4 @@ func main() {
 
 	log.Println("Server exiting")
 }
+
@@ -1,18 +1,151 @@
 package config
 
 import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
 	"github.com/kelseyhightower/envconfig"
+	"github.com/zomzem/identity-service/internal/ratelimit"
 )
 
 type Config struct {
-	ServiceName        string `envconfig:"SERVICE_NAME" default:"identity-service"`
-	Port               string `envconfig:"PORT" default:"4001"`
-	InternalAPIKey     string `envconfig:"INTERNAL_API_KEY" required:"true"`
-	DatabaseURL        string `envconfig:"DATABASE_URL" required:"true"`
-	JWTSecret          string `envconfig:"JWT_SECRET" required:"true"`
-	GoogleClientID     string `envconfig:"GOOGLE_CLIENT_ID"`
-	JWTExpiresIn       string `envconfig:"JWT_EXPIRES_IN" default:"15m"`
-    RefreshTokenExpiry string `envconfig:"REFRESH_TOKEN_EXPIRY" default:"168h"` // 7 days
+	ServiceName        string        `envconfig:"SERVICE_NAME" default:"identity-service"`
+	Port               string        `envconfig:"PORT" default:"4001"`
+	InternalAPIKey     string        `envconfig:"INTERNAL_API_KEY" required:"true"`
+	DatabaseURL        string        `envconfig:"DATABASE_URL" required:"true"`
+	JWTSecret          string        `envconfig:"JWT_SECRET"`
+	JWTPrivateKeyFile  string        `envconfig:"JWT_PRIVATE_KEY_FILE"` // PEM, enables asymmetric signing
+	JWTSigningAlg      string        `envconfig:"JWT_SIGNING_ALG"`      // RS256, PS256, ES256, EdDSA... inferred from key when empty
+	JWTKeyID           string        `envconfig:"JWT_KEY_ID"`           // defaults to the RFC 7638 thumbprint
+	GoogleClientID     string        `envconfig:"GOOGLE_CLIENT_ID"`     // shorthand for the "google" OIDC provider
+	JWTExpiresIn       time.Duration `envconfig:"JWT_EXPIRES_IN" default:"15m"`
+	RefreshTokenExpiry time.Duration `envconfig:"REFRESH_TOKEN_EXPIRY" default:"168h"` // 7 days
+
+	// Reverse proxies (IPs or CIDRs, comma separated) allowed to set X-Forwarded-For / X-Real-IP
+	TrustedProxies []string `envconfig:"TRUSTED_PROXIES"`
+
+	// Reject logged-out access tokens at introspection before they expire
+	AccessTokenDenylist bool `envconfig:"ACCESS_TOKEN_DENYLIST" default:"false"`
+
+	// Key ring rotation, only used with asymmetric signing
+	JWTKeyRotationInterval time.Duration `envconfig:"JWT_KEY_ROTATION_INTERVAL" default:"720h"` // 0 disables scheduled rotation
+	JWTKeyRetireAfter      time.Duration `envconfig:"JWT_KEY_RETIRE_AFTER" default:"1h"`        // how long a replaced key stays published
+	JWTKeyRefreshInterval  time.Duration `envconfig:"JWT_KEY_REFRESH_INTERVAL" default:"1m"`
+	// Base64 of 32 random bytes encrypting the private keys stored in the database
+	JWTKeyEncryptionKey string `envconfig:"JWT_KEY_ENCRYPTION_KEY"`
+	KeyEncryptionKey    []byte `ignored:"true"`
+
+	// Account lockout after repeated password failures, doubling with every consecutive lockout
+	LockoutThreshold    int           `envconfig:"LOCKOUT_THRESHOLD" default:"5"` // 0 disables lockout
+	LockoutBaseDuration time.Duration `envconfig:"LOCKOUT_BASE_DURATION" default:"1m"`
+	LockoutMaxDuration  time.Duration `envconfig:"LOCKOUT_MAX_DURATION" default:"1h"`
+
+	// Rate limits as <requests>/<period> ("0" disables), per client IP unless noted.
+	// Behind a proxy, TRUSTED_PROXIES must be set or all clients share one bucket.
+	RateLimitEnabled  bool             `envconfig:"RATE_LIMIT_ENABLED" default:"true"`
+	RateLimitDefault  ratelimit.Policy `envconfig:"RATE_LIMIT_DEFAULT" default:"600/1m"`
+	RateLimitAuth     ratelimit.Policy `envconfig:"RATE_LIMIT_AUTH" default:"30/1m"`     // /auth/*
+	RateLimitUsername ratelimit.Policy `envconfig:"RATE_LIMIT_USERNAME" default:"10/5m"` // /auth/login per username, /auth/email/* per email
+
+	// Password hashing; hashes of the other algorithm or with other parameters are upgraded on login
+	PasswordHashAlgorithm string `envconfig:"PASSWORD_HASH_ALGORITHM" default:"argon2id"` // argon2id or bcrypt
+	BcryptCost            int    `envconfig:"BCRYPT_COST" default:"12"`
+	Argon2Memory          uint32 `envconfig:"ARGON2_MEMORY" default:"19456"` // KiB
+	Argon2Iterations      uint32 `envconfig:"ARGON2_ITERATIONS" default:"2"`
+	Argon2Parallelism     uint8  `envconfig:"ARGON2_PARALLELISM" default:"1"`
+
+	// Password policy, enforced whenever a password is set
+	PasswordMinLength        int           `envconfig:"PASSWORD_MIN_LENGTH" default:"8"`
+	PasswordMaxLength        int           `envconfig:"PASSWORD_MAX_LENGTH" default:"72"`
+	PasswordRequireUpper     bool          `envconfig:"PASSWORD_REQUIRE_UPPER" default:"false"`
+	PasswordRequireLower     bool          `envconfig:"PASSWORD_REQUIRE_LOWER" default:"false"`
+	PasswordRequireDigit     bool          `envconfig:"PASSWORD_REQUIRE_DIGIT" default:"false"`
+	PasswordRequireSymbol    bool          `envconfig:"PASSWORD_REQUIRE_SYMBOL" default:"false"`
+	PasswordDisallowUserInfo bool          `envconfig:"PASSWORD_DISALLOW_USER_INFO" default:"true"`
+	PasswordHistory          int           `envconfig:"PASSWORD_HISTORY" default:"0"`      // previous passwords that cannot be reused
+	PasswordMaxAge           time.Duration `envconfig:"PASSWORD_MAX_AGE" default:"0"`      // 0 never expires
+	PasswordBlocklist        bool          `envconfig:"PASSWORD_BLOCKLIST" default:"true"` // bundled common passwords
+	PasswordBlocklistFile    string        `envconfig:"PASSWORD_BLOCKLIST_FILE"`           // sorted SHA-1 hashes, e.g. the HIBP "ordered by hash" dump
+
+	// Forgot-password flow; the token is appended to the URL as ?token=
+	PasswordResetTokenTTL time.Duration `envconfig:"PASSWORD_RESET_TOKEN_TTL" default:"30m"`
+	PasswordResetURL      string        `envconfig:"PASSWORD_RESET_URL" default:"http://localhost:3000/reset-password"`
+
+	// Multi-factor authentication
+	MFAIssuer        string        `envconfig:"MFA_ISSUER"` // shown in authenticator apps, defaults to SERVICE_NAME
+	MFAChallengeTTL  time.Duration `envconfig:"MFA_CHALLENGE_TTL" default:"5m"`
+	MFAMaxAttempts   int           `envconfig:"MFA_MAX_ATTEMPTS" default:"5"` // per challenge
+	MFARecoveryCodes int           `envconfig:"MFA_RECOVERY_CODES" default:"10"`
+
+	// WebAuthn relying party. The RP ID is the domain the credentials are bound to;
+	// every origin of the frontend calling the browser API must be listed.
+	WebAuthnRPID      string        `envconfig:"WEBAUTHN_RP_ID" default:"localhost"`
+	WebAuthnRPName    string        `envconfig:"WEBAUTHN_RP_NAME"` // defaults to SERVICE_NAME
+	WebAuthnRPOrigins []string      `envconfig:"WEBAUTHN_RP_ORIGINS" default:"http://localhost:3000"`
+	WebAuthnTimeout   time.Duration `envconfig:"WEBAUTHN_TIMEOUT" default:"5m"`
+
+	// Upstream OpenID Connect identity providers, each configured by OIDC_<NAME>_* variables
+	OIDCProviderNames []string       `envconfig:"OIDC_PROVIDERS"` // e.g. "google,entra"
+	OIDCProviders     []OIDCProvider `ignored:"true"`
+
+	// Redirect login at those providers. The callback URL to register there is
+	// <OIDC_CALLBACK_BASE_URL>/auth/oidc/<name>/callback. Browsers are only sent
+	// back to URLs under OIDC_RETURN_URLS, the first one being the default.
+	OIDCCallbackBaseURL string        `envconfig:"OIDC_CALLBACK_BASE_URL" default:"http://localhost:4001"`
+	OIDCReturnURLs      []string      `envconfig:"OIDC_RETURN_URLS" default:"http://localhost:3000"`
+	OIDCLoginTTL        time.Duration `envconfig:"OIDC_LOGIN_TTL" default:"10m"`
+
+	// Upstream SAML 2.0 identity providers, each configured by SAML_<NAME>_* variables.
+	// This service is the SP with entity ID <SAML_BASE_URL>/auth/saml/<name>/metadata
+	// and ACS <SAML_BASE_URL>/auth/saml/<name>/acs; browsers return under OIDC_RETURN_URLS.
+	SAMLProviderNames []string       `envconfig:"SAML_PROVIDERS"`
+	SAMLProviders     []SAMLProvider `ignored:"true"`
+	SAMLBaseURL       string         `envconfig:"SAML_BASE_URL" default:"http://localhost:4001"`
+	SAMLCertFile      string         `envconfig:"SAML_SP_CERT_FILE"` // PEM, RSA or ECDSA; signs AuthnRequests and decrypts assertions
+	SAMLKeyFile       string         `envconfig:"SAML_SP_KEY_FILE"`
+	SAMLRequestTTL    time.Duration  `envconfig:"SAML_REQUEST_TTL" default:"10m"`
+
+	// LDAP / Active Directory credential backend, used for users with auth source
+	// LDAP and for logins in LDAP_USERNAME_DOMAINS. {user} in the DN template and
+	// filter stands for the login without domain, {username} for the full login.
+	// Accounts are named <user>@<first of LDAP_USERNAME_DOMAINS> whichever
+	// domain the login was typed with.
+	LDAPURL                   string        `envconfig:"LDAP_URL"` // ldap:// or ldaps://, empty disables
+	LDAPStartTLS              bool          `envconfig:"LDAP_START_TLS" default:"false"`
+	LDAPTLSCAFile             string        `envconfig:"LDAP_TLS_CA_FILE"`
+	LDAPTLSInsecureSkipVerify bool          `envconfig:"LDAP_TLS_INSECURE_SKIP_VERIFY" default:"false"`
+	LDAPTimeout               time.Duration `envconfig:"LDAP_TIMEOUT" default:"10s"`
+	LDAPUserDNTemplate        string        `envconfig:"LDAP_USER_DN_TEMPLATE"` // direct bind, e.g. "{user}@corp.example.com"
+	LDAPBindDN                string        `envconfig:"LDAP_BIND_DN"`          // service account for search-then-bind
+	LDAPBindPassword          string        `envconfig:"LDAP_BIND_PASSWORD"`
+	LDAPBaseDN                string        `envconfig:"LDAP_BASE_DN"`
+	LDAPUserFilter            string        `envconfig:"LDAP_USER_FILTER" default:"(uid={user})"` // AD: (sAMAccountName={user})
+	LDAPEmailAttribute        string        `envconfig:"LDAP_EMAIL_ATTRIBUTE" default:"mail"`
+	LDAPNameAttribute         string        `envconfig:"LDAP_NAME_ATTRIBUTE" default:"displayName"`
+	LDAPGroupsAttribute       string        `envconfig:"LDAP_GROUPS_ATTRIBUTE" default:"memberOf"`
+	LDAPUsernameDomains       []string      `envconfig:"LDAP_USERNAME_DOMAINS"` // "corp.example.com,CORP"
+	LDAPGroupRoles            string        `envconfig:"LDAP_GROUP_ROLES"`      // "<group DN or CN>=><role code>;...", first match wins
+	LDAPDefaultRole           string        `envconfig:"LDAP_DEFAULT_ROLE"`     // role code when no group matches
+
+	// Passwordless login with a code or link sent by email; the link token is appended as ?token=
+	EmailLoginTTL         time.Duration `envconfig:"EMAIL_LOGIN_TTL" default:"10m"`
+	EmailLoginURL         string        `envconfig:"EMAIL_LOGIN_URL" default:"http://localhost:3000/login/email"`
+	EmailLoginMaxAttempts int           `envconfig:"EMAIL_LOGIN_MAX_ATTEMPTS" default:"5"` // wrong codes per request
+
+	// How user notifications are delivered: "log", "smtp" or "file" (JSON lines,
+	// for development and tests)
+	Notifier     string `envconfig:"NOTIFIER" default:"log"`
+	NotifierFile string `envconfig:"NOTIFIER_FILE" default:"notifications.jsonl"`
+	SMTPHost     string `envconfig:"SMTP_HOST"`
+	SMTPPort     int    `envconfig:"SMTP_PORT" default:"587"`
+	SMTPUsername string `envconfig:"SMTP_USERNAME"`
+	SMTPPassword string `envconfig:"SMTP_PASSWORD"`
+	SMTPFrom     string `envconfig:"SMTP_FROM"` // e.g. "Identity <no-reply@example.com>"
 }
 
 func Load() (*Config, error) {
@@ -21,5 +154,246 @@ func Load() (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	if cfg.JWTSecret == "" && !cfg.UsesKeyRing() {
+		return nil, errors.New("JWT_SECRET must be set unless JWT_PRIVATE_KEY_FILE or an asymmetric JWT_SIGNING_ALG is configured")
+	}
+	if cfg.JWTExpiresIn <= 0 {
+		return nil, errors.New("JWT_EXPIRES_IN must be positive")
+	}
+	if cfg.RefreshTokenExpiry <= cfg.JWTExpiresIn {
+		return nil, errors.New("REFRESH_TOKEN_EXPIRY must be longer than JWT_EXPIRES_IN")
+	}
+	if cfg.UsesKeyRing() && cfg.JWTKeyRetireAfter < cfg.JWTExpiresIn {
+		// A replaced key must stay published until the last token it signed expires
+		return nil, errors.New("JWT_KEY_RETIRE_AFTER must be at least JWT_EXPIRES_IN")
+	}
+	if cfg.JWTKeyRefreshInterval <= 0 {
+		return nil, errors.New("JWT_KEY_REFRESH_INTERVAL must be positive")
+	}
+	if cfg.UsesKeyRing() {
+		kek, err := base64.StdEncoding.DecodeString(cfg.JWTKeyEncryptionKey)
+		if err != nil || len(kek) != 32 {
+			return nil, errors.New("JWT_KEY_ENCRYPTION_KEY must be the base64 of 32 random bytes when signing asymmetrically")
+		}
+		cfg.KeyEncryptionKey = kek
+	}
+	if cfg.LockoutThreshold < 0 {
+		return nil, errors.New("LOCKOUT_THRESHOLD must not be negative")
+	}
+	if cfg.LockoutThreshold > 0 && (cfg.LockoutBaseDuration <= 0 || cfg.LockoutMaxDuration < cfg.LockoutBaseDuration) {
+		return nil, errors.New("LOCKOUT_BASE_DURATION must be positive and not exceed LOCKOUT_MAX_DURATION")
+	}
+	if cfg.BcryptCost < 4 || cfg.BcryptCost > 31 {
+		return nil, errors.New("BCRYPT_COST must be between 4 and 31")
+	}
+	if cfg.PasswordHashAlgorithm != "argon2id" && cfg.PasswordHashAlgorithm != "bcrypt" {
+		return nil, errors.New(`PASSWORD_HASH_ALGORITHM must be "argon2id" or "bcrypt"`)
+	}
+	if cfg.Argon2Memory < 8*uint32(cfg.Argon2Parallelism) || cfg.Argon2Iterations < 1 || cfg.Argon2Parallelism < 1 {
+		return nil, errors.New("ARGON2_ITERATIONS and ARGON2_PARALLELISM must be positive and ARGON2_MEMORY at least 8 KiB per lane")
+	}
+	if cfg.PasswordMinLength < 1 || cfg.PasswordMaxLength < cfg.PasswordMinLength {
+		return nil, errors.New("PASSWORD_MIN_LENGTH must be positive and not exceed PASSWORD_MAX_LENGTH")
+	}
+	if cfg.PasswordHistory < 0 || cfg.PasswordMaxAge < 0 {
+		return nil, errors.New("PASSWORD_HISTORY and PASSWORD_MAX_AGE must not be negative")
+	}
+	if cfg.PasswordResetTokenTTL <= 0 {
+		return nil, errors.New("PASSWORD_RESET_TOKEN_TTL must be positive")
+	}
+	if cfg.MFAIssuer == "" {
+		cfg.MFAIssuer = cfg.ServiceName
+	}
+	if cfg.MFAChallengeTTL <= 0 || cfg.MFAMaxAttempts < 1 || cfg.MFARecoveryCodes < 1 {
+		return nil, errors.New("MFA_CHALLENGE_TTL, MFA_MAX_ATTEMPTS and MFA_RECOVERY_CODES must be positive")
+	}
+	if cfg.WebAuthnRPName == "" {
+		cfg.WebAuthnRPName = cfg.ServiceName
+	}
+	if cfg.WebAuthnRPID == "" || len(cfg.WebAuthnRPOrigins) == 0 {
+		return nil, errors.New("WEBAUTHN_RP_ID and WEBAUTHN_RP_ORIGINS must be set")
+	}
+	if cfg.WebAuthnTimeout <= 0 {
+		return nil, errors.New("WEBAUTHN_TIMEOUT must be positive")
+	}
+	if err := cfg.loadOIDCProviders(); err != nil {
+		return nil, err
+	}
+	if cfg.OIDCCallbackBaseURL == "" || len(cfg.OIDCReturnURLs) == 0 || cfg.OIDCLoginTTL <= 0 {
+		return nil, errors.New("OIDC_CALLBACK_BASE_URL and OIDC_RETURN_URLS must be set and OIDC_LOGIN_TTL positive")
+	}
+	if err := cfg.loadSAMLProviders(); err != nil {
+		return nil, err
+	}
+	if cfg.LDAPURL != "" && (cfg.LDAPBaseDN == "" || (cfg.LDAPUserDNTemplate == "" && cfg.LDAPBindDN == "")) {
+		return nil, errors.New("LDAP_BASE_DN and LDAP_USER_DN_TEMPLATE or LDAP_BIND_DN must be set when LDAP_URL is")
+	}
+	if cfg.EmailLoginTTL <= 0 || cfg.EmailLoginMaxAttempts < 1 {
+		return nil, errors.New("EMAIL_LOGIN_TTL and EMAIL_LOGIN_MAX_ATTEMPTS must be positive")
+	}
+	switch cfg.Notifier {
+	case "log", "file":
+	case "smtp":
+		if cfg.SMTPHost == "" || cfg.SMTPFrom == "" {
+			return nil, errors.New("SMTP_HOST and SMTP_FROM must be set when NOTIFIER is smtp")
+		}
+	default:
+		return nil, errors.New(`NOTIFIER must be "log", "smtp" or "file"`)
+	}
 	return &cfg, nil
 }
+
+// UsesKeyRing reports whether access tokens are signed by the rotating
+// asymmetric key ring rather than the legacy HS256 shared secret.
+func (c *Config) UsesKeyRing() bool {
+	return c.JWTPrivateKeyFile != "" || (c.JWTSigningAlg != "" && c.JWTSigningAlg != "HS256")
+}
+
+// OIDCProvider is an upstream OpenID Connect identity provider. Endpoints and
+// signing keys come from the issuer's discovery document.
+type OIDCProvider struct {
+	Name                 string   `ignored:"true"`
+	DisplayName          string   `envconfig:"DISPLAY_NAME"`
+	Issuer               string   `envconfig:"ISSUER"`
+	ClientID             string   `envconfig:"CLIENT_ID"`
+	ClientSecret         string   `envconfig:"CLIENT_SECRET"`
+	Scopes               []string `envconfig:"SCOPES" default:"openid,email,profile"`
+	RequireVerifiedEmail bool     `envconfig:"REQUIRE_VERIFIED_EMAIL" default:"true"` // Entra ID sends no email_verified claim
+
+	// Claims holding the user attributes
+	ClaimSubject       string `envconfig:"CLAIM_SUBJECT" default:"sub"`
+	ClaimEmail         string `envconfig:"CLAIM_EMAIL" default:"email"`
+	ClaimEmailVerified string `envconfig:"CLAIM_EMAIL_VERIFIED" default:"email_verified"`
+	ClaimName          string `envconfig:"CLAIM_NAME" default:"name"`
+	ClaimPicture       string `envconfig:"CLAIM_PICTURE" default:"picture"`
+	ClaimUsername      string `envconfig:"CLAIM_USERNAME" default:"preferred_username"`
+	ClaimGroups        string `envconfig:"CLAIM_GROUPS" default:"groups"`
+	ClaimHostedDomain  string `envconfig:"CLAIM_HOSTED_DOMAIN"` // "hd" for Google; the domain of a verified email is used when empty
+
+	// Just-in-time provisioning of users logging in for the first time
+	Provisioning   string            `envconfig:"PROVISIONING" default:"auto"` // "auto" or "invite_only", which rejects unknown emails
+	AllowedDomains []string          `envconfig:"ALLOWED_DOMAINS"`             // hosted domains allowed to log in, any when empty
+	DefaultRole    string            `envconfig:"DEFAULT_ROLE"`                // role code of provisioned users
+	DomainRoles    map[string]string `envconfig:"DOMAIN_ROLES"`                // role codes per domain, e.g. "example.com:STAFF"
+}
+
+// Provider names end up in URLs and, upper-cased, as the login method
+var oidcProviderName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,19}$`)
+
+func (c *Config) loadOIDCProviders() error {
+	names := c.OIDCProviderNames
+	if c.GoogleClientID != "" && !slices.Contains(names, "google") {
+		names = append(names, "google")
+	}
+
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if !oidcProviderName.MatchString(name) {
+			return fmt.Errorf("OIDC_PROVIDERS: invalid provider name %q", name)
+		}
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		p := OIDCProvider{Name: name}
+		if err := envconfig.Process(prefix, &p); err != nil {
+			return err
+		}
+		if name == "google" {
+			if p.Issuer == "" {
+				p.Issuer = "https://accounts.google.com"
+			}
+			if p.ClientID == "" {
+				p.ClientID = c.GoogleClientID
+			}
+			if p.DisplayName == "" {
+				p.DisplayName = "Google"
+			}
+			if p.ClaimHostedDomain == "" {
+				// Only Workspace accounts carry hd; the email domain of a
+				// consumer account proves nothing about the organization
+				p.ClaimHostedDomain = "hd"
+			}
+		}
+		if p.DisplayName == "" {
+			p.DisplayName = name
+		}
+		if p.Issuer == "" || p.ClientID == "" {
+			return fmt.Errorf("%s_ISSUER and %s_CLIENT_ID must be set", prefix, prefix)
+		}
+		if p.Provisioning != "auto" && p.Provisioning != "invite_only" {
+			return fmt.Errorf(`%s_PROVISIONING must be "auto" or "invite_only"`, prefix)
+		}
+		p.AllowedDomains, p.DomainRoles = normalizeDomains(p.AllowedDomains, p.DomainRoles)
+		c.OIDCProviders = append(c.OIDCProviders, p)
+	}
+	return nil
+}
+
+// SAMLProvider is an upstream SAML 2.0 identity provider. Its endpoints and
+// signing certificates come from its metadata.
+type SAMLProvider struct {
+	Name            string `ignored:"true"`
+	DisplayName     string `envconfig:"DISPLAY_NAME"`
+	IDPMetadataURL  string `envconfig:"IDP_METADATA_URL"`
+	IDPMetadataFile string `envconfig:"IDP_METADATA_FILE"`
+
+	// Attributes holding the user attributes, by Name or FriendlyName. The
+	// email falls back to the NameID when that is an email address.
+	AttrEmail  string `envconfig:"ATTR_EMAIL" default:"email"`
+	AttrName   string `envconfig:"ATTR_NAME" default:"displayName"`
+	AttrGroups string `envconfig:"ATTR_GROUPS" default:"groups"`
+
+	// TrustEmail states that the IdP only asserts addresses its users own.
+	// Unless set, emails do not provision users, claim invitations or count
+	// for ALLOWED_DOMAINS, and only already linked identities log in.
+	TrustEmail bool `envconfig:"TRUST_EMAIL" default:"false"`
+
+	// Just-in-time provisioning, as for OIDC providers
+	Provisioning   string            `envconfig:"PROVISIONING" default:"auto"`
+	AllowedDomains []string          `envconfig:"ALLOWED_DOMAINS"`
+	DefaultRole    string            `envconfig:"DEFAULT_ROLE"`
+	DomainRoles    map[string]string `envconfig:"DOMAIN_ROLES"`
+}
+
+func (c *Config) loadSAMLProviders() error {
+	if len(c.SAMLProviderNames) > 0 && (c.SAMLCertFile == "" || c.SAMLKeyFile == "") {
+		return errors.New("SAML_SP_CERT_FILE and SAML_SP_KEY_FILE must be set when SAML_PROVIDERS is")
+	}
+	if c.SAMLRequestTTL <= 0 {
+		return errors.New("SAML_REQUEST_TTL must be positive")
+	}
+
+	for _, name := range c.SAMLProviderNames {
+		name = strings.TrimSpace(name)
+		if !oidcProviderName.MatchString(name) {
+			return fmt.Errorf("SAML_PROVIDERS: invalid provider name %q", name)
+		}
+		prefix := "SAML_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		p := SAMLProvider{Name: name}
+		if err := envconfig.Process(prefix, &p); err != nil {
+			return err
+		}
+		if p.DisplayName == "" {
+			p.DisplayName = name
+		}
+		if (p.IDPMetadataURL == "") == (p.IDPMetadataFile == "") {
+			return fmt.Errorf("one of %s_IDP_METADATA_URL and %s_IDP_METADATA_FILE must be set", prefix, prefix)
+		}
+		if p.Provisioning != "auto" && p.Provisioning != "invite_only" {
+			return fmt.Errorf(`%s_PROVISIONING must be "auto" or "invite_only"`, prefix)
+		}
+		p.AllowedDomains, p.DomainRoles = normalizeDomains(p.AllowedDomains, p.DomainRoles)
+		c.SAMLProviders = append(c.SAMLProviders, p)
+	}
+	return nil
+}
+
+// normalizeDomains lower-cases the domains of provisioning rules.
+func normalizeDomains(allowed []string, roles map[string]string) ([]string, map[string]string) {
+	for i, d := range allowed {
+		allowed[i] = strings.ToLower(strings.TrimSpace(d))
+	}
+	normalized := make(map[string]string, len(roles))
+	for d, role := range roles {
+		normalized[strings.ToLower(strings.TrimSpace(d))] = strings.TrimSpace(role)
+	}
+	return allowed, normalized
+}
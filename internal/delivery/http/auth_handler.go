@@ -2,7 +2,12 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/zomzem/identity-service/internal/usecase"
@@ -15,9 +20,25 @@ type AuthHandler struct {
 func NewAuthHandler(r chi.Router, auc usecase.AuthUseCase) {
 	handler := &AuthHandler{authUsecase: auc}
 	r.Post("/auth/login", handler.Login)
+	r.Post("/auth/mfa/verify", handler.VerifyMFA)
+	r.Post("/auth/mfa/webauthn", handler.BeginMFAWebAuthn)
+	r.Post("/auth/webauthn/login/begin", handler.BeginWebAuthnLogin)
+	r.Post("/auth/webauthn/login/finish", handler.FinishWebAuthnLogin)
+	r.Post("/auth/email/start", handler.StartEmailLogin)
+	r.Post("/auth/email/verify", handler.VerifyEmailLogin)
 	r.Post("/auth/google", handler.LoginGoogle)
+	r.Get("/auth/oidc/providers", handler.ListOIDCProviders)
+	r.Post("/auth/oidc/{provider}", handler.LoginOIDC)
+	r.Get("/auth/oidc/{provider}/authorize", handler.AuthorizeOIDC)
+	r.Get("/auth/oidc/{provider}/callback", handler.OIDCCallback)
+	r.Get("/auth/saml/providers", handler.ListSAMLProviders)
+	r.Get("/auth/saml/{provider}/metadata", handler.SAMLMetadata)
+	r.Get("/auth/saml/{provider}/login", handler.LoginSAML)
+	r.Post("/auth/saml/{provider}/acs", handler.SAMLACS)
 	r.Post("/auth/refresh", handler.Refresh)
 	r.Post("/auth/logout", handler.Logout)
+	r.Post("/auth/logout-all", handler.LogoutAll)
+	r.Post("/auth/introspect", handler.Introspect)
 }
 
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
@@ -32,26 +53,184 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp, err := h.authUsecase.Login(r.Context(), req.Username, req.Password)
+	resp, err := h.authUsecase.Login(r.Context(), req.Username, req.Password, clientInfoFromRequest(r))
 	if err != nil {
+		status := http.StatusUnauthorized
+		var locked *usecase.AccountLockedError
+		if errors.As(err, &locked) {
+			status = http.StatusLocked
+			w.Header().Set("Retry-After", strconv.Itoa(int(locked.RetryAfter().Seconds())))
+		} else if errors.Is(err, usecase.ErrDirectoryUnavailable) {
+			status = http.StatusServiceUnavailable
+		}
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	// Users with MFA get a challenge and no session until /auth/mfa/verify
+	if resp.MFA == nil {
+		h.setTokenCookie(w, resp.RefreshToken, resp.RefreshTokenExpiresAt)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *AuthHandler) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	var req usecase.MFAVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.MFAToken == "" || (req.Code == "" && req.RecoveryCode == "" && req.WebAuthn == nil) {
+		http.Error(w, "mfaToken and code, recoveryCode or webauthn required", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.authUsecase.VerifyMFA(r.Context(), req, clientInfoFromRequest(r))
+	if err != nil {
+		status := http.StatusInternalServerError
+		var locked *usecase.AccountLockedError
+		if errors.As(err, &locked) {
+			status = http.StatusLocked
+			w.Header().Set("Retry-After", strconv.Itoa(int(locked.RetryAfter().Seconds())))
+		} else if errors.Is(err, usecase.ErrInvalidMFACode) || errors.Is(err, usecase.ErrInvalidMFAChallenge) {
+			status = http.StatusUnauthorized
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	h.setTokenCookie(w, resp.RefreshToken, resp.RefreshTokenExpiresAt)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *AuthHandler) BeginMFAWebAuthn(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MFAToken string `json:"mfaToken"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.authUsecase.BeginMFAWebAuthn(r.Context(), req.MFAToken)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, usecase.ErrInvalidMFAChallenge):
+			status = http.StatusUnauthorized
+		case errors.Is(err, usecase.ErrMFANotEnabled):
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	renderJSON(w, resp)
+}
+
+func (h *AuthHandler) BeginWebAuthnLogin(w http.ResponseWriter, r *http.Request) {
+	resp, err := h.authUsecase.BeginWebAuthnLogin(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	renderJSON(w, resp)
+}
+
+func (h *AuthHandler) FinishWebAuthnLogin(w http.ResponseWriter, r *http.Request) {
+	var req usecase.WebAuthnAssertion
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.authUsecase.FinishWebAuthnLogin(r.Context(), req, clientInfoFromRequest(r))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, usecase.ErrInvalidWebAuthnSession) || errors.Is(err, usecase.ErrInvalidWebAuthnResponse) {
+			status = http.StatusUnauthorized
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
 		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
 
-	h.setTokenCookie(w, resp.RefreshToken)
+	h.setTokenCookie(w, resp.RefreshToken, resp.RefreshTokenExpiresAt)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
+func (h *AuthHandler) StartEmailLogin(w http.ResponseWriter, r *http.Request) {
+	var req usecase.EmailLoginStartRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Email == "" {
+		http.Error(w, "email required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authUsecase.StartEmailLogin(r.Context(), req, clientInfoFromRequest(r)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Same answer whether or not the account exists
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *AuthHandler) VerifyEmailLogin(w http.ResponseWriter, r *http.Request) {
+	var req usecase.EmailLoginVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" && (req.Email == "" || req.Code == "") {
+		http.Error(w, "token or email and code required", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.authUsecase.VerifyEmailLogin(r.Context(), req, clientInfoFromRequest(r))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, usecase.ErrInvalidEmailLogin) {
+			status = http.StatusUnauthorized
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	if resp.MFA == nil {
+		h.setTokenCookie(w, resp.RefreshToken, resp.RefreshTokenExpiresAt)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// LoginGoogle is kept for clients predating /auth/oidc/{provider}.
 func (h *AuthHandler) LoginGoogle(w http.ResponseWriter, r *http.Request) {
-	type googleReq struct {
+	h.loginOIDC(w, r, "google")
+}
+
+func (h *AuthHandler) LoginOIDC(w http.ResponseWriter, r *http.Request) {
+	h.loginOIDC(w, r, chi.URLParam(r, "provider"))
+}
+
+func (h *AuthHandler) loginOIDC(w http.ResponseWriter, r *http.Request, provider string) {
+	type oidcReq struct {
 		IDToken string `json:"idToken"`
 		Token   string `json:"token"`
 	}
 
-	var req googleReq
+	var req oidcReq
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
@@ -62,39 +241,239 @@ func (h *AuthHandler) LoginGoogle(w http.ResponseWriter, r *http.Request) {
 		token = req.Token
 	}
 
-	resp, err := h.authUsecase.LoginGoogle(r.Context(), token)
+	resp, err := h.authUsecase.LoginOIDC(r.Context(), provider, token, clientInfoFromRequest(r))
 	if err != nil {
+		var status int
+		switch {
+		case errors.Is(err, usecase.ErrUnknownOIDCProvider):
+			status = http.StatusNotFound
+		case errors.Is(err, usecase.ErrInvalidIDToken), errors.Is(err, usecase.ErrEmailNotVerified):
+			status = http.StatusUnauthorized
+		case errors.Is(err, usecase.ErrDomainNotAllowed), errors.Is(err, usecase.ErrUserNotProvisioned):
+			status = http.StatusForbidden
+		case errors.Is(err, usecase.ErrAccountLinkRequired):
+			status = http.StatusConflict
+		default:
+			// Discovery or key set fetch failed, the provider is unreachable
+			status = http.StatusBadGateway
+		}
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
+		w.WriteHeader(status)
 		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
 
-	h.setTokenCookie(w, resp.RefreshToken)
+	// Users with MFA get a challenge and no session until /auth/mfa/verify
+	if resp.MFA == nil {
+		h.setTokenCookie(w, resp.RefreshToken, resp.RefreshTokenExpiresAt)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
-func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
-	var refreshToken string
+// AuthorizeOIDC sends the browser to the provider's login page.
+func (h *AuthHandler) AuthorizeOIDC(w http.ResponseWriter, r *http.Request) {
+	authURL, state, err := h.authUsecase.StartOIDCLogin(r.Context(), chi.URLParam(r, "provider"), r.URL.Query().Get("return_to"))
+	if err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrUnknownOIDCProvider):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, usecase.ErrInvalidReturnURL):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		}
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   false,                // Set to true in production with HTTPS
+		SameSite: http.SameSiteLaxMode, // Sent on the provider's top-level redirect back
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
 
-	// 1. Try to get from cookie
-	cookie, err := r.Cookie("refreshToken")
-	if err == nil {
-		refreshToken = cookie.Value
+// OIDCCallback finishes the login and returns the browser to the app with the
+// refresh token cookie set; the app gets its access token from /auth/refresh.
+// Failures are reported to the app as ?error=.
+func (h *AuthHandler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	resp, returnTo, err := h.authUsecase.FinishOIDCLogin(r.Context(), chi.URLParam(r, "provider"), usecase.OIDCCallbackRequest{
+		State:            q.Get("state"),
+		Code:             q.Get("code"),
+		Error:            q.Get("error"),
+		ErrorDescription: q.Get("error_description"),
+		BrowserState:     cookieValue(r, oidcStateCookie),
+	}, clientInfoFromRequest(r))
+	clearCookie(w, oidcStateCookie)
+	if err != nil {
+		if returnTo == "" {
+			status := http.StatusBadRequest
+			if errors.Is(err, usecase.ErrUnknownOIDCProvider) {
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		http.Redirect(w, r, withQuery(returnTo, "error", loginErrorCode(err)), http.StatusFound)
+		return
 	}
 
-	// 2. Fallback to body if not in cookie
-	if refreshToken == "" {
-		type refreshReq struct {
-			RefreshToken string `json:"refreshToken"`
+	h.finishBrowserLogin(w, r, resp, returnTo)
+}
+
+// finishBrowserLogin returns the browser to the app after a redirect login.
+// Users with MFA get the challenge, users who have to enroll a factor their
+// enrollment token, in the fragment, which is not sent to servers.
+func (h *AuthHandler) finishBrowserLogin(w http.ResponseWriter, r *http.Request, resp *usecase.LoginResponse, returnTo string) {
+	var fragment url.Values
+	switch {
+	case resp.MFA != nil:
+		fragment = url.Values{
+			"mfa_token":   {resp.MFA.MFAToken},
+			"mfa_methods": {strings.Join(resp.MFA.Methods, ",")},
+		}
+	case resp.MFAEnrollmentRequired:
+		fragment = url.Values{"mfa_enrollment_token": {resp.AccessToken}}
+	}
+	if fragment != nil {
+		if u, err := url.Parse(returnTo); err == nil {
+			u.Fragment = ""
+			returnTo = u.String() + "#" + fragment.Encode()
 		}
-		var req refreshReq
-		if err := json.NewDecoder(r.Body).Decode(&req); err == nil {
-			refreshToken = req.RefreshToken
+		http.Redirect(w, r, returnTo, http.StatusFound)
+		return
+	}
+	h.setTokenCookie(w, resp.RefreshToken, resp.RefreshTokenExpiresAt)
+	http.Redirect(w, r, returnTo, http.StatusFound)
+}
+
+// loginErrorCode is the ?error= a failed browser login returns to the app with.
+func loginErrorCode(err error) string {
+	switch {
+	case errors.Is(err, usecase.ErrOIDCLoginDenied):
+		return "access_denied"
+	case errors.Is(err, usecase.ErrEmailNotVerified):
+		return "email_not_verified"
+	case errors.Is(err, usecase.ErrDomainNotAllowed):
+		return "domain_not_allowed"
+	case errors.Is(err, usecase.ErrUserNotProvisioned):
+		return "not_provisioned"
+	case errors.Is(err, usecase.ErrAccountLinkRequired):
+		return "link_required"
+	case errors.Is(err, usecase.ErrIdentityAlreadyLinked):
+		return "already_linked"
+	default:
+		return "login_failed"
+	}
+}
+
+func withQuery(rawURL, key, value string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	q := u.Query()
+	q.Set(key, value)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func (h *AuthHandler) ListOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	renderJSON(w, h.authUsecase.ListOIDCProviders())
+}
+
+func (h *AuthHandler) ListSAMLProviders(w http.ResponseWriter, r *http.Request) {
+	renderJSON(w, h.authUsecase.ListSAMLProviders())
+}
+
+// SAMLMetadata serves the SP metadata to register at the identity provider.
+func (h *AuthHandler) SAMLMetadata(w http.ResponseWriter, r *http.Request) {
+	metadata, err := h.authUsecase.SAMLMetadata(chi.URLParam(r, "provider"))
+	if err != nil {
+		if errors.Is(err, usecase.ErrUnknownSAMLProvider) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.Write(metadata)
+}
+
+// LoginSAML sends the browser to the identity provider with an AuthnRequest.
+func (h *AuthHandler) LoginSAML(w http.ResponseWriter, r *http.Request) {
+	authURL, relayState, err := h.authUsecase.StartSAMLLogin(r.Context(), chi.URLParam(r, "provider"), r.URL.Query().Get("return_to"))
+	if err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrUnknownSAMLProvider):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, usecase.ErrInvalidReturnURL):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		}
+		return
+	}
+	setSAMLRelayStateCookie(w, relayState)
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// setSAMLRelayStateCookie keeps the relay state in the browser starting a
+// SAML login, which has to present it at the ACS.
+func setSAMLRelayStateCookie(w http.ResponseWriter, relayState string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     samlRelayStateCookie,
+		Value:    relayState,
+		Path:     "/",
+		HttpOnly: true,
+		// The IdP posts the response cross-site, only SameSite=None cookies
+		// come along and browsers require those to be Secure
+		Secure:   true,
+		SameSite: http.SameSiteNoneMode,
+	})
+}
+
+// SAMLACS is the assertion consumer service the identity provider posts its
+// response to. Like OIDCCallback it returns the browser to the app, after a
+// link with ?linked= set.
+func (h *AuthHandler) SAMLACS(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	resp, returnTo, err := h.authUsecase.FinishSAMLLogin(r.Context(), chi.URLParam(r, "provider"), usecase.SAMLResponseRequest{
+		SAMLResponse:      r.PostForm.Get("SAMLResponse"),
+		RelayState:        r.PostForm.Get("RelayState"),
+		BrowserRelayState: cookieValue(r, samlRelayStateCookie),
+	}, clientInfoFromRequest(r))
+	clearCookie(w, samlRelayStateCookie)
+	if err != nil {
+		if returnTo == "" {
+			status := http.StatusBadRequest
+			if errors.Is(err, usecase.ErrUnknownSAMLProvider) {
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
 		}
+		http.Redirect(w, r, withQuery(returnTo, "error", loginErrorCode(err)), http.StatusFound)
+		return
+	}
+	if resp == nil {
+		http.Redirect(w, r, withQuery(returnTo, "linked", "saml:"+chi.URLParam(r, "provider")), http.StatusFound)
+		return
 	}
 
+	h.finishBrowserLogin(w, r, resp, returnTo)
+}
+
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	refreshToken := refreshTokenFromRequest(r)
 	if refreshToken == "" {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
@@ -102,7 +481,7 @@ func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp, err := h.authUsecase.Refresh(r.Context(), refreshToken)
+	resp, err := h.authUsecase.Refresh(r.Context(), refreshToken, clientInfoFromRequest(r))
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusUnauthorized)
@@ -110,31 +489,152 @@ func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.setTokenCookie(w, resp.RefreshToken)
+	// Sessions ended for MFA enrollment get no successor
+	if resp.RefreshToken == "" {
+		h.clearTokenCookie(w)
+	}
+	h.setTokenCookie(w, resp.RefreshToken, resp.RefreshTokenExpiresAt)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	err := h.authUsecase.Logout(r.Context(), refreshTokenFromRequest(r), bearerToken(r))
+	h.clearTokenCookie(w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	err := h.authUsecase.LogoutAll(r.Context(), refreshTokenFromRequest(r), bearerToken(r))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch err {
+		case usecase.ErrNoSession:
+			status = http.StatusBadRequest
+		case usecase.ErrInvalidAccessToken, usecase.ErrInvalidRefreshToken:
+			status = http.StatusUnauthorized
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	h.clearTokenCookie(w)
+	w.WriteHeader(http.StatusOK)
+}
+
+// Introspect implements RFC 7662 for access tokens. The token is accepted as a
+// form value or JSON body field named "token".
+func (h *AuthHandler) Introspect(w http.ResponseWriter, r *http.Request) {
+	var token string
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var req struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		token = req.Token
+	} else {
+		token = r.PostFormValue("token")
+	}
+
+	if token == "" {
+		http.Error(w, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	renderJSON(w, h.authUsecase.Introspect(r.Context(), token))
+}
+
+// setTokenCookie starts the browser session. Logins answered with an MFA
+// challenge or enrollment token have no refresh token and start none.
+func (h *AuthHandler) setTokenCookie(w http.ResponseWriter, token string, expiresAt time.Time) {
+	if token == "" {
+		return
+	}
 	http.SetCookie(w, &http.Cookie{
 		Name:     "refreshToken",
-		Value:    "",
+		Value:    token,
 		Path:     "/",
-		MaxAge:   -1,
+		MaxAge:   int(time.Until(expiresAt).Seconds()), // Same lifetime as the stored refresh token
 		HttpOnly: true,
+		Secure:   false, // Set to true in production with HTTPS
 		SameSite: http.SameSiteLaxMode,
 	})
-	w.WriteHeader(http.StatusOK)
 }
 
-func (h *AuthHandler) setTokenCookie(w http.ResponseWriter, token string) {
+func (h *AuthHandler) clearTokenCookie(w http.ResponseWriter) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "refreshToken",
-		Value:    token,
+		Value:    "",
 		Path:     "/",
-		MaxAge:   604800, // 7 days
+		MaxAge:   -1,
 		HttpOnly: true,
-		Secure:   false, // Set to true in production with HTTPS
 		SameSite: http.SameSiteLaxMode,
 	})
 }
+
+// oidcStateCookie and samlRelayStateCookie tie a redirect login to the
+// browser that started it.
+const (
+	oidcStateCookie      = "oidcState"
+	samlRelayStateCookie = "samlRelayState"
+)
+
+func cookieValue(r *http.Request, name string) string {
+	if cookie, err := r.Cookie(name); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+func clearCookie(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+}
+
+// refreshTokenFromRequest reads the refresh token from the cookie, falling
+// back to the "refreshToken" field of a JSON body.
+func refreshTokenFromRequest(r *http.Request) string {
+	if cookie, err := r.Cookie("refreshToken"); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+
+	var req struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err == nil {
+		return req.RefreshToken
+	}
+	return ""
+}
+
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+// clientInfoFromRequest collects the session metadata stored with refresh
+// tokens. Clients may name themselves with the X-Client-Name header.
+func clientInfoFromRequest(r *http.Request) usecase.ClientInfo {
+	return usecase.ClientInfo{
+		IP:         ClientIP(r),
+		UserAgent:  r.UserAgent(),
+		ClientName: r.Header.Get("X-Client-Name"),
+	}
+}
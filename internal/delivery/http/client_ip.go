@@ -0,0 +1,110 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const clientIPContextKey contextKey = "clientIP"
+
+// ParseTrustedProxies parses IPs and CIDR ranges of reverse proxies whose
+// forwarding headers can be believed.
+func ParseTrustedProxies(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if strings.Contains(v, "/") {
+			p, err := netip.ParsePrefix(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", v, err)
+			}
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", v, err)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+// ClientIPMiddleware resolves the real client IP and stores it in the request
+// context for ClientIP. X-Forwarded-For and X-Real-IP are only honoured when
+// the direct peer is a trusted proxy; X-Forwarded-For is walked from the
+// right, skipping trusted hops, so a client cannot spoof its address by
+// prepending entries.
+func ClientIPMiddleware(trusted []netip.Prefix) func(next http.Handler) http.Handler {
+	isTrusted := func(addr netip.Addr) bool {
+		for _, p := range trusted {
+			if p.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := resolveClientIP(r, isTrusted)
+			ctx := context.WithValue(r.Context(), clientIPContextKey, ip)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ClientIP returns the IP resolved by ClientIPMiddleware, falling back to the peer address.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPContextKey).(string); ok && ip != "" {
+		return ip
+	}
+	return remoteIP(r)
+}
+
+func resolveClientIP(r *http.Request, isTrusted func(netip.Addr) bool) string {
+	peer, err := netip.ParseAddr(remoteIP(r))
+	if err != nil || !isTrusted(peer.Unmap()) {
+		return remoteIP(r)
+	}
+
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		client := ""
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				break
+			}
+			client = addr.Unmap().String()
+			if !isTrusted(addr.Unmap()) {
+				return client
+			}
+		}
+		if client != "" {
+			return client // every hop is trusted: the leftmost is the origin
+		}
+	}
+
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+		if addr, err := netip.ParseAddr(realIP); err == nil {
+			return addr.Unmap().String()
+		}
+	}
+	return peer.Unmap().String()
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
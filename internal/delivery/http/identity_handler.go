@@ -0,0 +1,123 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/zomzem/identity-service/internal/usecase"
+)
+
+type IdentityHandler struct {
+	identityUC usecase.IdentityUseCase
+	authUC     usecase.AuthUseCase
+}
+
+func NewIdentityHandler(r chi.Router, identityUC usecase.IdentityUseCase, authUC usecase.AuthUseCase) {
+	handler := &IdentityHandler{identityUC: identityUC, authUC: authUC}
+
+	r.Group(func(r chi.Router) {
+		r.Use(RequireAccessToken(authUC))
+		r.Get("/me/identities", handler.ListIdentities)
+		r.Post("/me/identities/{provider}", handler.LinkIdentity)
+		r.Post("/me/identities/saml/{provider}", handler.LinkSAMLIdentity)
+		r.Delete("/me/identities/{id}", handler.UnlinkIdentity)
+	})
+}
+
+func (h *IdentityHandler) ListIdentities(w http.ResponseWriter, r *http.Request) {
+	claims, _ := ClaimsFromContext(r.Context())
+
+	res, err := h.identityUC.ListIdentities(r.Context(), claims.UserID)
+	if err != nil {
+		writeIdentityError(w, err)
+		return
+	}
+	renderJSON(w, res)
+}
+
+func (h *IdentityHandler) LinkIdentity(w http.ResponseWriter, r *http.Request) {
+	claims, _ := ClaimsFromContext(r.Context())
+
+	var req struct {
+		IDToken string `json:"idToken"`
+		Token   string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	token := req.IDToken
+	if token == "" {
+		token = req.Token
+	}
+
+	res, err := h.identityUC.LinkIdentity(r.Context(), claims.UserID, chi.URLParam(r, "provider"), token)
+	if err != nil {
+		writeIdentityError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(res)
+}
+
+// LinkSAMLIdentity starts a SAML login linking the identity to the caller.
+// The browser keeps the relay state cookie and is sent to redirectUrl; the
+// ACS returns it to returnTo.
+func (h *IdentityHandler) LinkSAMLIdentity(w http.ResponseWriter, r *http.Request) {
+	claims, _ := ClaimsFromContext(r.Context())
+
+	var req struct {
+		ReturnTo string `json:"returnTo"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	authURL, relayState, err := h.authUC.StartSAMLLink(r.Context(), claims.UserID, chi.URLParam(r, "provider"), req.ReturnTo)
+	if err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrUnknownSAMLProvider):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, usecase.ErrInvalidReturnURL):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		}
+		return
+	}
+	setSAMLRelayStateCookie(w, relayState)
+	renderJSON(w, map[string]string{"redirectUrl": authURL})
+}
+
+func (h *IdentityHandler) UnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	claims, _ := ClaimsFromContext(r.Context())
+	idStr := chi.URLParam(r, "id")
+	id, _ := strconv.Atoi(idStr)
+
+	if err := h.identityUC.UnlinkIdentity(r.Context(), claims.UserID, int32(id)); err != nil {
+		writeIdentityError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeIdentityError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrInvalidIDToken):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, usecase.ErrIdentityAlreadyLinked), errors.Is(err, usecase.ErrLastLoginMethod):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, usecase.ErrUnknownOIDCProvider), errors.Is(err, usecase.ErrIdentityNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, usecase.ErrUserNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
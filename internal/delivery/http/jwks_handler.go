@@ -0,0 +1,22 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/zomzem/identity-service/internal/signing"
+)
+
+type JWKSHandler struct {
+	signer signing.Signer
+}
+
+func NewJWKSHandler(r chi.Router, signer signing.Signer) {
+	handler := &JWKSHandler{signer: signer}
+	r.Get("/.well-known/jwks.json", handler.GetJWKS)
+}
+
+func (h *JWKSHandler) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	renderJSON(w, h.signer.JWKS())
+}
@@ -0,0 +1,37 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/zomzem/identity-service/internal/usecase"
+)
+
+type KeyHandler struct {
+	keyUC usecase.KeyUseCase
+}
+
+func NewKeyHandler(r chi.Router, keyUC usecase.KeyUseCase) {
+	handler := &KeyHandler{keyUC: keyUC}
+
+	r.Get("/admin/signing-keys", handler.ListKeys)
+	r.Post("/admin/signing-keys/rotate", handler.Rotate)
+}
+
+func (h *KeyHandler) ListKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.keyUC.ListKeys(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	renderJSON(w, keys)
+}
+
+func (h *KeyHandler) Rotate(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.keyUC.Rotate(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	renderJSON(w, keys)
+}
@@ -0,0 +1,80 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/zomzem/identity-service/internal/usecase"
+)
+
+type LoginEventHandler struct {
+	loginEventUC usecase.LoginEventUseCase
+}
+
+func NewLoginEventHandler(r chi.Router, loginEventUC usecase.LoginEventUseCase) {
+	handler := &LoginEventHandler{loginEventUC: loginEventUC}
+
+	r.Get("/users/{id}/login-history", handler.ListUserLoginHistory)
+	r.Get("/auth/events", handler.ListLoginEvents)
+}
+
+func (h *LoginEventHandler) ListUserLoginHistory(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, _ := strconv.Atoi(idStr)
+
+	page, err := h.loginEventUC.ListUserLoginHistory(r.Context(), int32(id), pageRequest(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	renderJSON(w, page)
+}
+
+// ListLoginEvents accepts the optional filters userId, username, method,
+// outcome, ip, since and until (RFC 3339) plus page and pageSize.
+func (h *LoginEventHandler) ListLoginEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := usecase.LoginEventFilter{
+		Username: q.Get("username"),
+		Method:   q.Get("method"),
+		Outcome:  q.Get("outcome"),
+		IP:       q.Get("ip"),
+	}
+
+	if v := q.Get("userId"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid userId", http.StatusBadRequest)
+			return
+		}
+		userID := int32(id)
+		filter.UserID = &userID
+	}
+	for name, dst := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, "Invalid "+name+", expected RFC 3339", http.StatusBadRequest)
+				return
+			}
+			*dst = &t
+		}
+	}
+
+	page, err := h.loginEventUC.ListLoginEvents(r.Context(), filter, pageRequest(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	renderJSON(w, page)
+}
+
+// pageRequest reads the page and pageSize query parameters; the use case
+// applies defaults and limits.
+func pageRequest(r *http.Request) usecase.PageRequest {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("pageSize"))
+	return usecase.PageRequest{Page: int32(page), PageSize: int32(pageSize)}
+}
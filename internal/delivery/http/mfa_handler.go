@@ -0,0 +1,136 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/zomzem/identity-service/internal/usecase"
+)
+
+type MFAHandler struct {
+	mfaUC usecase.MFAUseCase
+}
+
+func NewMFAHandler(r chi.Router, mfaUC usecase.MFAUseCase, authUC usecase.AuthUseCase) {
+	handler := &MFAHandler{mfaUC: mfaUC}
+
+	r.Group(func(r chi.Router) {
+		r.Use(RequireEnrollmentAccessToken(authUC))
+		r.Get("/me/mfa", handler.GetMyStatus)
+		r.Post("/me/mfa/totp", handler.StartTOTPEnrollment)
+		r.Post("/me/mfa/totp/confirm", handler.ConfirmTOTPEnrollment)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(RequireAccessToken(authUC))
+		r.Delete("/me/mfa/totp", handler.DisableTOTP)
+		r.Post("/me/mfa/recovery-codes", handler.RegenerateRecoveryCodes)
+	})
+
+	r.Delete("/users/{id}/mfa", handler.ResetUserMFA)
+}
+
+type mfaCodeReq struct {
+	Code string `json:"code"`
+}
+
+func (h *MFAHandler) GetMyStatus(w http.ResponseWriter, r *http.Request) {
+	claims, _ := ClaimsFromContext(r.Context())
+
+	res, err := h.mfaUC.GetStatus(r.Context(), claims.UserID)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	renderJSON(w, res)
+}
+
+func (h *MFAHandler) StartTOTPEnrollment(w http.ResponseWriter, r *http.Request) {
+	claims, _ := ClaimsFromContext(r.Context())
+
+	res, err := h.mfaUC.StartTOTPEnrollment(r.Context(), claims.UserID)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	renderJSON(w, res)
+}
+
+func (h *MFAHandler) ConfirmTOTPEnrollment(w http.ResponseWriter, r *http.Request) {
+	claims, _ := ClaimsFromContext(r.Context())
+
+	var req mfaCodeReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.mfaUC.ConfirmTOTPEnrollment(r.Context(), claims.UserID, req.Code)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	renderJSON(w, res)
+}
+
+func (h *MFAHandler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	claims, _ := ClaimsFromContext(r.Context())
+
+	var req mfaCodeReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.mfaUC.DisableTOTP(r.Context(), claims.UserID, req.Code); err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *MFAHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	claims, _ := ClaimsFromContext(r.Context())
+
+	var req mfaCodeReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.mfaUC.RegenerateRecoveryCodes(r.Context(), claims.UserID, req.Code)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	renderJSON(w, res)
+}
+
+func (h *MFAHandler) ResetUserMFA(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, _ := strconv.Atoi(idStr)
+
+	if err := h.mfaUC.ResetUserMFA(r.Context(), int32(id)); err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeMFAError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrMFAAlreadyEnabled):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, usecase.ErrMFANotEnabled), errors.Is(err, usecase.ErrMFANotPending):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, usecase.ErrInvalidMFACode), errors.Is(err, usecase.ErrMFARequiredByRole):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, usecase.ErrUserNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -1,14 +1,48 @@
 package http
 
 import (
+	"context"
 	"net/http"
+	"path"
+
+	"github.com/zomzem/identity-service/internal/usecase"
 )
 
+// publicPaths are reachable without the internal API key.
+var publicPaths = map[string]bool{
+	"/health":                true,
+	"/.well-known/jwks.json": true,
+}
+
+// publicRoutes are the path patterns, in path.Match syntax, of the routes the
+// browser is sent to directly during upstream logins, which cannot carry the
+// internal API key, and of the SAML metadata identity providers fetch.
+var publicRoutes = []string{
+	"/auth/oidc/*/authorize",
+	"/auth/oidc/*/callback",
+	"/auth/saml/*/metadata",
+	"/auth/saml/*/login",
+	"/auth/saml/*/acs",
+}
+
+// isPublic reports whether the request skips the internal API key.
+func isPublic(r *http.Request) bool {
+	if publicPaths[r.URL.Path] {
+		return true
+	}
+	for _, pattern := range publicRoutes {
+		if ok, _ := path.Match(pattern, r.URL.Path); ok {
+			return true
+		}
+	}
+	return false
+}
+
 func InternalAPIKeyMiddleware(apiKey string) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Skip for health check
-			if r.URL.Path == "/health" {
+			// Skip for health check, public key discovery and browser redirects
+			if isPublic(r) {
 				next.ServeHTTP(w, r)
 				return
 			}
@@ -23,3 +57,51 @@ func InternalAPIKeyMiddleware(apiKey string) func(next http.Handler) http.Handle
 		})
 	}
 }
+
+type contextKey string
+
+const claimsContextKey contextKey = "accessTokenClaims"
+
+// RequireAccessToken rejects requests without a valid bearer access token and
+// makes its claims available through ClaimsFromContext. Tokens restricted to
+// MFA enrollment are refused.
+func RequireAccessToken(authUC usecase.AuthUseCase) func(next http.Handler) http.Handler {
+	return requireAccessToken(authUC, false)
+}
+
+// RequireEnrollmentAccessToken is RequireAccessToken also accepting tokens
+// restricted to MFA enrollment, for the routes enrolling a second factor.
+func RequireEnrollmentAccessToken(authUC usecase.AuthUseCase) func(next http.Handler) http.Handler {
+	return requireAccessToken(authUC, true)
+}
+
+func requireAccessToken(authUC usecase.AuthUseCase, allowEnrollment bool) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := bearerToken(r)
+			if token == "" {
+				http.Error(w, "Unauthorized: Bearer token required", http.StatusUnauthorized)
+				return
+			}
+
+			claims, err := authUC.VerifyAccessToken(r.Context(), token)
+			if err != nil {
+				http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+				return
+			}
+			if claims.Scope == usecase.ScopeMFAEnrollment && !allowEnrollment {
+				http.Error(w, "Forbidden: enroll a second factor first", http.StatusForbidden)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), claimsContextKey, claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ClaimsFromContext returns the access token claims set by RequireAccessToken.
+func ClaimsFromContext(ctx context.Context) (*usecase.AccessTokenClaims, bool) {
+	claims, ok := ctx.Value(claimsContextKey).(*usecase.AccessTokenClaims)
+	return claims, ok
+}
@@ -0,0 +1,88 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/zomzem/identity-service/internal/usecase"
+)
+
+const testAPIKey = "internal-key"
+
+// redirectAuth answers the browser redirect logins. Other methods panic on
+// the nil AuthUseCase.
+type redirectAuth struct {
+	usecase.AuthUseCase
+}
+
+func (redirectAuth) StartOIDCLogin(ctx context.Context, provider, returnTo string) (string, string, error) {
+	return "https://accounts.example.com/authorize", "state", nil
+}
+
+func (redirectAuth) FinishOIDCLogin(ctx context.Context, provider string, req usecase.OIDCCallbackRequest, client usecase.ClientInfo) (*usecase.LoginResponse, string, error) {
+	return nil, "https://app.example.com/login", usecase.ErrInvalidOIDCState
+}
+
+func (redirectAuth) SAMLMetadata(provider string) ([]byte, error) {
+	return []byte("<EntityDescriptor/>"), nil
+}
+
+func (redirectAuth) StartSAMLLogin(ctx context.Context, provider, returnTo string) (string, string, error) {
+	return "https://idp.example.com/sso", "relay", nil
+}
+
+func (redirectAuth) FinishSAMLLogin(ctx context.Context, provider string, req usecase.SAMLResponseRequest, client usecase.ClientInfo) (*usecase.LoginResponse, string, error) {
+	return nil, "https://app.example.com/login", usecase.ErrInvalidSAMLResponse
+}
+
+func newTestRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Use(InternalAPIKeyMiddleware(testAPIKey))
+	NewAuthHandler(r, redirectAuth{})
+	return r
+}
+
+func TestBrowserLoginRoutesSkipAPIKey(t *testing.T) {
+	router := newTestRouter()
+	tests := []struct {
+		method, target string
+		want           int
+	}{
+		{http.MethodGet, "/auth/oidc/google/authorize?return_to=https://app.example.com/", http.StatusFound},
+		{http.MethodGet, "/auth/oidc/google/callback?state=state&code=code", http.StatusFound},
+		{http.MethodGet, "/auth/saml/corp/metadata", http.StatusOK},
+		{http.MethodGet, "/auth/saml/corp/login?return_to=https://app.example.com/", http.StatusFound},
+		{http.MethodPost, "/auth/saml/corp/acs", http.StatusFound},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader("SAMLResponse=response&RelayState=relay"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		router.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s %s without API key: got %d, want %d", tt.method, tt.target, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestAPIRoutesRequireAPIKey(t *testing.T) {
+	router := newTestRouter()
+	for _, target := range []string{
+		"/auth/oidc/providers",
+		"/auth/oidc/google",
+		"/auth/oidc/google/authorize/extra",
+		"/auth/oidc/google/x/callback",
+		"/auth/saml/providers",
+		"/auth/saml/corp/metadata/extra",
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("GET %s without API key: got %d, want %d", target, rec.Code, http.StatusForbidden)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/zomzem/identity-service/internal/usecase"
+)
+
+type PasswordHandler struct {
+	passwordUC usecase.PasswordUseCase
+}
+
+func NewPasswordHandler(r chi.Router, passwordUC usecase.PasswordUseCase, authUC usecase.AuthUseCase) {
+	handler := &PasswordHandler{passwordUC: passwordUC}
+
+	r.Group(func(r chi.Router) {
+		r.Use(RequireAccessToken(authUC))
+		r.Put("/me/password", handler.ChangeMyPassword)
+	})
+
+	r.Put("/users/{id}/password", handler.SetUserPassword)
+	r.Post("/auth/password/forgot", handler.ForgotPassword)
+	r.Post("/auth/password/reset", handler.ResetPassword)
+	r.Get("/auth/password-policy", handler.GetPolicy)
+}
+
+func (h *PasswordHandler) ChangeMyPassword(w http.ResponseWriter, r *http.Request) {
+	claims, _ := ClaimsFromContext(r.Context())
+
+	var req usecase.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	err := h.passwordUC.ChangePassword(r.Context(), claims.UserID, req)
+	writePasswordResult(w, err)
+}
+
+func (h *PasswordHandler) SetUserPassword(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, _ := strconv.Atoi(idStr)
+
+	var req usecase.SetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	err := h.passwordUC.SetPassword(r.Context(), int32(id), req)
+	writePasswordResult(w, err)
+}
+
+func (h *PasswordHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req usecase.ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.Username == "" && req.Email == "" {
+		http.Error(w, "username or email required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.passwordUC.ForgotPassword(r.Context(), req, clientInfoFromRequest(r)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Same answer whether or not the account exists
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *PasswordHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req usecase.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	err := h.passwordUC.ResetPassword(r.Context(), req)
+	if errors.Is(err, usecase.ErrInvalidResetToken) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writePasswordResult(w, err)
+}
+
+func (h *PasswordHandler) GetPolicy(w http.ResponseWriter, r *http.Request) {
+	renderJSON(w, h.passwordUC.GetPolicy())
+}
+
+func writePasswordResult(w http.ResponseWriter, err error) {
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, usecase.ErrWeakPassword):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, usecase.ErrInvalidCurrentPassword):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, usecase.ErrUserNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
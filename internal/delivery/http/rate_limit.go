@@ -0,0 +1,114 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/zomzem/identity-service/internal/ratelimit"
+)
+
+// RateLimitRule limits the requests matched by Match, counting them per key.
+// Requests for which Key returns "" are not limited by the rule.
+type RateLimitRule struct {
+	Name   string
+	Match  func(r *http.Request) bool // nil matches every request
+	Key    func(r *http.Request) string
+	Policy ratelimit.Policy
+}
+
+// RateLimitMiddleware applies every matching rule and rejects the request with
+// 429 once one of them is exhausted. Limiter errors let the request through.
+func RateLimitMiddleware(limiter ratelimit.Limiter, rules []RateLimitRule) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, rule := range rules {
+				if !rule.Policy.Enabled() || (rule.Match != nil && !rule.Match(r)) {
+					continue
+				}
+				key := rule.Key(r)
+				if key == "" {
+					continue
+				}
+
+				res, err := limiter.Allow(r.Context(), rule.Name+":"+key, rule.Policy)
+				if err != nil {
+					log.Printf("[RateLimit] %s: %v", rule.Name, err)
+					continue
+				}
+				if !res.Allowed {
+					retryAfter := int(math.Ceil(res.RetryAfter.Seconds()))
+					w.Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusTooManyRequests)
+					json.NewEncoder(w).Encode(map[string]string{"error": "too many requests"})
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// MatchPathPrefix matches requests whose path starts with one of the prefixes.
+func MatchPathPrefix(prefixes ...string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchNonPublic matches everything except the health check and key discovery.
+func MatchNonPublic(r *http.Request) bool {
+	return !publicPaths[r.URL.Path]
+}
+
+// RateLimitByClientIP keys requests by the address resolved by ClientIPMiddleware.
+func RateLimitByClientIP(r *http.Request) string {
+	return ClientIP(r)
+}
+
+// maxPeekBody bounds how much of a request body RateLimitByUsername reads.
+const maxPeekBody = 64 << 10
+
+// RateLimitByUsername keys requests by the "username" field of a JSON body,
+// leaving the body intact for the handler.
+func RateLimitByUsername(r *http.Request) string {
+	return peekJSONField(r, "username")
+}
+
+// RateLimitByEmail keys requests by the "email" field of a JSON body.
+func RateLimitByEmail(r *http.Request) string {
+	return peekJSONField(r, "email")
+}
+
+func peekJSONField(r *http.Request, field string) string {
+	if r.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPeekBody))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil {
+		return ""
+	}
+
+	var req map[string]any
+	if err := json.Unmarshal(body, &req); err != nil {
+		return ""
+	}
+	value, _ := req[field].(string)
+	return strings.ToLower(strings.TrimSpace(value))
+}
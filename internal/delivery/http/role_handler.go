@@ -2,6 +2,7 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -57,6 +58,10 @@ func (h *RoleHandler) CreateRole(w http.ResponseWriter, r *http.Request) {
 
 	role, err := h.roleUC.CreateRole(r.Context(), req)
 	if err != nil {
+		if errors.Is(err, usecase.ErrInvalidTokenTTL) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -75,6 +80,10 @@ func (h *RoleHandler) UpdateRole(w http.ResponseWriter, r *http.Request) {
 
 	role, err := h.roleUC.UpdateRole(r.Context(), int32(id), req)
 	if err != nil {
+		if errors.Is(err, usecase.ErrInvalidTokenTTL) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,99 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/zomzem/identity-service/internal/usecase"
+)
+
+type SessionHandler struct {
+	sessionUC usecase.SessionUseCase
+}
+
+func NewSessionHandler(r chi.Router, sessionUC usecase.SessionUseCase, authUC usecase.AuthUseCase) {
+	handler := &SessionHandler{sessionUC: sessionUC}
+
+	r.Group(func(r chi.Router) {
+		r.Use(RequireAccessToken(authUC))
+		r.Get("/me/sessions", handler.ListMySessions)
+		r.Delete("/me/sessions", handler.RevokeMySessions)
+		r.Delete("/me/sessions/{sessionId}", handler.RevokeMySession)
+	})
+
+	r.Get("/users/{id}/sessions", handler.ListUserSessions)
+	r.Delete("/users/{id}/sessions", handler.RevokeUserSessions)
+	r.Delete("/users/{id}/sessions/{sessionId}", handler.RevokeUserSession)
+}
+
+func (h *SessionHandler) ListMySessions(w http.ResponseWriter, r *http.Request) {
+	claims, _ := ClaimsFromContext(r.Context())
+
+	var current string
+	if cookie, err := r.Cookie("refreshToken"); err == nil {
+		current = cookie.Value
+	}
+
+	sessions, err := h.sessionUC.ListSessions(r.Context(), claims.UserID, current)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	renderJSON(w, sessions)
+}
+
+func (h *SessionHandler) RevokeMySessions(w http.ResponseWriter, r *http.Request) {
+	claims, _ := ClaimsFromContext(r.Context())
+	h.revokeAll(w, r, claims.UserID)
+}
+
+func (h *SessionHandler) RevokeMySession(w http.ResponseWriter, r *http.Request) {
+	claims, _ := ClaimsFromContext(r.Context())
+	h.revoke(w, r, claims.UserID)
+}
+
+func (h *SessionHandler) ListUserSessions(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, _ := strconv.Atoi(idStr)
+
+	sessions, err := h.sessionUC.ListSessions(r.Context(), int32(id), "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	renderJSON(w, sessions)
+}
+
+func (h *SessionHandler) RevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, _ := strconv.Atoi(idStr)
+	h.revokeAll(w, r, int32(id))
+}
+
+func (h *SessionHandler) RevokeUserSession(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, _ := strconv.Atoi(idStr)
+	h.revoke(w, r, int32(id))
+}
+
+func (h *SessionHandler) revoke(w http.ResponseWriter, r *http.Request, userID int32) {
+	err := h.sessionUC.RevokeSession(r.Context(), userID, chi.URLParam(r, "sessionId"))
+	if err == usecase.ErrSessionNotFound {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *SessionHandler) revokeAll(w http.ResponseWriter, r *http.Request, userID int32) {
+	if err := h.sessionUC.RevokeAllSessions(r.Context(), userID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
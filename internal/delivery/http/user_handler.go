@@ -2,6 +2,7 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -21,6 +22,7 @@ func NewUserHandler(r chi.Router, userUC usecase.UserUseCase) {
 	r.Get("/users/{id}", handler.GetUserByID)
 	r.Put("/users/{id}", handler.UpdateUser)
 	r.Delete("/users/{id}", handler.DeleteUser)
+	r.Post("/users/{id}/unlock", handler.UnlockUser)
 }
 
 func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
@@ -52,6 +54,10 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	user, err := h.userUC.CreateUser(r.Context(), req)
+	if errors.Is(err, usecase.ErrWeakPassword) || errors.Is(err, usecase.ErrInvalidAuthSource) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -70,6 +76,10 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	user, err := h.userUC.UpdateUser(r.Context(), int32(id), req)
+	if errors.Is(err, usecase.ErrInvalidAuthSource) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -87,3 +97,18 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func (h *UserHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, _ := strconv.Atoi(idStr)
+
+	if err := h.userUC.UnlockUser(r.Context(), int32(id)); err != nil {
+		if errors.Is(err, usecase.ErrUserNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
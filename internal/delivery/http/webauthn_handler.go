@@ -0,0 +1,99 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/zomzem/identity-service/internal/usecase"
+)
+
+type WebAuthnHandler struct {
+	webAuthnUC usecase.WebAuthnUseCase
+}
+
+func NewWebAuthnHandler(r chi.Router, webAuthnUC usecase.WebAuthnUseCase, authUC usecase.AuthUseCase) {
+	handler := &WebAuthnHandler{webAuthnUC: webAuthnUC}
+
+	r.Group(func(r chi.Router) {
+		r.Use(RequireEnrollmentAccessToken(authUC))
+		r.Post("/me/webauthn/register/begin", handler.BeginRegistration)
+		r.Post("/me/webauthn/register/finish", handler.FinishRegistration)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(RequireAccessToken(authUC))
+		r.Get("/me/webauthn/credentials", handler.ListCredentials)
+		r.Delete("/me/webauthn/credentials/{id}", handler.DeleteCredential)
+	})
+}
+
+func (h *WebAuthnHandler) BeginRegistration(w http.ResponseWriter, r *http.Request) {
+	claims, _ := ClaimsFromContext(r.Context())
+
+	res, err := h.webAuthnUC.BeginRegistration(r.Context(), claims.UserID)
+	if err != nil {
+		writeWebAuthnError(w, err)
+		return
+	}
+	renderJSON(w, res)
+}
+
+func (h *WebAuthnHandler) FinishRegistration(w http.ResponseWriter, r *http.Request) {
+	claims, _ := ClaimsFromContext(r.Context())
+
+	var req usecase.WebAuthnRegistrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.webAuthnUC.FinishRegistration(r.Context(), claims.UserID, req)
+	if err != nil {
+		writeWebAuthnError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *WebAuthnHandler) ListCredentials(w http.ResponseWriter, r *http.Request) {
+	claims, _ := ClaimsFromContext(r.Context())
+
+	res, err := h.webAuthnUC.ListCredentials(r.Context(), claims.UserID)
+	if err != nil {
+		writeWebAuthnError(w, err)
+		return
+	}
+	renderJSON(w, res)
+}
+
+func (h *WebAuthnHandler) DeleteCredential(w http.ResponseWriter, r *http.Request) {
+	claims, _ := ClaimsFromContext(r.Context())
+	idStr := chi.URLParam(r, "id")
+	id, _ := strconv.Atoi(idStr)
+
+	if err := h.webAuthnUC.DeleteCredential(r.Context(), claims.UserID, int32(id)); err != nil {
+		writeWebAuthnError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeWebAuthnError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrInvalidWebAuthnSession), errors.Is(err, usecase.ErrInvalidWebAuthnResponse):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, usecase.ErrMFARequiredByRole):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, usecase.ErrWebAuthnCredentialMissing):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, usecase.ErrUserNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,262 @@
+// Package directory authenticates users against an LDAP server such as
+// Active Directory or OpenLDAP.
+package directory
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid directory credentials")
+	ErrUnavailable        = errors.New("directory unavailable")
+)
+
+// Config locates the directory and its users. {user} in UserDNTemplate and
+// UserFilter is replaced by the login name without its domain, {username} by
+// the login name as entered.
+type Config struct {
+	URL                string
+	StartTLS           bool
+	CAFile             string // PEM, system roots when empty
+	InsecureSkipVerify bool
+	Timeout            time.Duration
+
+	// Direct bind as UserDNTemplate when set, otherwise search the user with
+	// the service account BindDN and bind as the entry found.
+	UserDNTemplate string
+	BindDN         string
+	BindPassword   string
+	BaseDN         string
+	UserFilter     string
+
+	EmailAttribute  string
+	NameAttribute   string
+	GroupsAttribute string
+
+	// Logins routed to the directory, as "alice@corp.example.com" or "CORP\alice"
+	UsernameDomains []string
+
+	GroupRoles  []GroupRole
+	DefaultRole string
+}
+
+// GroupRole maps the members of a group, given by DN or common name, to a role code.
+type GroupRole struct {
+	Group string
+	Role  string
+}
+
+// Entry is an authenticated directory user.
+type Entry struct {
+	DN     string
+	Email  string
+	Name   string
+	Groups []string
+}
+
+type Authenticator interface {
+	// Authenticate binds as the user and returns their entry.
+	Authenticate(ctx context.Context, username, password string) (*Entry, error)
+	// Username returns the account name of a login in a directory domain,
+	// false for other logins.
+	Username(login string) (string, bool)
+	// Role returns the role code for members of groups, empty for none.
+	Role(groups []string) string
+}
+
+type ldapAuthenticator struct {
+	cfg Config
+	tls *tls.Config
+}
+
+func NewLDAPAuthenticator(cfg Config) (Authenticator, error) {
+	host, err := ldapURLHost(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{ServerName: host, InsecureSkipVerify: cfg.InsecureSkipVerify}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("ldap ca file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("ldap ca file: no certificates found")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &ldapAuthenticator{cfg: cfg, tls: tlsConfig}, nil
+}
+
+func (a *ldapAuthenticator) Authenticate(ctx context.Context, username, password string) (*Entry, error) {
+	// An empty password would be an unauthenticated bind, which succeeds
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := a.dial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer conn.Close()
+
+	user := a.stripDomain(username)
+	var dn string
+	if a.cfg.UserDNTemplate != "" {
+		dn = expand(a.cfg.UserDNTemplate, user, username, ldap.EscapeDN)
+	} else {
+		if err := conn.Bind(a.cfg.BindDN, a.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("%w: service account bind: %v", ErrUnavailable, err)
+		}
+		entry, err := a.search(conn, user, username)
+		if err != nil {
+			return nil, err
+		}
+		dn = entry.DN
+	}
+
+	if err := conn.Bind(dn, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	// Read the attributes as the user, who may see more than the service account
+	entry, err := a.search(conn, user, username)
+	if err != nil {
+		return nil, err
+	}
+	return &Entry{
+		DN:     entry.DN,
+		Email:  entry.GetAttributeValue(a.cfg.EmailAttribute),
+		Name:   entry.GetAttributeValue(a.cfg.NameAttribute),
+		Groups: entry.GetAttributeValues(a.cfg.GroupsAttribute),
+	}, nil
+}
+
+func (a *ldapAuthenticator) dial(ctx context.Context) (*ldap.Conn, error) {
+	dialer := &net.Dialer{Timeout: a.cfg.Timeout}
+	if deadline, ok := ctx.Deadline(); ok {
+		dialer.Deadline = deadline
+	}
+	conn, err := ldap.DialURL(a.cfg.URL, ldap.DialWithDialer(dialer), ldap.DialWithTLSConfig(a.tls))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(a.cfg.Timeout)
+	if a.cfg.StartTLS {
+		if err := conn.StartTLS(a.tls); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (a *ldapAuthenticator) search(conn *ldap.Conn, user, username string) (*ldap.Entry, error) {
+	req := ldap.NewSearchRequest(
+		a.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(a.cfg.Timeout.Seconds()), false,
+		expand(a.cfg.UserFilter, user, username, ldap.EscapeFilter),
+		[]string{a.cfg.EmailAttribute, a.cfg.NameAttribute, a.cfg.GroupsAttribute},
+		nil,
+	)
+	res, err := conn.Search(req)
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("%w: search: %v", ErrUnavailable, err)
+	}
+	// Ambiguous filters must not let one user log in as another
+	if res == nil || len(res.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	return res.Entries[0], nil
+}
+
+// Username maps every form of a directory login to one account: "CORP\jane"
+// and "jane@corp.example.com" are both "jane@<first username domain>".
+func (a *ldapAuthenticator) Username(login string) (string, bool) {
+	for _, d := range a.cfg.UsernameDomains {
+		if len(login) <= len(d)+1 {
+			continue
+		}
+		var user string
+		switch {
+		case strings.EqualFold(login[len(login)-len(d)-1:], "@"+d):
+			user = login[:len(login)-len(d)-1]
+		case strings.EqualFold(login[:len(d)+1], d+`\`):
+			user = login[len(d)+1:]
+		default:
+			continue
+		}
+		if strings.ContainsAny(user, `@\`) {
+			continue
+		}
+		return strings.ToLower(user + "@" + a.cfg.UsernameDomains[0]), true
+	}
+	return "", false
+}
+
+func (a *ldapAuthenticator) stripDomain(username string) string {
+	if _, user, ok := strings.Cut(username, `\`); ok {
+		return user
+	}
+	if user, _, ok := strings.Cut(username, "@"); ok {
+		return user
+	}
+	return username
+}
+
+func (a *ldapAuthenticator) Role(groups []string) string {
+	for _, gr := range a.cfg.GroupRoles {
+		for _, g := range groups {
+			if strings.EqualFold(g, gr.Group) || strings.EqualFold(commonName(g), gr.Group) {
+				return gr.Role
+			}
+		}
+	}
+	return a.cfg.DefaultRole
+}
+
+// commonName returns the CN of a DN such as "CN=Admins,OU=Groups,DC=corp".
+func commonName(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 {
+		return ""
+	}
+	for _, attr := range parsed.RDNs[0].Attributes {
+		if strings.EqualFold(attr.Type, "cn") {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+func expand(template, user, username string, escape func(string) string) string {
+	return strings.NewReplacer("{user}", escape(user), "{username}", escape(username)).Replace(template)
+}
+
+func ldapURLHost(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("ldap url: %w", err)
+	}
+	if u.Scheme != "ldap" && u.Scheme != "ldaps" {
+		return "", fmt.Errorf("ldap url %q: scheme must be ldap or ldaps", rawURL)
+	}
+	return u.Hostname(), nil
+}
@@ -0,0 +1,448 @@
+package directory
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	serviceDN       = "cn=svc,dc=example,dc=com"
+	servicePassword = "svc-secret"
+)
+
+// fakeEntry is a user of the fake directory.
+type fakeEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// fakeServer is an in-process LDAP server speaking just enough of the
+// protocol for the authenticator: simple binds, searches with equality,
+// presence and AND filters, and unbind. It records the binds and filters it
+// receives.
+type fakeServer struct {
+	t        *testing.T
+	listener net.Listener
+	entries  []fakeEntry
+
+	mu      sync.Mutex
+	binds   []string
+	filters []string
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{
+		t:        t,
+		listener: listener,
+		entries: []fakeEntry{
+			{dn: serviceDN, password: servicePassword, attrs: map[string][]string{"cn": {"svc"}}},
+			{
+				dn:       "uid=jane,ou=people,dc=example,dc=com",
+				password: "jane-secret",
+				attrs: map[string][]string{
+					"uid":         {"jane"},
+					"ou":          {"people"},
+					"mail":        {"jane@example.com"},
+					"displayName": {"Jane Doe"},
+					"memberOf":    {"cn=Admins,ou=groups,dc=example,dc=com", "cn=Staff,ou=groups,dc=example,dc=com"},
+				},
+			},
+			{
+				dn:       "uid=john,ou=people,dc=example,dc=com",
+				password: "john-secret",
+				attrs: map[string][]string{
+					"uid":  {"john"},
+					"ou":   {"people"},
+					"mail": {"john@example.com"},
+				},
+			},
+		},
+	}
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+func (s *fakeServer) url() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *fakeServer) recorded() (binds, filters []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.binds), slices.Clone(s.filters)
+}
+
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeServer) handle(conn net.Conn) {
+	defer conn.Close()
+	var bound *fakeEntry
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				s.t.Logf("fake ldap: read: %v", err)
+			}
+			return
+		}
+		if len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn, password := op.Children[1].Data.String(), op.Children[2].Data.String()
+			s.mu.Lock()
+			s.binds = append(s.binds, dn)
+			s.mu.Unlock()
+			bound = s.bind(dn, password)
+			code := ldap.LDAPResultSuccess
+			if bound == nil && (dn != "" || password != "") {
+				code = ldap.LDAPResultInvalidCredentials
+			}
+			s.write(conn, id, result(ldap.ApplicationBindResponse, code))
+
+		case ldap.ApplicationSearchRequest:
+			filter, err := ldap.DecompileFilter(op.Children[6])
+			if err != nil {
+				s.t.Errorf("fake ldap: filter: %v", err)
+				return
+			}
+			s.mu.Lock()
+			s.filters = append(s.filters, filter)
+			s.mu.Unlock()
+			if bound == nil {
+				s.write(conn, id, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights))
+				continue
+			}
+			s.search(conn, id, op)
+
+		case ldap.ApplicationUnbindRequest:
+			return
+
+		default:
+			s.t.Errorf("fake ldap: unexpected operation %d", op.Tag)
+			return
+		}
+	}
+}
+
+func (s *fakeServer) bind(dn, password string) *fakeEntry {
+	for i, e := range s.entries {
+		if strings.EqualFold(e.dn, dn) && password != "" && e.password == password {
+			return &s.entries[i]
+		}
+	}
+	return nil
+}
+
+func (s *fakeServer) search(conn net.Conn, id int64, op *ber.Packet) {
+	base := strings.ToLower(op.Children[0].Data.String())
+	sizeLimit := int(op.Children[3].Value.(int64))
+	var attributes []string
+	for _, a := range op.Children[7].Children {
+		attributes = append(attributes, a.Data.String())
+	}
+
+	sent := 0
+	for _, e := range s.entries {
+		if !strings.HasSuffix(strings.ToLower(e.dn), base) || !matches(op.Children[6], e) {
+			continue
+		}
+		if sizeLimit > 0 && sent == sizeLimit {
+			s.write(conn, id, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultSizeLimitExceeded))
+			return
+		}
+		s.write(conn, id, searchEntry(e, attributes))
+		sent++
+	}
+	s.write(conn, id, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+}
+
+func matches(filter *ber.Packet, e fakeEntry) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, f := range filter.Children {
+			if !matches(f, e) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterEqualityMatch:
+		values := attribute(e, filter.Children[0].Data.String())
+		return slices.ContainsFunc(values, func(v string) bool {
+			return strings.EqualFold(v, filter.Children[1].Data.String())
+		})
+	case ldap.FilterPresent:
+		return len(attribute(e, filter.Data.String())) > 0
+	}
+	return false
+}
+
+func attribute(e fakeEntry, name string) []string {
+	for k, v := range e.attrs {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return nil
+}
+
+func (s *fakeServer) write(conn net.Conn, id int64, op *ber.Packet) {
+	msg := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	msg.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "Message ID"))
+	msg.AppendChild(op)
+	if _, err := conn.Write(msg.Bytes()); err != nil {
+		s.t.Logf("fake ldap: write: %v", err)
+	}
+}
+
+func result(tag ber.Tag, code int) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	return op
+}
+
+func searchEntry(e fakeEntry, attributes []string) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "DN"))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for _, name := range attributes {
+		values := attribute(e, name)
+		if len(values) == 0 {
+			continue
+		}
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, v := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+		}
+		attr.AppendChild(set)
+		attrs.AppendChild(attr)
+	}
+	op.AppendChild(attrs)
+	return op
+}
+
+// searchConfig searches users with the service account before binding.
+func searchConfig(s *fakeServer) Config {
+	return Config{
+		URL:             s.url(),
+		Timeout:         5 * time.Second,
+		BindDN:          serviceDN,
+		BindPassword:    servicePassword,
+		BaseDN:          "dc=example,dc=com",
+		UserFilter:      "(uid={user})",
+		EmailAttribute:  "mail",
+		NameAttribute:   "displayName",
+		GroupsAttribute: "memberOf",
+		UsernameDomains: []string{"example.com", "CORP"},
+		GroupRoles:      []GroupRole{{Group: "Admins", Role: "ADMIN"}},
+		DefaultRole:     "USER",
+	}
+}
+
+func newAuthenticator(t *testing.T, cfg Config) Authenticator {
+	t.Helper()
+	a, err := NewLDAPAuthenticator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestAuthenticateSearchThenBind(t *testing.T) {
+	s := newFakeServer(t)
+	a := newAuthenticator(t, searchConfig(s))
+
+	entry, err := a.Authenticate(context.Background(), "jane@example.com", "jane-secret")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if entry.DN != "uid=jane,ou=people,dc=example,dc=com" || entry.Email != "jane@example.com" || entry.Name != "Jane Doe" {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+	if len(entry.Groups) != 2 || a.Role(entry.Groups) != "ADMIN" {
+		t.Errorf("groups %v map to role %q", entry.Groups, a.Role(entry.Groups))
+	}
+
+	binds, _ := s.recorded()
+	if !slices.Equal(binds, []string{serviceDN, entry.DN}) {
+		t.Errorf("binds %v, want the service account then the user", binds)
+	}
+}
+
+func TestAuthenticateRejectsWrongPassword(t *testing.T) {
+	s := newFakeServer(t)
+	a := newAuthenticator(t, searchConfig(s))
+
+	if _, err := a.Authenticate(context.Background(), "jane", "john-secret"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("got %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestAuthenticateRejectsEmptyPassword(t *testing.T) {
+	s := newFakeServer(t)
+	a := newAuthenticator(t, searchConfig(s))
+
+	// The fake server, like real ones, accepts unauthenticated binds
+	if _, err := a.Authenticate(context.Background(), "jane", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("got %v, want ErrInvalidCredentials", err)
+	}
+	if binds, _ := s.recorded(); len(binds) != 0 {
+		t.Errorf("empty password reached the directory: binds %v", binds)
+	}
+}
+
+func TestAuthenticateEscapesFilter(t *testing.T) {
+	s := newFakeServer(t)
+	a := newAuthenticator(t, searchConfig(s))
+
+	for _, username := range []string{"*", "jane)(uid=*", "j*"} {
+		if _, err := a.Authenticate(context.Background(), username, "jane-secret"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("%q: got %v, want ErrInvalidCredentials", username, err)
+		}
+	}
+
+	binds, filters := s.recorded()
+	want := []string{`(uid=\2a)`, `(uid=jane\29\28uid=\2a)`, `(uid=j\2a)`}
+	if !slices.Equal(filters, want) {
+		t.Errorf("filters %q, want %q", filters, want)
+	}
+	for _, dn := range binds {
+		if dn != serviceDN {
+			t.Errorf("bound as %q after an injected filter", dn)
+		}
+	}
+}
+
+func TestAuthenticateRejectsAmbiguousSearch(t *testing.T) {
+	s := newFakeServer(t)
+	cfg := searchConfig(s)
+	cfg.UserFilter = "(ou={user})"
+	a := newAuthenticator(t, cfg)
+
+	if _, err := a.Authenticate(context.Background(), "people", "jane-secret"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("got %v, want ErrInvalidCredentials", err)
+	}
+	if binds, _ := s.recorded(); !slices.Equal(binds, []string{serviceDN}) {
+		t.Errorf("bound as a user of an ambiguous search: %v", binds)
+	}
+}
+
+func TestAuthenticateDirectBind(t *testing.T) {
+	s := newFakeServer(t)
+	cfg := searchConfig(s)
+	cfg.BindDN, cfg.BindPassword = "", ""
+	cfg.UserDNTemplate = "uid={user},ou=people,dc=example,dc=com"
+	a := newAuthenticator(t, cfg)
+
+	entry, err := a.Authenticate(context.Background(), `CORP\jane`, "jane-secret")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if entry.Email != "jane@example.com" {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+
+	// A DN injected through the login name stays one escaped RDN value
+	_, err = a.Authenticate(context.Background(), "jane,ou=people", "jane-secret")
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("got %v, want ErrInvalidCredentials", err)
+	}
+	binds, _ := s.recorded()
+	if want := `uid=jane\,ou=people,ou=people,dc=example,dc=com`; binds[len(binds)-1] != want {
+		t.Errorf("bound as %q, want %q", binds[len(binds)-1], want)
+	}
+}
+
+func TestAuthenticateUnavailable(t *testing.T) {
+	s := newFakeServer(t)
+	cfg := searchConfig(s)
+	cfg.BindPassword = "wrong"
+	a := newAuthenticator(t, cfg)
+
+	if _, err := a.Authenticate(context.Background(), "jane", "jane-secret"); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("service account rejected: got %v, want ErrUnavailable", err)
+	}
+
+	s.listener.Close()
+	a = newAuthenticator(t, searchConfig(s))
+	if _, err := a.Authenticate(context.Background(), "jane", "jane-secret"); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("server down: got %v, want ErrUnavailable", err)
+	}
+}
+
+func TestUsername(t *testing.T) {
+	a := newAuthenticator(t, Config{URL: "ldap://localhost", UsernameDomains: []string{"example.com", "CORP"}})
+	tests := map[string]string{
+		"jane@example.com":      "jane@example.com",
+		"Jane@EXAMPLE.COM":      "jane@example.com",
+		`corp\Jane`:             "jane@example.com",
+		"jane@corp":             "jane@example.com",
+		"jane@notexample.com":   "",
+		"jane@example.com.evil": "",
+		`corp\jane@evil.com`:    "",
+		"@example.com":          "",
+		"jane":                  "",
+	}
+	for login, want := range tests {
+		got, ok := a.Username(login)
+		if got != want || ok != (want != "") {
+			t.Errorf("Username(%q) = %q, %v, want %q", login, got, ok, want)
+		}
+	}
+}
+
+func TestRole(t *testing.T) {
+	a := newAuthenticator(t, Config{
+		URL:         "ldap://localhost",
+		GroupRoles:  []GroupRole{{Group: "cn=Admins,ou=groups,dc=example,dc=com", Role: "ADMIN"}, {Group: "Staff", Role: "STAFF"}},
+		DefaultRole: "USER",
+	})
+	tests := []struct {
+		groups []string
+		want   string
+	}{
+		{[]string{"CN=Admins,OU=Groups,DC=example,DC=com"}, "ADMIN"},
+		{[]string{"cn=Staff,ou=other,dc=example,dc=com"}, "STAFF"},
+		{[]string{"cn=Staff,ou=other,dc=example,dc=com", "cn=Admins,ou=groups,dc=example,dc=com"}, "ADMIN"},
+		{[]string{"cn=Staffers,dc=example,dc=com"}, "USER"},
+		{nil, "USER"},
+	}
+	for _, tt := range tests {
+		if got := a.Role(tt.groups); got != tt.want {
+			t.Errorf("Role(%v) = %q, want %q", tt.groups, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+// Package idp verifies logins at upstream identity providers, speaking OpenID
+// Connect to e.g. Google, Microsoft Entra ID, Keycloak or Okta and SAML 2.0 to
+// IdPs such as ADFS or Shibboleth.
+package idp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown identity provider")
+	ErrInvalidIDToken  = errors.New("invalid id token")
+	ErrInvalidAuthCode = errors.New("invalid authorization code")
+)
+
+// ClaimMapping names the ID token claims holding the user attributes.
+type ClaimMapping struct {
+	Subject       string
+	Email         string
+	EmailVerified string
+	Name          string
+	Picture       string
+	Username      string
+	Groups        string
+	// HostedDomain empty takes the domain of a verified email address
+	HostedDomain string
+}
+
+type Config struct {
+	Name                 string
+	DisplayName          string
+	Issuer               string
+	ClientID             string
+	ClientSecret         string
+	Scopes               []string
+	RequireVerifiedEmail bool
+	Claims               ClaimMapping
+	Provisioning         ProvisioningRules
+}
+
+// ProvisioningRules decide who may log in through a provider and how users
+// logging in for the first time are created.
+type ProvisioningRules struct {
+	InviteOnly     bool
+	AllowedDomains []string
+	DefaultRole    string
+	DomainRoles    map[string]string
+}
+
+// Role returns the role code for new users of domain, empty for none.
+func (r ProvisioningRules) Role(domain string) string {
+	if role, ok := r.DomainRoles[domain]; ok {
+		return role
+	}
+	return r.DefaultRole
+}
+
+// AllowsDomain reports whether users of domain may log in.
+func (r ProvisioningRules) AllowsDomain(domain string) bool {
+	return len(r.AllowedDomains) == 0 || slices.Contains(r.AllowedDomains, domain)
+}
+
+// Identity is the user as asserted by a provider.
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+	Username      string
+	Groups        []string
+	HostedDomain  string
+	Claims        map[string]any
+}
+
+// Provider is an OIDC issuer. Its discovery document is fetched on first use
+// and fetching is retried until it succeeds, so an unreachable provider does
+// not keep the service from starting.
+type Provider struct {
+	cfg Config
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+	verifier *oidc.IDTokenVerifier
+}
+
+func NewProvider(cfg Config) *Provider {
+	return &Provider{cfg: cfg}
+}
+
+func (p *Provider) Config() Config {
+	return p.cfg
+}
+
+// Discover returns the provider's discovered endpoints.
+func (p *Provider) Discover(ctx context.Context) (*oidc.Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.provider != nil {
+		return p.provider, nil
+	}
+
+	// The key set outlives the request that triggered discovery
+	provider, err := oidc.NewProvider(context.WithoutCancel(ctx), p.cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery for %s: %w", p.cfg.Name, err)
+	}
+	p.provider = provider
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.cfg.ClientID})
+	return provider, nil
+}
+
+// VerifyIDToken checks the signature, issuer, audience and expiry of an ID
+// token and maps its claims.
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken string) (*Identity, error) {
+	_, claims, err := p.verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+	return p.MapClaims(claims)
+}
+
+func (p *Provider) verify(ctx context.Context, rawIDToken string) (*oidc.IDToken, map[string]any, error) {
+	if _, err := p.Discover(ctx); err != nil {
+		return nil, nil, err
+	}
+	token, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	var claims map[string]any
+	if err := token.Claims(&claims); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	return token, claims, nil
+}
+
+func (p *Provider) oauth2Config(ctx context.Context, redirectURL string) (*oauth2.Config, error) {
+	provider, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  redirectURL,
+		Scopes:       p.cfg.Scopes,
+	}, nil
+}
+
+// AuthCodeURL returns the provider's authorization endpoint for an
+// authorization code request protected by PKCE (S256) and a nonce.
+func (p *Provider) AuthCodeURL(ctx context.Context, redirectURL, state, nonce, verifier string) (string, error) {
+	cfg, err := p.oauth2Config(ctx, redirectURL)
+	if err != nil {
+		return "", err
+	}
+	return cfg.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// Exchange redeems an authorization code and verifies the ID token it
+// returns, which must carry the nonce of the request. Attributes missing from
+// the ID token are taken from the userinfo endpoint.
+func (p *Provider) Exchange(ctx context.Context, redirectURL, code, verifier, nonce string) (*Identity, error) {
+	cfg, err := p.oauth2Config(ctx, redirectURL)
+	if err != nil {
+		return nil, err
+	}
+	token, err := cfg.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(err, &retrieveErr) {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidAuthCode, err)
+		}
+		return nil, err
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: token response without id_token", ErrInvalidIDToken)
+	}
+
+	idToken, claims, err := p.verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+	if idToken.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	if stringClaim(claims, p.cfg.Claims.Email) == "" && p.provider.UserInfoEndpoint() != "" {
+		p.mergeUserInfo(ctx, token, idToken.Subject, claims)
+	}
+	return p.MapClaims(claims)
+}
+
+// mergeUserInfo adds the userinfo claims the ID token lacks. Failures are
+// ignored, the ID token alone is still a valid login.
+func (p *Provider) mergeUserInfo(ctx context.Context, token *oauth2.Token, subject string, claims map[string]any) {
+	info, err := p.provider.UserInfo(ctx, oauth2.StaticTokenSource(token))
+	if err != nil || info.Subject != subject {
+		return
+	}
+	var extra map[string]any
+	if err := info.Claims(&extra); err != nil {
+		return
+	}
+	for k, v := range extra {
+		if _, ok := claims[k]; !ok {
+			claims[k] = v
+		}
+	}
+}
+
+// MapClaims builds the identity from token or userinfo claims.
+func (p *Provider) MapClaims(claims map[string]any) (*Identity, error) {
+	m := p.cfg.Claims
+	identity := &Identity{
+		Provider:      p.cfg.Name,
+		Subject:       stringClaim(claims, m.Subject),
+		Email:         stringClaim(claims, m.Email),
+		EmailVerified: boolClaim(claims, m.EmailVerified),
+		Name:          stringClaim(claims, m.Name),
+		Picture:       stringClaim(claims, m.Picture),
+		Username:      stringClaim(claims, m.Username),
+		Groups:        stringsClaim(claims, m.Groups),
+		Claims:        claims,
+	}
+	if m.HostedDomain != "" {
+		identity.HostedDomain = strings.ToLower(stringClaim(claims, m.HostedDomain))
+	} else if _, domain, ok := strings.Cut(identity.Email, "@"); ok && identity.EmailVerified {
+		// Unverified addresses may be chosen freely and prove no membership
+		identity.HostedDomain = strings.ToLower(domain)
+	}
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("%w: no %q claim", ErrInvalidIDToken, m.Subject)
+	}
+	return identity, nil
+}
+
+func stringClaim(claims map[string]any, name string) string {
+	switch v := claims[name].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+// boolClaim also accepts "true", which some providers send.
+func boolClaim(claims map[string]any, name string) bool {
+	switch v := claims[name].(type) {
+	case bool:
+		return v
+	case string:
+		b, _ := strconv.ParseBool(v)
+		return b
+	}
+	return false
+}
+
+func stringsClaim(claims map[string]any, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// Registry holds the configured providers by name.
+type Registry struct {
+	providers map[string]*Provider
+	order     []string
+
+	saml      map[string]*SAMLProvider
+	samlOrder []string
+}
+
+func NewRegistry(configs ...Config) *Registry {
+	r := &Registry{providers: make(map[string]*Provider, len(configs))}
+	for _, cfg := range configs {
+		r.providers[cfg.Name] = NewProvider(cfg)
+		r.order = append(r.order, cfg.Name)
+	}
+	return r
+}
+
+func (r *Registry) Get(name string) (*Provider, error) {
+	p, ok := r.providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return p, nil
+}
+
+// List returns the providers in configuration order.
+func (r *Registry) List() []*Provider {
+	res := make([]*Provider, 0, len(r.order))
+	for _, name := range r.order {
+		res = append(res, r.providers[name])
+	}
+	return res
+}
@@ -0,0 +1,426 @@
+package idp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID    = "identity-service"
+	testRedirectURL = "https://id.example.com/auth/oidc/test/callback"
+	testAccessToken = "upstream-access-token"
+)
+
+// fakeIssuer is a minimal OpenID provider: discovery, a key set, a token
+// endpoint checking PKCE and a userinfo endpoint. Tests play the user at the
+// authorization endpoint by calling authorize.
+type fakeIssuer struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu       sync.Mutex
+	down     bool
+	codes    map[string]authorization
+	userInfo map[string]any
+}
+
+type authorization struct {
+	challenge string
+	claims    jwt.MapClaims
+	signer    *rsa.PrivateKey
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+	f := &fakeIssuer{t: t, key: newRSAKey(t), codes: make(map[string]authorization)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", f.discovery)
+	mux.HandleFunc("GET /jwks", f.jwks)
+	mux.HandleFunc("POST /token", f.token)
+	mux.HandleFunc("GET /userinfo", f.userinfo)
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func (f *fakeIssuer) provider() *Provider {
+	return NewProvider(Config{
+		Name:                 "test",
+		Issuer:               f.server.URL,
+		ClientID:             testClientID,
+		ClientSecret:         "secret",
+		Scopes:               []string{"openid", "email", "profile"},
+		RequireVerifiedEmail: true,
+		Claims: ClaimMapping{
+			Subject:       "sub",
+			Email:         "email",
+			EmailVerified: "email_verified",
+			Name:          "name",
+			Groups:        "groups",
+		},
+	})
+}
+
+// claims returns valid ID token claims for the nonce.
+func (f *fakeIssuer) claims(nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            f.server.URL,
+		"aud":            testClientID,
+		"sub":            "user-1",
+		"nonce":          nonce,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"email":          "jane@example.com",
+		"email_verified": true,
+		"name":           "Jane Doe",
+	}
+}
+
+// authorize lets the user approve the request behind authURL and returns the
+// code the provider redirects back with. claims are put in the ID token.
+func (f *fakeIssuer) authorize(authURL string, claims jwt.MapClaims) string {
+	f.t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		f.t.Fatalf("authorization request without S256 PKCE: %s", authURL)
+	}
+	if q.Get("client_id") != testClientID || q.Get("redirect_uri") != testRedirectURL {
+		f.t.Fatalf("unexpected client in authorization request: %s", authURL)
+	}
+	code := rand.Text()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.codes[code] = authorization{challenge: q.Get("code_challenge"), claims: claims, signer: f.key}
+	return code
+}
+
+func (f *fakeIssuer) discovery(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	down := f.down
+	f.mu.Unlock()
+	if down {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, map[string]any{
+		"issuer":                                f.server.URL,
+		"authorization_endpoint":                f.server.URL + "/authorize",
+		"token_endpoint":                        f.server.URL + "/token",
+		"jwks_uri":                              f.server.URL + "/jwks",
+		"userinfo_endpoint":                     f.server.URL + "/userinfo",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (f *fakeIssuer) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := f.key.PublicKey
+	writeJSON(w, map[string]any{"keys": []map[string]any{{
+		"kty": "RSA",
+		"alg": "RS256",
+		"use": "sig",
+		"kid": "test-key",
+		"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}})
+}
+
+func (f *fakeIssuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	auth, ok := f.codes[r.PostForm.Get("code")]
+	delete(f.codes, r.PostForm.Get("code"))
+	f.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != auth.challenge || r.PostForm.Get("redirect_uri") != testRedirectURL {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, auth.claims)
+	token.Header["kid"] = "test-key"
+	idToken, err := token.SignedString(auth.signer)
+	if err != nil {
+		f.t.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{
+		"access_token": testAccessToken,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func (f *fakeIssuer) userinfo(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	info := f.userInfo
+	f.mu.Unlock()
+	if info == nil || r.Header.Get("Authorization") != "Bearer "+testAccessToken {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	writeJSON(w, info)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// login runs the authorization code flow up to the code exchange.
+func login(t *testing.T, f *fakeIssuer, p *Provider, claimsFor func(nonce string) jwt.MapClaims) (*Identity, error) {
+	t.Helper()
+	ctx := context.Background()
+	verifier, nonce := "verifier-"+rand.Text(), "nonce-"+rand.Text()
+	authURL, err := p.AuthCodeURL(ctx, testRedirectURL, "state", nonce, verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	code := f.authorize(authURL, claimsFor(nonce))
+	return p.Exchange(ctx, testRedirectURL, code, verifier, nonce)
+}
+
+func TestExchange(t *testing.T) {
+	f := newFakeIssuer(t)
+	identity, err := login(t, f, f.provider(), f.claims)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if identity.Provider != "test" || identity.Subject != "user-1" || identity.Name != "Jane Doe" {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+	if identity.Email != "jane@example.com" || !identity.EmailVerified || identity.HostedDomain != "example.com" {
+		t.Errorf("email not mapped as verified: %+v", identity)
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := f.provider()
+	ctx := context.Background()
+	authURL, err := p.AuthCodeURL(ctx, testRedirectURL, "state", "nonce", "verifier-of-the-login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := f.authorize(authURL, f.claims("nonce"))
+
+	_, err = p.Exchange(ctx, testRedirectURL, code, "verifier-of-an-attacker", "nonce")
+	if !errors.Is(err, ErrInvalidAuthCode) {
+		t.Fatalf("got %v, want ErrInvalidAuthCode", err)
+	}
+}
+
+func TestExchangeRejectsInvalidIDTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(f *fakeIssuer, claims jwt.MapClaims)
+	}{
+		{"nonce of another login", func(f *fakeIssuer, c jwt.MapClaims) { c["nonce"] = "replayed" }},
+		{"no nonce", func(f *fakeIssuer, c jwt.MapClaims) { delete(c, "nonce") }},
+		{"other audience", func(f *fakeIssuer, c jwt.MapClaims) { c["aud"] = "another-client" }},
+		{"other issuer", func(f *fakeIssuer, c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{"expired", func(f *fakeIssuer, c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{"no subject", func(f *fakeIssuer, c jwt.MapClaims) { delete(c, "sub") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeIssuer(t)
+			_, err := login(t, f, f.provider(), func(nonce string) jwt.MapClaims {
+				c := f.claims(nonce)
+				tt.mutate(f, c)
+				return c
+			})
+			if !errors.Is(err, ErrInvalidIDToken) {
+				t.Fatalf("got %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+}
+
+func TestExchangeRejectsForgedSignature(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := f.provider()
+	ctx := context.Background()
+	authURL, err := p.AuthCodeURL(ctx, testRedirectURL, "state", "nonce", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := f.authorize(authURL, f.claims("nonce"))
+	f.mu.Lock()
+	auth := f.codes[code]
+	auth.signer = newRSAKey(t)
+	f.codes[code] = auth
+	f.mu.Unlock()
+
+	_, err = p.Exchange(ctx, testRedirectURL, code, "verifier", "nonce")
+	if !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("got %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestExchangeMergesUserInfo(t *testing.T) {
+	f := newFakeIssuer(t)
+	f.userInfo = map[string]any{"sub": "user-1", "email": "jane@example.com", "email_verified": true, "name": "Not Jane"}
+
+	identity, err := login(t, f, f.provider(), func(nonce string) jwt.MapClaims {
+		c := f.claims(nonce)
+		delete(c, "email")
+		delete(c, "email_verified")
+		return c
+	})
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if identity.Email != "jane@example.com" || !identity.EmailVerified {
+		t.Errorf("userinfo email not merged: %+v", identity)
+	}
+	if identity.Name != "Jane Doe" {
+		t.Errorf("userinfo overrode the ID token name: %q", identity.Name)
+	}
+}
+
+func TestExchangeIgnoresUserInfoOfAnotherSubject(t *testing.T) {
+	f := newFakeIssuer(t)
+	f.userInfo = map[string]any{"sub": "user-1", "email": "jane@example.com"}
+
+	identity, err := login(t, f, f.provider(), func(nonce string) jwt.MapClaims {
+		c := f.claims(nonce)
+		c["sub"] = "user-2"
+		delete(c, "email")
+		return c
+	})
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if identity.Email != "" {
+		t.Errorf("merged userinfo of another subject: %+v", identity)
+	}
+}
+
+func TestDiscoverRetriesAfterFailure(t *testing.T) {
+	f := newFakeIssuer(t)
+	f.down = true
+	p := f.provider()
+
+	if _, err := p.AuthCodeURL(context.Background(), testRedirectURL, "state", "nonce", "verifier"); err == nil {
+		t.Fatal("AuthCodeURL succeeded while discovery was failing")
+	}
+
+	f.mu.Lock()
+	f.down = false
+	f.mu.Unlock()
+	authURL, err := p.AuthCodeURL(context.Background(), testRedirectURL, "state", "nonce", "verifier")
+	if err != nil {
+		t.Fatalf("AuthCodeURL after recovery: %v", err)
+	}
+	if !strings.HasPrefix(authURL, f.server.URL+"/authorize?") {
+		t.Errorf("unexpected authorization URL %s", authURL)
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := f.provider()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, f.claims(""))
+	token.Header["kid"] = "test-key"
+	raw, err := token.SignedString(f.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identity, err := p.VerifyIDToken(context.Background(), raw)
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	if identity.Subject != "user-1" {
+		t.Errorf("unexpected subject %q", identity.Subject)
+	}
+
+	if _, err := p.VerifyIDToken(context.Background(), raw[:len(raw)-4]+"AAAA"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("tampered token: got %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestMapClaims(t *testing.T) {
+	p := NewProvider(Config{Name: "test", Claims: ClaimMapping{Subject: "sub", Email: "email", EmailVerified: "email_verified", Groups: "groups"}})
+
+	identity, err := p.MapClaims(map[string]any{"sub": float64(42), "email": "jane@example.com", "email_verified": "true", "groups": []any{"admins", 1, "staff"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Subject != "42" || !identity.EmailVerified {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+	if len(identity.Groups) != 2 || identity.Groups[0] != "admins" || identity.Groups[1] != "staff" {
+		t.Errorf("unexpected groups %v", identity.Groups)
+	}
+
+	if _, err := p.MapClaims(map[string]any{"email": "jane@example.com"}); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("no subject: got %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestMapClaimsHostedDomain(t *testing.T) {
+	p := NewProvider(Config{Name: "test", Claims: ClaimMapping{Subject: "sub", Email: "email", EmailVerified: "email_verified"}})
+
+	identity, err := p.MapClaims(map[string]any{"sub": "1", "email": "jane@Example.com", "email_verified": "true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.HostedDomain != "example.com" {
+		t.Errorf("verified email: got hosted domain %q", identity.HostedDomain)
+	}
+
+	identity, err = p.MapClaims(map[string]any{"sub": "1", "email": "jane@example.com", "email_verified": false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.HostedDomain != "" {
+		t.Errorf("unverified email must not give a hosted domain, got %q", identity.HostedDomain)
+	}
+
+	p = NewProvider(Config{Name: "test", Claims: ClaimMapping{Subject: "sub", Email: "email", HostedDomain: "hd"}})
+	identity, err = p.MapClaims(map[string]any{"sub": "1", "email": "jane@gmail.com", "hd": "Example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.HostedDomain != "example.com" {
+		t.Errorf("hosted domain claim: got %q", identity.HostedDomain)
+	}
+}
@@ -0,0 +1,257 @@
+package idp
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+var ErrInvalidSAMLResponse = errors.New("invalid saml response")
+
+// SAMLAttributes names the assertion attributes holding the user attributes.
+// Attributes match by Name or FriendlyName.
+type SAMLAttributes struct {
+	Email  string
+	Name   string
+	Groups string
+}
+
+// SAMLConfig is an upstream SAML identity provider and this service as its
+// service provider. The IdP metadata comes from MetadataURL or Metadata.
+type SAMLConfig struct {
+	Name         string
+	DisplayName  string
+	MetadataURL  string
+	Metadata     []byte
+	EntityID     string
+	ACSURL       string
+	Key          crypto.Signer
+	Certificate  *x509.Certificate
+	Attributes   SAMLAttributes
+	TrustEmail   bool // the IdP vouches for the email addresses it asserts
+	Provisioning ProvisioningRules
+}
+
+// SAMLProvider runs SP-initiated logins at a SAML IdP. Like OIDC discovery,
+// the IdP metadata is fetched on first use and retried until it succeeds.
+type SAMLProvider struct {
+	cfg SAMLConfig
+
+	mu sync.Mutex
+	sp *saml.ServiceProvider
+}
+
+func NewSAMLProvider(cfg SAMLConfig) (*SAMLProvider, error) {
+	if cfg.Key == nil || cfg.Certificate == nil {
+		return nil, errors.New("saml service provider key and certificate required")
+	}
+	if _, err := signatureMethod(cfg.Key); err != nil {
+		return nil, err
+	}
+	if _, err := url.Parse(cfg.EntityID); err != nil {
+		return nil, fmt.Errorf("saml entity id: %w", err)
+	}
+	if _, err := url.Parse(cfg.ACSURL); err != nil {
+		return nil, fmt.Errorf("saml acs url: %w", err)
+	}
+	return &SAMLProvider{cfg: cfg}, nil
+}
+
+func (p *SAMLProvider) Config() SAMLConfig {
+	return p.cfg
+}
+
+func (p *SAMLProvider) serviceProvider() saml.ServiceProvider {
+	entityID, _ := url.Parse(p.cfg.EntityID)
+	acsURL, _ := url.Parse(p.cfg.ACSURL)
+	method, _ := signatureMethod(p.cfg.Key)
+	return saml.ServiceProvider{
+		EntityID:          p.cfg.EntityID,
+		Key:               p.cfg.Key,
+		Certificate:       p.cfg.Certificate,
+		MetadataURL:       *entityID,
+		AcsURL:            *acsURL,
+		AuthnNameIDFormat: saml.UnspecifiedNameIDFormat,
+		AllowIDPInitiated: false,
+		SignatureMethod:   method,
+	}
+}
+
+// signatureMethod returns the algorithm AuthnRequests are signed with.
+func signatureMethod(key crypto.Signer) (string, error) {
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		return dsig.RSASHA256SignatureMethod, nil
+	case *ecdsa.PrivateKey:
+		return dsig.ECDSASHA256SignatureMethod, nil
+	}
+	return "", fmt.Errorf("saml service provider key: unsupported type %T, use RSA or ECDSA", key)
+}
+
+// load returns the service provider with the IdP metadata.
+func (p *SAMLProvider) load(ctx context.Context) (*saml.ServiceProvider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sp != nil {
+		return p.sp, nil
+	}
+
+	var metadata *saml.EntityDescriptor
+	var err error
+	if len(p.cfg.Metadata) > 0 {
+		metadata, err = samlsp.ParseMetadata(p.cfg.Metadata)
+	} else {
+		var metadataURL *url.URL
+		metadataURL, err = url.Parse(p.cfg.MetadataURL)
+		if err == nil {
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+			defer cancel()
+			metadata, err = samlsp.FetchMetadata(ctx, http.DefaultClient, *metadataURL)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("saml metadata for %s: %w", p.cfg.Name, err)
+	}
+
+	sp := p.serviceProvider()
+	sp.IDPMetadata = metadata
+	p.sp = &sp
+	return p.sp, nil
+}
+
+// SPMetadata returns this service's metadata to register at the IdP.
+func (p *SAMLProvider) SPMetadata() ([]byte, error) {
+	sp := p.serviceProvider()
+	return xml.MarshalIndent(sp.Metadata(), "", "  ")
+}
+
+// AuthnRequestURL returns the IdP URL to send the browser to with an
+// AuthnRequest (HTTP-Redirect binding) and the ID of that request, which the
+// response must answer.
+func (p *SAMLProvider) AuthnRequestURL(ctx context.Context, relayState string) (string, string, error) {
+	sp, err := p.load(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	req, err := sp.MakeAuthenticationRequest(sp.GetSSOBindingLocation(saml.HTTPRedirectBinding), saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return "", "", err
+	}
+	redirect, err := req.Redirect(relayState, sp)
+	if err != nil {
+		return "", "", err
+	}
+	return redirect.String(), req.ID, nil
+}
+
+// ParseResponse verifies the signature, audience, validity window and
+// recipient of a base64 encoded SAMLResponse answering requestID and maps the
+// assertion to an identity.
+func (p *SAMLProvider) ParseResponse(ctx context.Context, samlResponse, requestID string) (*Identity, error) {
+	sp, err := p.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(samlResponse)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSAMLResponse, err)
+	}
+	assertion, err := sp.ParseXMLResponse(raw, []string{requestID}, sp.AcsURL)
+	if err != nil {
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSAMLResponse, invalid.PrivateErr)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSAMLResponse, err)
+	}
+	return p.mapAssertion(assertion)
+}
+
+func (p *SAMLProvider) mapAssertion(assertion *saml.Assertion) (*Identity, error) {
+	if assertion.Subject == nil || assertion.Subject.NameID == nil || assertion.Subject.NameID.Value == "" {
+		return nil, fmt.Errorf("%w: no NameID", ErrInvalidSAMLResponse)
+	}
+	nameID := assertion.Subject.NameID
+
+	attrs := make(map[string][]string)
+	claims := make(map[string]any)
+	for _, statement := range assertion.AttributeStatements {
+		for _, attr := range statement.Attributes {
+			var values []string
+			for _, v := range attr.Values {
+				values = append(values, v.Value)
+			}
+			for _, key := range []string{attr.Name, attr.FriendlyName} {
+				if key != "" {
+					attrs[key] = append(attrs[key], values...)
+				}
+			}
+			claims[attr.Name] = values
+		}
+	}
+	first := func(name string) string {
+		if v := attrs[name]; len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+
+	identity := &Identity{
+		Provider: "saml:" + p.cfg.Name,
+		Subject:  nameID.Value,
+		Email:    first(p.cfg.Attributes.Email),
+		Name:     first(p.cfg.Attributes.Name),
+		Groups:   attrs[p.cfg.Attributes.Groups],
+		Claims:   claims,
+	}
+	if identity.Email == "" && nameID.Format == string(saml.EmailAddressNameIDFormat) {
+		identity.Email = nameID.Value
+	}
+	// SAML has no email_verified, whether to trust addresses is configured
+	identity.EmailVerified = identity.Email != "" && p.cfg.TrustEmail
+	if _, domain, ok := strings.Cut(identity.Email, "@"); ok && identity.EmailVerified {
+		identity.HostedDomain = strings.ToLower(domain)
+	}
+	return identity, nil
+}
+
+// SAMLProviders returns the SAML providers in configuration order.
+func (r *Registry) SAMLProviders() []*SAMLProvider {
+	res := make([]*SAMLProvider, 0, len(r.samlOrder))
+	for _, name := range r.samlOrder {
+		res = append(res, r.saml[name])
+	}
+	return res
+}
+
+func (r *Registry) GetSAML(name string) (*SAMLProvider, error) {
+	p, ok := r.saml[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return p, nil
+}
+
+// AddSAML registers a SAML provider.
+func (r *Registry) AddSAML(p *SAMLProvider) {
+	if r.saml == nil {
+		r.saml = make(map[string]*SAMLProvider)
+	}
+	r.saml[p.cfg.Name] = p
+	r.samlOrder = append(r.samlOrder, p.cfg.Name)
+}
@@ -0,0 +1,315 @@
+package idp
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/logger"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+const (
+	testSPEntityID = "https://id.example.com/auth/saml/corp/metadata"
+	testACSURL     = "https://id.example.com/auth/saml/corp/acs"
+)
+
+// newTestCertificate returns a key and a self-signed certificate for it.
+func newTestCertificate(t *testing.T, commonName string) (*rsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	key := newRSAKey(t)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+// testIdP is a SAML identity provider answering the AuthnRequests of one
+// service provider.
+type testIdP struct {
+	t   *testing.T
+	idp *saml.IdentityProvider
+	sp  *saml.EntityDescriptor
+}
+
+func (i *testIdP) GetServiceProvider(r *http.Request, serviceProviderID string) (*saml.EntityDescriptor, error) {
+	if i.sp == nil || serviceProviderID != i.sp.EntityID {
+		return nil, os.ErrNotExist
+	}
+	return i.sp, nil
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	key, cert := newTestCertificate(t, "idp.example.com")
+	i := &testIdP{t: t}
+	i.idp = &saml.IdentityProvider{
+		Key:                     key,
+		Certificate:             cert,
+		Logger:                  logger.DefaultLogger,
+		MetadataURL:             url.URL{Scheme: "https", Host: "idp.example.com", Path: "/metadata"},
+		SSOURL:                  url.URL{Scheme: "https", Host: "idp.example.com", Path: "/sso"},
+		ServiceProviderProvider: i,
+	}
+	return i
+}
+
+// metadata returns the IdP metadata as configured at the service provider.
+func (i *testIdP) metadata() []byte {
+	i.t.Helper()
+	raw, err := xml.Marshal(i.idp.Metadata())
+	if err != nil {
+		i.t.Fatal(err)
+	}
+	return raw
+}
+
+// register trusts the service provider, as an administrator uploading its
+// metadata would.
+func (i *testIdP) register(p *SAMLProvider) {
+	i.t.Helper()
+	raw, err := p.SPMetadata()
+	if err != nil {
+		i.t.Fatal(err)
+	}
+	i.sp = &saml.EntityDescriptor{}
+	if err := xml.Unmarshal(raw, i.sp); err != nil {
+		i.t.Fatal(err)
+	}
+}
+
+// respond logs the session in for the AuthnRequest behind authURL and
+// returns the base64 SAMLResponse the browser posts to the ACS. now is when
+// the IdP issues the response.
+func (i *testIdP) respond(authURL string, session *saml.Session, now time.Time) string {
+	i.t.Helper()
+	req, err := saml.NewIdpAuthnRequest(i.idp, httptest.NewRequest(http.MethodGet, authURL, nil))
+	if err != nil {
+		i.t.Fatal(err)
+	}
+	if err := req.Validate(); err != nil {
+		i.t.Fatalf("IdP rejected the AuthnRequest: %v", err)
+	}
+	req.Now = now
+	if err := (saml.DefaultAssertionMaker{}).MakeAssertion(req, session); err != nil {
+		i.t.Fatal(err)
+	}
+	form, err := req.PostBinding()
+	if err != nil {
+		i.t.Fatal(err)
+	}
+	return form.SAMLResponse
+}
+
+func testSession() *saml.Session {
+	return &saml.Session{
+		ID:           "session-1",
+		NameID:       "jane",
+		NameIDFormat: string(saml.PersistentNameIDFormat),
+		CustomAttributes: []saml.Attribute{
+			{Name: "email", Values: []saml.AttributeValue{{Type: "xs:string", Value: "jane@Example.com"}}},
+			{Name: "displayName", Values: []saml.AttributeValue{{Type: "xs:string", Value: "Jane Doe"}}},
+			{Name: "groups", Values: []saml.AttributeValue{{Type: "xs:string", Value: "admins"}, {Type: "xs:string", Value: "staff"}}},
+		},
+	}
+}
+
+func newTestSAMLProvider(t *testing.T, i *testIdP, trustEmail bool) (*SAMLProvider, *x509.Certificate) {
+	t.Helper()
+	key, cert := newTestCertificate(t, "id.example.com")
+	p, err := NewSAMLProvider(SAMLConfig{
+		Name:        "corp",
+		Metadata:    i.metadata(),
+		EntityID:    testSPEntityID,
+		ACSURL:      testACSURL,
+		Key:         key,
+		Certificate: cert,
+		Attributes:  SAMLAttributes{Email: "email", Name: "displayName", Groups: "groups"},
+		TrustEmail:  trustEmail,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.register(p)
+	return p, cert
+}
+
+func TestSAMLLogin(t *testing.T) {
+	i := newTestIdP(t)
+	p, _ := newTestSAMLProvider(t, i, false)
+	ctx := context.Background()
+
+	authURL, requestID, err := p.AuthnRequestURL(ctx, "relay")
+	if err != nil {
+		t.Fatalf("AuthnRequestURL: %v", err)
+	}
+	identity, err := p.ParseResponse(ctx, i.respond(authURL, testSession(), time.Now()), requestID)
+	if err != nil {
+		t.Fatalf("ParseResponse: %v", err)
+	}
+	if identity.Provider != "saml:corp" || identity.Subject != "jane" || identity.Name != "Jane Doe" {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+	if len(identity.Groups) != 2 || identity.Groups[0] != "admins" {
+		t.Errorf("unexpected groups %v", identity.Groups)
+	}
+	// Without TrustEmail the address proves nothing
+	if identity.Email != "jane@Example.com" || identity.EmailVerified || identity.HostedDomain != "" {
+		t.Errorf("untrusted email mapped as verified: %+v", identity)
+	}
+}
+
+func TestSAMLLoginTrustedEmail(t *testing.T) {
+	i := newTestIdP(t)
+	p, _ := newTestSAMLProvider(t, i, true)
+	ctx := context.Background()
+
+	authURL, requestID, err := p.AuthnRequestURL(ctx, "relay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := p.ParseResponse(ctx, i.respond(authURL, testSession(), time.Now()), requestID)
+	if err != nil {
+		t.Fatalf("ParseResponse: %v", err)
+	}
+	if !identity.EmailVerified || identity.HostedDomain != "example.com" {
+		t.Errorf("trusted email not mapped as verified: %+v", identity)
+	}
+}
+
+func TestSAMLRejectsResponseToAnotherRequest(t *testing.T) {
+	i := newTestIdP(t)
+	p, _ := newTestSAMLProvider(t, i, false)
+	ctx := context.Background()
+
+	authURL, _, err := p.AuthnRequestURL(ctx, "relay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherRequestID, err := p.AuthnRequestURL(ctx, "other-relay")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = p.ParseResponse(ctx, i.respond(authURL, testSession(), time.Now()), otherRequestID)
+	if !errors.Is(err, ErrInvalidSAMLResponse) {
+		t.Fatalf("got %v, want ErrInvalidSAMLResponse", err)
+	}
+}
+
+func TestSAMLRejectsForgedResponse(t *testing.T) {
+	i := newTestIdP(t)
+	p, _ := newTestSAMLProvider(t, i, false)
+	ctx := context.Background()
+
+	// Same IdP entity and endpoints, but a key the service provider does not trust
+	forger := newTestIdP(t)
+	forger.sp = i.sp
+	authURL, requestID, err := p.AuthnRequestURL(ctx, "relay")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = p.ParseResponse(ctx, forger.respond(authURL, testSession(), time.Now()), requestID)
+	if !errors.Is(err, ErrInvalidSAMLResponse) {
+		t.Fatalf("got %v, want ErrInvalidSAMLResponse", err)
+	}
+}
+
+func TestSAMLRejectsExpiredResponse(t *testing.T) {
+	i := newTestIdP(t)
+	p, _ := newTestSAMLProvider(t, i, false)
+	ctx := context.Background()
+
+	authURL, requestID, err := p.AuthnRequestURL(ctx, "relay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.ParseResponse(ctx, i.respond(authURL, testSession(), time.Now().Add(-time.Hour)), requestID)
+	if !errors.Is(err, ErrInvalidSAMLResponse) {
+		t.Fatalf("got %v, want ErrInvalidSAMLResponse", err)
+	}
+}
+
+func TestSAMLRejectsMalformedResponse(t *testing.T) {
+	i := newTestIdP(t)
+	p, _ := newTestSAMLProvider(t, i, false)
+	ctx := context.Background()
+
+	for _, response := range []string{"not base64!", base64.StdEncoding.EncodeToString([]byte("<Response/>"))} {
+		if _, err := p.ParseResponse(ctx, response, "id-1"); !errors.Is(err, ErrInvalidSAMLResponse) {
+			t.Errorf("%q: got %v, want ErrInvalidSAMLResponse", response, err)
+		}
+	}
+}
+
+func TestSAMLSignsAuthnRequest(t *testing.T) {
+	i := newTestIdP(t)
+	p, cert := newTestSAMLProvider(t, i, false)
+
+	authURL, _, err := p.AuthnRequestURL(context.Background(), "relay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Query().Get("SigAlg"); got != dsig.RSASHA256SignatureMethod {
+		t.Fatalf("SigAlg %q, want %q", got, dsig.RSASHA256SignatureMethod)
+	}
+
+	// The HTTP-Redirect binding signs the query up to the signature
+	signed, _, ok := strings.Cut(u.RawQuery, "&Signature=")
+	if !ok {
+		t.Fatalf("AuthnRequest not signed: %s", authURL)
+	}
+	sig, err := base64.StdEncoding.DecodeString(u.Query().Get("Signature"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte(signed))
+	if err := rsa.VerifyPKCS1v15(cert.PublicKey.(*rsa.PublicKey), crypto.SHA256, digest[:], sig); err != nil {
+		t.Errorf("AuthnRequest signature does not verify with the SP certificate: %v", err)
+	}
+}
+
+func TestNewSAMLProviderRejectsUnsupportedKey(t *testing.T) {
+	_, cert := newTestCertificate(t, "id.example.com")
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewSAMLProvider(SAMLConfig{Name: "corp", EntityID: testSPEntityID, ACSURL: testACSURL, Key: key, Certificate: cert})
+	if err == nil {
+		t.Fatal("accepted an Ed25519 key, which cannot sign AuthnRequests")
+	}
+}
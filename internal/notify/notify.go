@@ -0,0 +1,121 @@
+// Package notify delivers messages such as password reset links to users.
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Message types
+const (
+	TypePasswordReset = "password_reset"
+	TypeEmailLogin    = "email_login"
+)
+
+// Message is addressed to a user. Data carries the values a richer channel
+// (templated email, SMS...) needs, e.g. the reset link.
+type Message struct {
+	Type    string            `json:"type"`
+	UserID  int32             `json:"userId"`
+	To      string            `json:"to"`
+	Subject string            `json:"subject"`
+	Text    string            `json:"text"`
+	Data    map[string]string `json:"data,omitempty"`
+	Time    time.Time         `json:"time"`
+}
+
+// Notifier delivers messages to users.
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+type logNotifier struct{}
+
+// NewLogNotifier writes messages to the log. Messages contain secrets such as
+// reset links, so this is for development only.
+func NewLogNotifier() Notifier {
+	return logNotifier{}
+}
+
+func (logNotifier) Notify(ctx context.Context, msg Message) error {
+	log.Printf("[Notify] %s to %s: %s\n%s", msg.Type, msg.To, msg.Subject, msg.Text)
+	return nil
+}
+
+type fileNotifier struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileNotifier appends messages as JSON lines to the file at path, where
+// tests and local tooling can pick them up.
+func NewFileNotifier(path string) Notifier {
+	return &fileNotifier{path: path}
+}
+
+func (n *fileNotifier) Notify(ctx context.Context, msg Message) error {
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	f, err := os.OpenFile(n.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Capture keeps messages in memory instead of delivering them, for tests
+// that need to read the code or link a user would have received.
+type Capture struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewCapture() *Capture {
+	return &Capture{}
+}
+
+func (c *Capture) Notify(ctx context.Context, msg Message) error {
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, msg)
+	return nil
+}
+
+// Messages returns the captured messages, oldest first.
+func (c *Capture) Messages() []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Message(nil), c.messages...)
+}
+
+// Last returns the latest message sent to the address.
+func (c *Capture) Last(to string) (Message, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := len(c.messages) - 1; i >= 0; i-- {
+		if c.messages[i].To == to {
+			return c.messages[i], true
+		}
+	}
+	return Message{}, false
+}
@@ -0,0 +1,208 @@
+package password
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Blocklist tells whether a password is known to attackers, either because
+// it is common or because it appeared in a breach.
+type Blocklist interface {
+	Contains(password string) (bool, error)
+}
+
+//go:embed common-passwords.txt
+var commonPasswords string
+
+type commonList map[string]struct{}
+
+// CommonPasswords returns the bundled list of most common passwords. Entries
+// match case-insensitively.
+func CommonPasswords() Blocklist {
+	list := commonList{}
+	scanner := bufio.NewScanner(strings.NewReader(commonPasswords))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		list[strings.ToLower(line)] = struct{}{}
+	}
+	return list
+}
+
+func (l commonList) Contains(password string) (bool, error) {
+	_, ok := l[strings.ToLower(password)]
+	return ok, nil
+}
+
+const (
+	sha1HexLength = 40
+	// maxHashLineLength bounds a "HASH:COUNT" line, longer ones mean the file
+	// is not a hash list.
+	maxHashLineLength = 128
+)
+
+// HashFile looks passwords up in a file of uppercase hex SHA-1 hashes, one
+// per line and sorted, optionally followed by ":count" as in the Have I Been
+// Pwned "ordered by hash" downloads. The file is binary searched on disk and
+// never loaded into memory.
+type HashFile struct {
+	f    *os.File
+	size int64
+}
+
+// OpenHashFile opens and sanity checks the hash file at path.
+func OpenHashFile(path string) (*HashFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	h := &HashFile{f: f, size: info.Size()}
+	if h.size > 0 {
+		line, _, err := h.lineAt(0)
+		if err == nil && !isSHA1Hex(hashOf(line)) {
+			err = errors.New("first line is not a SHA-1 hash")
+		}
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return h, nil
+}
+
+func (h *HashFile) Close() error {
+	return h.f.Close()
+}
+
+func (h *HashFile) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	target := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	// lo is always the start of a line. Search the lines starting in [lo, hi).
+	lo, hi := int64(0), h.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, err := h.lineStart(mid)
+		if err != nil {
+			return false, err
+		}
+		if start >= hi {
+			hi = mid
+			continue
+		}
+
+		line, next, err := h.lineAt(start)
+		if err != nil {
+			return false, err
+		}
+		switch cmp := strings.Compare(strings.ToUpper(hashOf(line)), target); {
+		case cmp == 0:
+			return true, nil
+		case cmp < 0:
+			lo = next
+		default:
+			hi = start
+		}
+	}
+	return false, nil
+}
+
+// lineStart returns the offset of the first line starting at or after off.
+func (h *HashFile) lineStart(off int64) (int64, error) {
+	if off == 0 {
+		return 0, nil
+	}
+	buf := make([]byte, maxHashLineLength+1)
+	n, err := h.f.ReadAt(buf, off-1)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	i := bytes.IndexByte(buf[:n], '\n')
+	if i < 0 {
+		if err == io.EOF {
+			return h.size, nil
+		}
+		return 0, errors.New("hash file line too long")
+	}
+	return off + int64(i), nil
+}
+
+// lineAt returns the line starting at off and the offset of the next one.
+func (h *HashFile) lineAt(off int64) (string, int64, error) {
+	buf := make([]byte, maxHashLineLength)
+	n, err := h.f.ReadAt(buf, off)
+	if err != nil && err != io.EOF {
+		return "", 0, err
+	}
+	i := bytes.IndexByte(buf[:n], '\n')
+	if i < 0 {
+		if err != io.EOF {
+			return "", 0, errors.New("hash file line too long")
+		}
+		// Last line without a trailing newline
+		return strings.TrimSpace(string(buf[:n])), off + int64(n), nil
+	}
+	return strings.TrimSpace(string(buf[:i])), off + int64(i) + 1, nil
+}
+
+func hashOf(line string) string {
+	hash, _, _ := strings.Cut(line, ":")
+	return hash
+}
+
+func isSHA1Hex(s string) bool {
+	if len(s) != sha1HexLength {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// LoadBlocklist combines the bundled common passwords and the hash file at
+// path, each if enabled. It returns nil when there is nothing to check.
+func LoadBlocklist(common bool, path string) (Blocklist, error) {
+	var lists Blocklists
+	if common {
+		lists = append(lists, CommonPasswords())
+	}
+	if path != "" {
+		f, err := OpenHashFile(path)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, f)
+	}
+	if len(lists) == 0 {
+		return nil, nil
+	}
+	return lists, nil
+}
+
+// Blocklists checks every list in turn.
+type Blocklists []Blocklist
+
+func (l Blocklists) Contains(password string) (bool, error) {
+	for _, list := range l {
+		found, err := list.Contains(password)
+		if err != nil || found {
+			return found, err
+		}
+	}
+	return false, nil
+}
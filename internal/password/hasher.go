@@ -0,0 +1,208 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrUnknownHash = errors.New("unsupported password hash format")
+	ErrTooLong     = errors.New("password too long for the hash algorithm")
+)
+
+// Hasher hashes passwords into self-describing strings and verifies them.
+type Hasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether password matches hash. A hash in a format the
+	// hasher does not support is an ErrUnknownHash.
+	Verify(hash, password string) (bool, error)
+	// Supports reports whether hash is in a format the hasher can verify.
+	Supports(hash string) bool
+	// NeedsRehash reports whether hash should be replaced by a fresh Hash,
+	// because it uses another algorithm or other parameters.
+	NeedsRehash(hash string) bool
+}
+
+// Algorithms
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+// bcryptMaxBytes is the input length bcrypt silently truncates at.
+const bcryptMaxBytes = 72
+
+type bcryptHasher struct {
+	cost int
+}
+
+func NewBcryptHasher(cost int) Hasher {
+	return bcryptHasher{cost: cost}
+}
+
+func (h bcryptHasher) Hash(password string) (string, error) {
+	if len(password) > bcryptMaxBytes {
+		return "", ErrTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h bcryptHasher) Verify(hash, password string) (bool, error) {
+	if !h.Supports(hash) {
+		return false, ErrUnknownHash
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h bcryptHasher) Supports(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (h bcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.cost
+}
+
+// Argon2Params are the argon2id parameters, memory in KiB.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+type argon2idHasher struct {
+	params Argon2Params
+}
+
+// NewArgon2idHasher hashes into the PHC string format, e.g.
+// $argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>.
+func NewArgon2idHasher(params Argon2Params) Hasher {
+	return argon2idHasher{params: params}
+}
+
+func (h argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.params.Memory, h.params.Iterations, h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h argon2idHasher) Verify(hash, password string) (bool, error) {
+	params, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+	actual := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	return subtle.ConstantTimeCompare(actual, key) == 1, nil
+}
+
+func (h argon2idHasher) Supports(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func (h argon2idHasher) NeedsRehash(hash string) bool {
+	params, salt, _, err := parseArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return params.Memory != h.params.Memory ||
+		params.Iterations != h.params.Iterations ||
+		params.Parallelism != h.params.Parallelism ||
+		params.KeyLength != h.params.KeyLength ||
+		uint32(len(salt)) != h.params.SaltLength
+}
+
+func parseArgon2id(hash string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != AlgorithmArgon2id {
+		return params, nil, nil, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("%w: argon2 version %q", ErrUnknownHash, parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("%w: argon2 parameters %q", ErrUnknownHash, parts[3])
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("%w: argon2 salt", ErrUnknownHash)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, fmt.Errorf("%w: argon2 key", ErrUnknownHash)
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
+
+type migratingHasher struct {
+	preferred Hasher
+	legacy    []Hasher
+}
+
+// NewMigratingHasher hashes with preferred and still verifies hashes of the
+// legacy hashers, flagging them for rehashing.
+func NewMigratingHasher(preferred Hasher, legacy ...Hasher) Hasher {
+	return migratingHasher{preferred: preferred, legacy: legacy}
+}
+
+func (h migratingHasher) Hash(password string) (string, error) {
+	return h.preferred.Hash(password)
+}
+
+func (h migratingHasher) Verify(hash, password string) (bool, error) {
+	if h.preferred.Supports(hash) {
+		return h.preferred.Verify(hash, password)
+	}
+	for _, legacy := range h.legacy {
+		if legacy.Supports(hash) {
+			return legacy.Verify(hash, password)
+		}
+	}
+	return false, ErrUnknownHash
+}
+
+func (h migratingHasher) Supports(hash string) bool {
+	if h.preferred.Supports(hash) {
+		return true
+	}
+	for _, legacy := range h.legacy {
+		if legacy.Supports(hash) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h migratingHasher) NeedsRehash(hash string) bool {
+	return !h.preferred.Supports(hash) || h.preferred.NeedsRehash(hash)
+}
@@ -0,0 +1,112 @@
+// Package password holds the rules passwords have to satisfy.
+package password
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// minUserInfoLength is the shortest username or email part that is checked
+// for, shorter ones would reject too many good passwords.
+const minUserInfoLength = 3
+
+// Policy describes what a new password must look like. Zero values disable
+// the corresponding rule.
+type Policy struct {
+	MinLength        int // characters
+	MaxLength        int // characters
+	RequireUpper     bool
+	RequireLower     bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	DisallowUserInfo bool          // no username or email local part in the password
+	HistorySize      int           // how many previous passwords cannot be reused
+	MaxAge           time.Duration // after which a change is required
+	Blocklist        Blocklist     // common or breached passwords, optional
+}
+
+// UserInfo is what a password must not contain when DisallowUserInfo is set.
+type UserInfo struct {
+	Username string
+	Email    string
+}
+
+// Check returns the rules the password breaks, nil when it is acceptable.
+// Password history is checked separately since it needs the stored hashes.
+func (p Policy) Check(password string, user UserInfo) []string {
+	var violations []string
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters", p.MinLength))
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, fmt.Sprintf("must be at most %d characters", p.MaxLength))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		violations = append(violations, "must contain an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		violations = append(violations, "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		violations = append(violations, "must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		violations = append(violations, "must contain a symbol")
+	}
+
+	if p.DisallowUserInfo && containsUserInfo(password, user) {
+		violations = append(violations, "must not contain the username or email")
+	}
+
+	// A failing lookup must not block password changes
+	if p.Blocklist != nil {
+		found, err := p.Blocklist.Contains(password)
+		if err != nil {
+			log.Printf("[Password] Blocklist lookup failed: %v", err)
+		} else if found {
+			violations = append(violations, "is too common or known from a data breach")
+		}
+	}
+	return violations
+}
+
+// Expired reports whether a password changed at changedAt must be changed now.
+func (p Policy) Expired(changedAt time.Time) bool {
+	return p.MaxAge > 0 && !changedAt.IsZero() && time.Since(changedAt) > p.MaxAge
+}
+
+func containsUserInfo(password string, user UserInfo) bool {
+	lowered := strings.ToLower(password)
+
+	parts := []string{user.Username}
+	if local, _, ok := strings.Cut(user.Email, "@"); ok {
+		parts = append(parts, local)
+	}
+	for _, part := range parts {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if utf8.RuneCountInString(part) >= minUserInfoLength && strings.Contains(lowered, part) {
+			return true
+		}
+	}
+	return false
+}
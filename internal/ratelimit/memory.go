@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often idle buckets are dropped by Run.
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// full is when the bucket is refilled completely and can be forgotten
+	full time.Time
+}
+
+// MemoryLimiter keeps buckets in process memory. Limits are per replica.
+type MemoryLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+func (l *MemoryLimiter) Allow(ctx context.Context, key string, policy Policy) (Result, error) {
+	if !policy.Enabled() {
+		return Result{Allowed: true}, nil
+	}
+
+	burst := float64(policy.Requests)
+	rate := burst / policy.Period.Seconds() // tokens per second
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+
+	// Refill for the time elapsed since the last request
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	res := Result{}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	res.Remaining = int(b.tokens)
+	b.full = now.Add(time.Duration((burst - b.tokens) / rate * float64(time.Second)))
+	return res, nil
+}
+
+// Run drops refilled buckets until ctx is cancelled.
+func (l *MemoryLimiter) Run(ctx context.Context) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.sweep()
+		}
+	}
+}
+
+func (l *MemoryLimiter) sweep() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for key, b := range l.buckets {
+		if !b.full.After(now) {
+			delete(l.buckets, key)
+		}
+	}
+}
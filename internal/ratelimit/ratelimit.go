@@ -0,0 +1,83 @@
+// Package ratelimit implements token bucket rate limiting behind a Limiter
+// interface, so the in-memory backend can be swapped for a shared one when
+// the service runs with several replicas.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy allows Requests per Period, refilled continuously. Bursts of up to
+// Requests are allowed. A zero policy disables limiting.
+type Policy struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParsePolicy parses "<requests>/<period>", e.g. "10/1m" or "100/h".
+// "0" and "off" disable limiting.
+func ParsePolicy(s string) (Policy, error) {
+	s = strings.TrimSpace(s)
+	if s == "0" || strings.EqualFold(s, "off") {
+		return Policy{}, nil
+	}
+
+	requests, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Policy{}, fmt.Errorf("invalid rate limit %q, expected <requests>/<period>", s)
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 0 {
+		return Policy{}, fmt.Errorf("invalid rate limit %q: bad request count", s)
+	}
+	// Allow "10/m" as a shorthand for "10/1m"
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Policy{}, fmt.Errorf("invalid rate limit %q: bad period", s)
+	}
+	return Policy{Requests: n, Period: d}, nil
+}
+
+// Decode lets envconfig parse policies straight from the environment.
+func (p *Policy) Decode(value string) error {
+	policy, err := ParsePolicy(value)
+	if err != nil {
+		return err
+	}
+	*p = policy
+	return nil
+}
+
+// Enabled reports whether the policy limits anything.
+func (p Policy) Enabled() bool {
+	return p.Requests > 0 && p.Period > 0
+}
+
+func (p Policy) String() string {
+	if !p.Enabled() {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", p.Requests, p.Period)
+}
+
+// Result is the outcome of taking a token.
+type Result struct {
+	Allowed bool
+	// Remaining is the number of whole tokens left in the bucket.
+	Remaining int
+	// RetryAfter is how long until the next token, set when not allowed.
+	RetryAfter time.Duration
+}
+
+// Limiter takes tokens from buckets identified by key. Implementations must
+// be safe for concurrent use.
+type Limiter interface {
+	Allow(ctx context.Context, key string, policy Policy) (Result, error)
+}
@@ -0,0 +1,139 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.20.0
+// source: email_login_tokens.sql
+
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const createEmailLoginToken = `-- name: CreateEmailLoginToken :exec
+INSERT INTO email_login_tokens (
+    user_id, token_hash, code_hash, expires_at, ip_address
+) VALUES (
+    $1, $2, $3, $4, $5
+)
+`
+
+type CreateEmailLoginTokenParams struct {
+	UserID    int32              `json:"user_id"`
+	TokenHash string             `json:"token_hash"`
+	CodeHash  string             `json:"code_hash"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+	IpAddress pgtype.Text        `json:"ip_address"`
+}
+
+func (q *Queries) CreateEmailLoginToken(ctx context.Context, arg CreateEmailLoginTokenParams) error {
+	_, err := q.db.Exec(ctx, createEmailLoginToken,
+		arg.UserID,
+		arg.TokenHash,
+		arg.CodeHash,
+		arg.ExpiresAt,
+		arg.IpAddress,
+	)
+	return err
+}
+
+const deleteExpiredEmailLoginTokens = `-- name: DeleteExpiredEmailLoginTokens :execrows
+DELETE FROM email_login_tokens
+WHERE expires_at < NOW()
+`
+
+func (q *Queries) DeleteExpiredEmailLoginTokens(ctx context.Context) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredEmailLoginTokens)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const getEmailLoginTokenByHash = `-- name: GetEmailLoginTokenByHash :one
+SELECT id, user_id, token_hash, code_hash, attempts, expires_at, used_at, ip_address, created_at FROM email_login_tokens
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+LIMIT 1
+`
+
+func (q *Queries) GetEmailLoginTokenByHash(ctx context.Context, tokenHash string) (EmailLoginToken, error) {
+	row := q.db.QueryRow(ctx, getEmailLoginTokenByHash, tokenHash)
+	var i EmailLoginToken
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.TokenHash,
+		&i.CodeHash,
+		&i.Attempts,
+		&i.ExpiresAt,
+		&i.UsedAt,
+		&i.IpAddress,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getLatestEmailLoginToken = `-- name: GetLatestEmailLoginToken :one
+SELECT id, user_id, token_hash, code_hash, attempts, expires_at, used_at, ip_address, created_at FROM email_login_tokens
+WHERE user_id = $1 AND used_at IS NULL AND expires_at > NOW()
+ORDER BY created_at DESC
+LIMIT 1
+`
+
+// The code a user types belongs to the last login requested.
+func (q *Queries) GetLatestEmailLoginToken(ctx context.Context, userID int32) (EmailLoginToken, error) {
+	row := q.db.QueryRow(ctx, getLatestEmailLoginToken, userID)
+	var i EmailLoginToken
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.TokenHash,
+		&i.CodeHash,
+		&i.Attempts,
+		&i.ExpiresAt,
+		&i.UsedAt,
+		&i.IpAddress,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const incrementEmailLoginAttempts = `-- name: IncrementEmailLoginAttempts :one
+UPDATE email_login_tokens
+SET attempts = attempts + 1
+WHERE id = $1
+RETURNING attempts
+`
+
+func (q *Queries) IncrementEmailLoginAttempts(ctx context.Context, id int32) (int32, error) {
+	row := q.db.QueryRow(ctx, incrementEmailLoginAttempts, id)
+	var attempts int32
+	err := row.Scan(&attempts)
+	return attempts, err
+}
+
+const invalidateUserEmailLoginTokens = `-- name: InvalidateUserEmailLoginTokens :exec
+UPDATE email_login_tokens
+SET used_at = NOW()
+WHERE user_id = $1 AND used_at IS NULL
+`
+
+func (q *Queries) InvalidateUserEmailLoginTokens(ctx context.Context, userID int32) error {
+	_, err := q.db.Exec(ctx, invalidateUserEmailLoginTokens, userID)
+	return err
+}
+
+const useEmailLoginToken = `-- name: UseEmailLoginToken :execrows
+UPDATE email_login_tokens
+SET used_at = NOW()
+WHERE id = $1 AND used_at IS NULL
+`
+
+func (q *Queries) UseEmailLoginToken(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.Exec(ctx, useEmailLoginToken, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
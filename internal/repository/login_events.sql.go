@@ -0,0 +1,145 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.20.0
+// source: login_events.sql
+
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const countLoginEvents = `-- name: CountLoginEvents :one
+SELECT COUNT(*) FROM login_events
+WHERE ($1::int IS NULL OR user_id = $1)
+  AND ($2::text IS NULL OR username = $2)
+  AND ($3::text IS NULL OR method = $3)
+  AND ($4::text IS NULL OR outcome = $4)
+  AND ($5::text IS NULL OR ip_address = $5)
+  AND ($6::timestamptz IS NULL OR created_at >= $6)
+  AND ($7::timestamptz IS NULL OR created_at < $7)
+`
+
+type CountLoginEventsParams struct {
+	UserID    pgtype.Int4        `json:"user_id"`
+	Username  pgtype.Text        `json:"username"`
+	Method    pgtype.Text        `json:"method"`
+	Outcome   pgtype.Text        `json:"outcome"`
+	IpAddress pgtype.Text        `json:"ip_address"`
+	Since     pgtype.Timestamptz `json:"since"`
+	Until     pgtype.Timestamptz `json:"until"`
+}
+
+func (q *Queries) CountLoginEvents(ctx context.Context, arg CountLoginEventsParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countLoginEvents,
+		arg.UserID,
+		arg.Username,
+		arg.Method,
+		arg.Outcome,
+		arg.IpAddress,
+		arg.Since,
+		arg.Until,
+	)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createLoginEvent = `-- name: CreateLoginEvent :exec
+INSERT INTO login_events (
+    user_id, username, method, outcome, failure_reason, ip_address, user_agent
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7
+)
+`
+
+type CreateLoginEventParams struct {
+	UserID        pgtype.Int4 `json:"user_id"`
+	Username      pgtype.Text `json:"username"`
+	Method        string      `json:"method"`
+	Outcome       string      `json:"outcome"`
+	FailureReason pgtype.Text `json:"failure_reason"`
+	IpAddress     pgtype.Text `json:"ip_address"`
+	UserAgent     pgtype.Text `json:"user_agent"`
+}
+
+func (q *Queries) CreateLoginEvent(ctx context.Context, arg CreateLoginEventParams) error {
+	_, err := q.db.Exec(ctx, createLoginEvent,
+		arg.UserID,
+		arg.Username,
+		arg.Method,
+		arg.Outcome,
+		arg.FailureReason,
+		arg.IpAddress,
+		arg.UserAgent,
+	)
+	return err
+}
+
+const listLoginEvents = `-- name: ListLoginEvents :many
+SELECT id, user_id, username, method, outcome, ip_address, user_agent, created_at, failure_reason FROM login_events
+WHERE ($1::int IS NULL OR user_id = $1)
+  AND ($2::text IS NULL OR username = $2)
+  AND ($3::text IS NULL OR method = $3)
+  AND ($4::text IS NULL OR outcome = $4)
+  AND ($5::text IS NULL OR ip_address = $5)
+  AND ($6::timestamptz IS NULL OR created_at >= $6)
+  AND ($7::timestamptz IS NULL OR created_at < $7)
+ORDER BY created_at DESC, id DESC
+LIMIT $9 OFFSET $8
+`
+
+type ListLoginEventsParams struct {
+	UserID     pgtype.Int4        `json:"user_id"`
+	Username   pgtype.Text        `json:"username"`
+	Method     pgtype.Text        `json:"method"`
+	Outcome    pgtype.Text        `json:"outcome"`
+	IpAddress  pgtype.Text        `json:"ip_address"`
+	Since      pgtype.Timestamptz `json:"since"`
+	Until      pgtype.Timestamptz `json:"until"`
+	PageOffset int32              `json:"page_offset"`
+	PageLimit  int32              `json:"page_limit"`
+}
+
+// Every filter is optional: NULL matches all.
+func (q *Queries) ListLoginEvents(ctx context.Context, arg ListLoginEventsParams) ([]LoginEvent, error) {
+	rows, err := q.db.Query(ctx, listLoginEvents,
+		arg.UserID,
+		arg.Username,
+		arg.Method,
+		arg.Outcome,
+		arg.IpAddress,
+		arg.Since,
+		arg.Until,
+		arg.PageOffset,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []LoginEvent
+	for rows.Next() {
+		var i LoginEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Username,
+			&i.Method,
+			&i.Outcome,
+			&i.IpAddress,
+			&i.UserAgent,
+			&i.CreatedAt,
+			&i.FailureReason,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,275 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.20.0
+// source: mfa.sql
+
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const confirmUserTOTP = `-- name: ConfirmUserTOTP :execrows
+UPDATE user_totp
+SET confirmed_at = NOW(), last_used_step = $2
+WHERE user_id = $1 AND confirmed_at IS NULL
+`
+
+type ConfirmUserTOTPParams struct {
+	UserID       int32       `json:"user_id"`
+	LastUsedStep pgtype.Int8 `json:"last_used_step"`
+}
+
+func (q *Queries) ConfirmUserTOTP(ctx context.Context, arg ConfirmUserTOTPParams) (int64, error) {
+	result, err := q.db.Exec(ctx, confirmUserTOTP, arg.UserID, arg.LastUsedStep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const countUnusedRecoveryCodes = `-- name: CountUnusedRecoveryCodes :one
+SELECT COUNT(*) FROM mfa_recovery_codes
+WHERE user_id = $1 AND used_at IS NULL
+`
+
+func (q *Queries) CountUnusedRecoveryCodes(ctx context.Context, userID int32) (int64, error) {
+	row := q.db.QueryRow(ctx, countUnusedRecoveryCodes, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createMFAChallenge = `-- name: CreateMFAChallenge :one
+INSERT INTO mfa_challenges (
+    user_id, token_hash, expires_at, ip_address
+) VALUES (
+    $1, $2, $3, $4
+)
+RETURNING id, user_id, token_hash, attempts, expires_at, used_at, ip_address, created_at
+`
+
+type CreateMFAChallengeParams struct {
+	UserID    int32              `json:"user_id"`
+	TokenHash string             `json:"token_hash"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+	IpAddress pgtype.Text        `json:"ip_address"`
+}
+
+func (q *Queries) CreateMFAChallenge(ctx context.Context, arg CreateMFAChallengeParams) (MfaChallenge, error) {
+	row := q.db.QueryRow(ctx, createMFAChallenge,
+		arg.UserID,
+		arg.TokenHash,
+		arg.ExpiresAt,
+		arg.IpAddress,
+	)
+	var i MfaChallenge
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.TokenHash,
+		&i.Attempts,
+		&i.ExpiresAt,
+		&i.UsedAt,
+		&i.IpAddress,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createRecoveryCode = `-- name: CreateRecoveryCode :exec
+INSERT INTO mfa_recovery_codes (
+    user_id, code_hash
+) VALUES (
+    $1, $2
+)
+`
+
+type CreateRecoveryCodeParams struct {
+	UserID   int32  `json:"user_id"`
+	CodeHash string `json:"code_hash"`
+}
+
+func (q *Queries) CreateRecoveryCode(ctx context.Context, arg CreateRecoveryCodeParams) error {
+	_, err := q.db.Exec(ctx, createRecoveryCode, arg.UserID, arg.CodeHash)
+	return err
+}
+
+const deleteExpiredMFAChallenges = `-- name: DeleteExpiredMFAChallenges :execrows
+DELETE FROM mfa_challenges
+WHERE expires_at < NOW()
+`
+
+func (q *Queries) DeleteExpiredMFAChallenges(ctx context.Context) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredMFAChallenges)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteUserMFAChallenges = `-- name: DeleteUserMFAChallenges :exec
+DELETE FROM mfa_challenges WHERE user_id = $1
+`
+
+func (q *Queries) DeleteUserMFAChallenges(ctx context.Context, userID int32) error {
+	_, err := q.db.Exec(ctx, deleteUserMFAChallenges, userID)
+	return err
+}
+
+const deleteUserRecoveryCodes = `-- name: DeleteUserRecoveryCodes :exec
+DELETE FROM mfa_recovery_codes WHERE user_id = $1
+`
+
+func (q *Queries) DeleteUserRecoveryCodes(ctx context.Context, userID int32) error {
+	_, err := q.db.Exec(ctx, deleteUserRecoveryCodes, userID)
+	return err
+}
+
+const deleteUserTOTP = `-- name: DeleteUserTOTP :exec
+DELETE FROM user_totp WHERE user_id = $1
+`
+
+func (q *Queries) DeleteUserTOTP(ctx context.Context, userID int32) error {
+	_, err := q.db.Exec(ctx, deleteUserTOTP, userID)
+	return err
+}
+
+const getMFAChallenge = `-- name: GetMFAChallenge :one
+SELECT id, user_id, token_hash, attempts, expires_at, used_at, ip_address, created_at FROM mfa_challenges
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+LIMIT 1
+`
+
+func (q *Queries) GetMFAChallenge(ctx context.Context, tokenHash string) (MfaChallenge, error) {
+	row := q.db.QueryRow(ctx, getMFAChallenge, tokenHash)
+	var i MfaChallenge
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.TokenHash,
+		&i.Attempts,
+		&i.ExpiresAt,
+		&i.UsedAt,
+		&i.IpAddress,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getUserTOTP = `-- name: GetUserTOTP :one
+SELECT user_id, secret, confirmed_at, last_used_step, created_at FROM user_totp
+WHERE user_id = $1 LIMIT 1
+`
+
+func (q *Queries) GetUserTOTP(ctx context.Context, userID int32) (UserTotp, error) {
+	row := q.db.QueryRow(ctx, getUserTOTP, userID)
+	var i UserTotp
+	err := row.Scan(
+		&i.UserID,
+		&i.Secret,
+		&i.ConfirmedAt,
+		&i.LastUsedStep,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const incrementMFAChallengeAttempts = `-- name: IncrementMFAChallengeAttempts :one
+UPDATE mfa_challenges
+SET attempts = attempts + 1
+WHERE id = $1
+RETURNING attempts
+`
+
+func (q *Queries) IncrementMFAChallengeAttempts(ctx context.Context, id int32) (int32, error) {
+	row := q.db.QueryRow(ctx, incrementMFAChallengeAttempts, id)
+	var attempts int32
+	err := row.Scan(&attempts)
+	return attempts, err
+}
+
+const upsertPendingUserTOTP = `-- name: UpsertPendingUserTOTP :one
+INSERT INTO user_totp (
+    user_id, secret
+) VALUES (
+    $1, $2
+)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, last_used_step = NULL, created_at = NOW()
+WHERE user_totp.confirmed_at IS NULL
+RETURNING user_id, secret, confirmed_at, last_used_step, created_at
+`
+
+type UpsertPendingUserTOTPParams struct {
+	UserID int32  `json:"user_id"`
+	Secret string `json:"secret"`
+}
+
+// Starts (or restarts) an enrolment. Returns no row when a confirmed factor exists.
+func (q *Queries) UpsertPendingUserTOTP(ctx context.Context, arg UpsertPendingUserTOTPParams) (UserTotp, error) {
+	row := q.db.QueryRow(ctx, upsertPendingUserTOTP, arg.UserID, arg.Secret)
+	var i UserTotp
+	err := row.Scan(
+		&i.UserID,
+		&i.Secret,
+		&i.ConfirmedAt,
+		&i.LastUsedStep,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const useMFAChallenge = `-- name: UseMFAChallenge :execrows
+UPDATE mfa_challenges
+SET used_at = NOW()
+WHERE id = $1 AND used_at IS NULL
+`
+
+func (q *Queries) UseMFAChallenge(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.Exec(ctx, useMFAChallenge, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const useRecoveryCode = `-- name: UseRecoveryCode :execrows
+UPDATE mfa_recovery_codes
+SET used_at = NOW()
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+`
+
+type UseRecoveryCodeParams struct {
+	UserID   int32  `json:"user_id"`
+	CodeHash string `json:"code_hash"`
+}
+
+func (q *Queries) UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (int64, error) {
+	result, err := q.db.Exec(ctx, useRecoveryCode, arg.UserID, arg.CodeHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const useUserTOTPStep = `-- name: UseUserTOTPStep :execrows
+UPDATE user_totp
+SET last_used_step = $2
+WHERE user_id = $1 AND (last_used_step IS NULL OR last_used_step < $2)
+`
+
+type UseUserTOTPStepParams struct {
+	UserID       int32       `json:"user_id"`
+	LastUsedStep pgtype.Int8 `json:"last_used_step"`
+}
+
+func (q *Queries) UseUserTOTPStep(ctx context.Context, arg UseUserTOTPStepParams) (int64, error) {
+	result, err := q.db.Exec(ctx, useUserTOTPStep, arg.UserID, arg.LastUsedStep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -8,6 +8,77 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type EmailLoginToken struct {
+	ID        int32              `json:"id"`
+	UserID    int32              `json:"user_id"`
+	TokenHash string             `json:"token_hash"`
+	CodeHash  string             `json:"code_hash"`
+	Attempts  int32              `json:"attempts"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+	UsedAt    pgtype.Timestamptz `json:"used_at"`
+	IpAddress pgtype.Text        `json:"ip_address"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+type LoginEvent struct {
+	ID            int64              `json:"id"`
+	UserID        pgtype.Int4        `json:"user_id"`
+	Username      pgtype.Text        `json:"username"`
+	Method        string             `json:"method"`
+	Outcome       string             `json:"outcome"`
+	IpAddress     pgtype.Text        `json:"ip_address"`
+	UserAgent     pgtype.Text        `json:"user_agent"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+	FailureReason pgtype.Text        `json:"failure_reason"`
+}
+
+type MfaChallenge struct {
+	ID        int32              `json:"id"`
+	UserID    int32              `json:"user_id"`
+	TokenHash string             `json:"token_hash"`
+	Attempts  int32              `json:"attempts"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+	UsedAt    pgtype.Timestamptz `json:"used_at"`
+	IpAddress pgtype.Text        `json:"ip_address"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+type MfaRecoveryCode struct {
+	ID        int32              `json:"id"`
+	UserID    int32              `json:"user_id"`
+	CodeHash  string             `json:"code_hash"`
+	UsedAt    pgtype.Timestamptz `json:"used_at"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+type OidcLoginState struct {
+	ID           int32              `json:"id"`
+	StateHash    string             `json:"state_hash"`
+	Provider     string             `json:"provider"`
+	Nonce        string             `json:"nonce"`
+	CodeVerifier string             `json:"code_verifier"`
+	ReturnTo     string             `json:"return_to"`
+	ExpiresAt    pgtype.Timestamptz `json:"expires_at"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+}
+
+type PasswordHistory struct {
+	ID           int32              `json:"id"`
+	UserID       int32              `json:"user_id"`
+	PasswordHash string             `json:"password_hash"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+}
+
+type PasswordResetToken struct {
+	ID        int32              `json:"id"`
+	UserID    int32              `json:"user_id"`
+	TokenHash string             `json:"token_hash"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+	UsedAt    pgtype.Timestamptz `json:"used_at"`
+	IpAddress pgtype.Text        `json:"ip_address"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
 type Permission struct {
 	ID        int32              `json:"id"`
 	Module    string             `json:"module"`
@@ -18,24 +89,40 @@ type Permission struct {
 }
 
 type RefreshToken struct {
-	ID        int32              `json:"id"`
+	ID               int32              `json:"id"`
+	UserID           int32              `json:"user_id"`
+	ExpiresAt        pgtype.Timestamptz `json:"expires_at"`
+	CreatedAt        pgtype.Timestamptz `json:"created_at"`
+	RevokedAt        pgtype.Timestamptz `json:"revoked_at"`
+	FamilyID         pgtype.UUID        `json:"family_id"`
+	ReplacedBy       pgtype.Int4        `json:"replaced_by"`
+	TokenHash        string             `json:"token_hash"`
+	UserAgent        pgtype.Text        `json:"user_agent"`
+	IpAddress        pgtype.Text        `json:"ip_address"`
+	ClientName       pgtype.Text        `json:"client_name"`
+	SessionStartedAt pgtype.Timestamptz `json:"session_started_at"`
+}
+
+type RevokedAccessToken struct {
+	Jti       string             `json:"jti"`
 	UserID    int32              `json:"user_id"`
-	Token     string             `json:"token"`
 	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
-	CreatedAt pgtype.Timestamptz `json:"created_at"`
 	RevokedAt pgtype.Timestamptz `json:"revoked_at"`
 }
 
 type Role struct {
-	ID          int32              `json:"id"`
-	Code        string             `json:"code"`
-	Name        string             `json:"name"`
-	Description pgtype.Text        `json:"description"`
-	Level       pgtype.Int4        `json:"level"`
-	IsSystem    pgtype.Bool        `json:"is_system"`
-	Status      pgtype.Text        `json:"status"`
-	CreatedAt   pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt   pgtype.Timestamptz `json:"updated_at"`
+	ID                     int32              `json:"id"`
+	Code                   string             `json:"code"`
+	Name                   string             `json:"name"`
+	Description            pgtype.Text        `json:"description"`
+	Level                  pgtype.Int4        `json:"level"`
+	IsSystem               pgtype.Bool        `json:"is_system"`
+	Status                 pgtype.Text        `json:"status"`
+	CreatedAt              pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt              pgtype.Timestamptz `json:"updated_at"`
+	AccessTokenTtlSeconds  pgtype.Int4        `json:"access_token_ttl_seconds"`
+	RefreshTokenTtlSeconds pgtype.Int4        `json:"refresh_token_ttl_seconds"`
+	RequireMfa             bool               `json:"require_mfa"`
 }
 
 type RolePermission struct {
@@ -46,21 +133,88 @@ type RolePermission struct {
 	CreatedAt    pgtype.Timestamptz `json:"created_at"`
 }
 
+type SamlRequest struct {
+	ID             int32              `json:"id"`
+	RelayStateHash string             `json:"relay_state_hash"`
+	Provider       string             `json:"provider"`
+	RequestID      string             `json:"request_id"`
+	ReturnTo       string             `json:"return_to"`
+	ExpiresAt      pgtype.Timestamptz `json:"expires_at"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	LinkUserID     pgtype.Int4        `json:"link_user_id"`
+}
+
+type SigningKey struct {
+	ID          int32              `json:"id"`
+	Kid         string             `json:"kid"`
+	Algorithm   string             `json:"algorithm"`
+	PrivateKey  string             `json:"private_key"`
+	State       string             `json:"state"`
+	ActivatedAt pgtype.Timestamptz `json:"activated_at"`
+	RetireAt    pgtype.Timestamptz `json:"retire_at"`
+	RetiredAt   pgtype.Timestamptz `json:"retired_at"`
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+}
+
 type User struct {
-	ID            int32              `json:"id"`
-	Username      string             `json:"username"`
-	PasswordHash  pgtype.Text        `json:"password_hash"`
-	ExternalLogin pgtype.Bool        `json:"external_login"`
-	EmployeeID    pgtype.Int4        `json:"employee_id"`
-	RoleID        pgtype.Int4        `json:"role_id"`
-	FullName      string             `json:"full_name"`
-	Email         pgtype.Text        `json:"email"`
-	Phone         pgtype.Text        `json:"phone"`
-	Avatar        pgtype.Text        `json:"avatar"`
-	Status        pgtype.Text        `json:"status"`
-	LastLoginIp   pgtype.Text        `json:"last_login_ip"`
-	LastLoginAt   pgtype.Timestamptz `json:"last_login_at"`
-	CreatedAt     pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt     pgtype.Timestamptz `json:"updated_at"`
-	DeletedAt     pgtype.Timestamptz `json:"deleted_at"`
+	ID                  int32              `json:"id"`
+	Username            string             `json:"username"`
+	PasswordHash        pgtype.Text        `json:"password_hash"`
+	ExternalLogin       pgtype.Bool        `json:"external_login"`
+	EmployeeID          pgtype.Int4        `json:"employee_id"`
+	RoleID              pgtype.Int4        `json:"role_id"`
+	FullName            string             `json:"full_name"`
+	Email               pgtype.Text        `json:"email"`
+	Phone               pgtype.Text        `json:"phone"`
+	Avatar              pgtype.Text        `json:"avatar"`
+	Status              pgtype.Text        `json:"status"`
+	LastLoginIp         pgtype.Text        `json:"last_login_ip"`
+	LastLoginAt         pgtype.Timestamptz `json:"last_login_at"`
+	CreatedAt           pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt           pgtype.Timestamptz `json:"updated_at"`
+	DeletedAt           pgtype.Timestamptz `json:"deleted_at"`
+	FailedLoginAttempts int32              `json:"failed_login_attempts"`
+	LockedUntil         pgtype.Timestamptz `json:"locked_until"`
+	LockoutCount        int32              `json:"lockout_count"`
+	MustChangePassword  bool               `json:"must_change_password"`
+	PasswordChangedAt   pgtype.Timestamptz `json:"password_changed_at"`
+	AuthSource          string             `json:"auth_source"`
+}
+
+type UserIdentity struct {
+	ID          int32              `json:"id"`
+	UserID      int32              `json:"user_id"`
+	Provider    string             `json:"provider"`
+	Subject     string             `json:"subject"`
+	Email       pgtype.Text        `json:"email"`
+	LastLoginAt pgtype.Timestamptz `json:"last_login_at"`
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+}
+
+type UserTotp struct {
+	UserID       int32              `json:"user_id"`
+	Secret       string             `json:"secret"`
+	ConfirmedAt  pgtype.Timestamptz `json:"confirmed_at"`
+	LastUsedStep pgtype.Int8        `json:"last_used_step"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+}
+
+type WebauthnCredential struct {
+	ID           int32              `json:"id"`
+	UserID       int32              `json:"user_id"`
+	CredentialID []byte             `json:"credential_id"`
+	Name         string             `json:"name"`
+	Credential   []byte             `json:"credential"`
+	LastUsedAt   pgtype.Timestamptz `json:"last_used_at"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+}
+
+type WebauthnSession struct {
+	ID          int32              `json:"id"`
+	TokenHash   string             `json:"token_hash"`
+	UserID      pgtype.Int4        `json:"user_id"`
+	Ceremony    string             `json:"ceremony"`
+	SessionData []byte             `json:"session_data"`
+	ExpiresAt   pgtype.Timestamptz `json:"expires_at"`
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
 }
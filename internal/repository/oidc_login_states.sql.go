@@ -0,0 +1,82 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.20.0
+// source: oidc_login_states.sql
+
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const createOIDCLoginState = `-- name: CreateOIDCLoginState :exec
+INSERT INTO oidc_login_states (
+    state_hash, provider, nonce, code_verifier, return_to, expires_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6
+)
+`
+
+type CreateOIDCLoginStateParams struct {
+	StateHash    string             `json:"state_hash"`
+	Provider     string             `json:"provider"`
+	Nonce        string             `json:"nonce"`
+	CodeVerifier string             `json:"code_verifier"`
+	ReturnTo     string             `json:"return_to"`
+	ExpiresAt    pgtype.Timestamptz `json:"expires_at"`
+}
+
+func (q *Queries) CreateOIDCLoginState(ctx context.Context, arg CreateOIDCLoginStateParams) error {
+	_, err := q.db.Exec(ctx, createOIDCLoginState,
+		arg.StateHash,
+		arg.Provider,
+		arg.Nonce,
+		arg.CodeVerifier,
+		arg.ReturnTo,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const deleteExpiredOIDCLoginStates = `-- name: DeleteExpiredOIDCLoginStates :execrows
+DELETE FROM oidc_login_states
+WHERE expires_at < NOW()
+`
+
+func (q *Queries) DeleteExpiredOIDCLoginStates(ctx context.Context) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredOIDCLoginStates)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const takeOIDCLoginState = `-- name: TakeOIDCLoginState :one
+DELETE FROM oidc_login_states
+WHERE state_hash = $1 AND provider = $2
+RETURNING id, state_hash, provider, nonce, code_verifier, return_to, expires_at, created_at
+`
+
+type TakeOIDCLoginStateParams struct {
+	StateHash string `json:"state_hash"`
+	Provider  string `json:"provider"`
+}
+
+// A state answers one callback only.
+func (q *Queries) TakeOIDCLoginState(ctx context.Context, arg TakeOIDCLoginStateParams) (OidcLoginState, error) {
+	row := q.db.QueryRow(ctx, takeOIDCLoginState, arg.StateHash, arg.Provider)
+	var i OidcLoginState
+	err := row.Scan(
+		&i.ID,
+		&i.StateHash,
+		&i.Provider,
+		&i.Nonce,
+		&i.CodeVerifier,
+		&i.ReturnTo,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
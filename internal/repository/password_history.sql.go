@@ -0,0 +1,85 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.20.0
+// source: password_history.sql
+
+package repository
+
+import (
+	"context"
+)
+
+const createPasswordHistory = `-- name: CreatePasswordHistory :exec
+INSERT INTO password_history (
+    user_id, password_hash
+) VALUES (
+    $1, $2
+)
+`
+
+type CreatePasswordHistoryParams struct {
+	UserID       int32  `json:"user_id"`
+	PasswordHash string `json:"password_hash"`
+}
+
+func (q *Queries) CreatePasswordHistory(ctx context.Context, arg CreatePasswordHistoryParams) error {
+	_, err := q.db.Exec(ctx, createPasswordHistory, arg.UserID, arg.PasswordHash)
+	return err
+}
+
+const listPasswordHistory = `-- name: ListPasswordHistory :many
+SELECT id, user_id, password_hash, created_at FROM password_history
+WHERE user_id = $1
+ORDER BY id DESC
+LIMIT $2
+`
+
+type ListPasswordHistoryParams struct {
+	UserID int32 `json:"user_id"`
+	Limit  int32 `json:"limit"`
+}
+
+func (q *Queries) ListPasswordHistory(ctx context.Context, arg ListPasswordHistoryParams) ([]PasswordHistory, error) {
+	rows, err := q.db.Query(ctx, listPasswordHistory, arg.UserID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PasswordHistory
+	for rows.Next() {
+		var i PasswordHistory
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.PasswordHash,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const prunePasswordHistory = `-- name: PrunePasswordHistory :exec
+DELETE FROM password_history ph
+WHERE ph.user_id = $1 AND ph.id NOT IN (
+    SELECT recent.id FROM password_history recent
+    WHERE recent.user_id = $1
+    ORDER BY recent.id DESC
+    LIMIT $2
+)
+`
+
+type PrunePasswordHistoryParams struct {
+	UserID int32 `json:"user_id"`
+	Limit  int32 `json:"limit"`
+}
+
+func (q *Queries) PrunePasswordHistory(ctx context.Context, arg PrunePasswordHistoryParams) error {
+	_, err := q.db.Exec(ctx, prunePasswordHistory, arg.UserID, arg.Limit)
+	return err
+}
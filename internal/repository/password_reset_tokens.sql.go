@@ -0,0 +1,107 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.20.0
+// source: password_reset_tokens.sql
+
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const createPasswordResetToken = `-- name: CreatePasswordResetToken :one
+INSERT INTO password_reset_tokens (
+    user_id, token_hash, expires_at, ip_address
+) VALUES (
+    $1, $2, $3, $4
+)
+RETURNING id, user_id, token_hash, expires_at, used_at, ip_address, created_at
+`
+
+type CreatePasswordResetTokenParams struct {
+	UserID    int32              `json:"user_id"`
+	TokenHash string             `json:"token_hash"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+	IpAddress pgtype.Text        `json:"ip_address"`
+}
+
+func (q *Queries) CreatePasswordResetToken(ctx context.Context, arg CreatePasswordResetTokenParams) (PasswordResetToken, error) {
+	row := q.db.QueryRow(ctx, createPasswordResetToken,
+		arg.UserID,
+		arg.TokenHash,
+		arg.ExpiresAt,
+		arg.IpAddress,
+	)
+	var i PasswordResetToken
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.TokenHash,
+		&i.ExpiresAt,
+		&i.UsedAt,
+		&i.IpAddress,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteExpiredPasswordResetTokens = `-- name: DeleteExpiredPasswordResetTokens :execrows
+DELETE FROM password_reset_tokens
+WHERE expires_at < NOW()
+`
+
+func (q *Queries) DeleteExpiredPasswordResetTokens(ctx context.Context) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredPasswordResetTokens)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const getPasswordResetToken = `-- name: GetPasswordResetToken :one
+SELECT id, user_id, token_hash, expires_at, used_at, ip_address, created_at FROM password_reset_tokens
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+LIMIT 1
+`
+
+func (q *Queries) GetPasswordResetToken(ctx context.Context, tokenHash string) (PasswordResetToken, error) {
+	row := q.db.QueryRow(ctx, getPasswordResetToken, tokenHash)
+	var i PasswordResetToken
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.TokenHash,
+		&i.ExpiresAt,
+		&i.UsedAt,
+		&i.IpAddress,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const invalidateUserPasswordResetTokens = `-- name: InvalidateUserPasswordResetTokens :exec
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE user_id = $1 AND used_at IS NULL
+`
+
+func (q *Queries) InvalidateUserPasswordResetTokens(ctx context.Context, userID int32) error {
+	_, err := q.db.Exec(ctx, invalidateUserPasswordResetTokens, userID)
+	return err
+}
+
+const usePasswordResetToken = `-- name: UsePasswordResetToken :execrows
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE id = $1 AND used_at IS NULL
+`
+
+func (q *Queries) UsePasswordResetToken(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.Exec(ctx, usePasswordResetToken, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
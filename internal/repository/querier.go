@@ -11,32 +11,118 @@ import (
 )
 
 type Querier interface {
+	ActivateSigningKey(ctx context.Context, id int32) error
 	AssignEmployeeId(ctx context.Context, arg AssignEmployeeIdParams) error
 	AssignPermissionToRole(ctx context.Context, arg AssignPermissionToRoleParams) (RolePermission, error)
+	ConfirmUserTOTP(ctx context.Context, arg ConfirmUserTOTPParams) (int64, error)
+	CountLoginEvents(ctx context.Context, arg CountLoginEventsParams) (int64, error)
+	CountUnusedRecoveryCodes(ctx context.Context, userID int32) (int64, error)
+	CountUserIdentities(ctx context.Context, userID int32) (int64, error)
+	CountUserWebAuthnCredentials(ctx context.Context, userID int32) (int64, error)
+	CreateEmailLoginToken(ctx context.Context, arg CreateEmailLoginTokenParams) error
+	CreateLoginEvent(ctx context.Context, arg CreateLoginEventParams) error
+	CreateMFAChallenge(ctx context.Context, arg CreateMFAChallengeParams) (MfaChallenge, error)
+	CreateOIDCLoginState(ctx context.Context, arg CreateOIDCLoginStateParams) error
+	CreatePasswordHistory(ctx context.Context, arg CreatePasswordHistoryParams) error
+	CreatePasswordResetToken(ctx context.Context, arg CreatePasswordResetTokenParams) (PasswordResetToken, error)
+	CreateRecoveryCode(ctx context.Context, arg CreateRecoveryCodeParams) error
 	CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error)
 	CreateRole(ctx context.Context, arg CreateRoleParams) (Role, error)
+	CreateSAMLRequest(ctx context.Context, arg CreateSAMLRequestParams) error
+	CreateSigningKey(ctx context.Context, arg CreateSigningKeyParams) (SigningKey, error)
 	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
+	CreateUserIdentity(ctx context.Context, arg CreateUserIdentityParams) (UserIdentity, error)
+	CreateWebAuthnCredential(ctx context.Context, arg CreateWebAuthnCredentialParams) (WebauthnCredential, error)
+	CreateWebAuthnSession(ctx context.Context, arg CreateWebAuthnSessionParams) error
+	DeleteExpiredEmailLoginTokens(ctx context.Context) (int64, error)
+	DeleteExpiredMFAChallenges(ctx context.Context) (int64, error)
+	DeleteExpiredOIDCLoginStates(ctx context.Context) (int64, error)
+	DeleteExpiredPasswordResetTokens(ctx context.Context) (int64, error)
+	DeleteExpiredRevokedAccessTokens(ctx context.Context) (int64, error)
+	DeleteExpiredSAMLRequests(ctx context.Context) (int64, error)
+	DeleteExpiredWebAuthnSessions(ctx context.Context) (int64, error)
 	DeleteRole(ctx context.Context, id int32) error
 	DeleteUser(ctx context.Context, id int32) error
-	GetRefreshToken(ctx context.Context, token string) (RefreshToken, error)
+	DeleteUserIdentity(ctx context.Context, arg DeleteUserIdentityParams) (int64, error)
+	DeleteUserMFAChallenges(ctx context.Context, userID int32) error
+	DeleteUserRecoveryCodes(ctx context.Context, userID int32) error
+	DeleteUserTOTP(ctx context.Context, userID int32) error
+	DeleteUserWebAuthnCredentials(ctx context.Context, userID int32) error
+	DeleteWebAuthnCredential(ctx context.Context, arg DeleteWebAuthnCredentialParams) (int64, error)
+	// Unlike GetRefreshToken this also returns revoked tokens, for reuse detection.
+	FindRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error)
+	GetEmailLoginTokenByHash(ctx context.Context, tokenHash string) (EmailLoginToken, error)
+	// The code a user types belongs to the last login requested.
+	GetLatestEmailLoginToken(ctx context.Context, userID int32) (EmailLoginToken, error)
+	GetMFAChallenge(ctx context.Context, tokenHash string) (MfaChallenge, error)
+	GetPasswordResetToken(ctx context.Context, tokenHash string) (PasswordResetToken, error)
+	GetRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error)
 	GetRoleByCode(ctx context.Context, code string) (Role, error)
 	GetRoleById(ctx context.Context, id int32) (Role, error)
 	GetRolePermissions(ctx context.Context, roleID int32) ([]GetRolePermissionsRow, error)
 	GetUserByEmail(ctx context.Context, email pgtype.Text) (User, error)
 	GetUserById(ctx context.Context, id int32) (User, error)
 	GetUserByUsername(ctx context.Context, username string) (User, error)
+	GetUserIdentity(ctx context.Context, arg GetUserIdentityParams) (UserIdentity, error)
 	GetUserPermissions(ctx context.Context, id int32) ([]GetUserPermissionsRow, error)
+	GetUserTOTP(ctx context.Context, userID int32) (UserTotp, error)
+	IncrementEmailLoginAttempts(ctx context.Context, id int32) (int32, error)
+	IncrementMFAChallengeAttempts(ctx context.Context, id int32) (int32, error)
+	InvalidateUserEmailLoginTokens(ctx context.Context, userID int32) error
+	InvalidateUserPasswordResetTokens(ctx context.Context, userID int32) error
+	IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+	// Every filter is optional: NULL matches all.
+	ListLoginEvents(ctx context.Context, arg ListLoginEventsParams) ([]LoginEvent, error)
+	ListPasswordHistory(ctx context.Context, arg ListPasswordHistoryParams) ([]PasswordHistory, error)
 	ListPermissions(ctx context.Context) ([]Permission, error)
+	ListPublishedSigningKeys(ctx context.Context) ([]SigningKey, error)
 	ListRolePermissions(ctx context.Context, roleID int32) ([]ListRolePermissionsRow, error)
 	ListRoles(ctx context.Context) ([]Role, error)
+	ListSigningKeys(ctx context.Context) ([]SigningKey, error)
+	ListUserIdentities(ctx context.Context, userID int32) ([]UserIdentity, error)
+	// The live token of each family is the session.
+	ListUserSessions(ctx context.Context, userID int32) ([]RefreshToken, error)
+	ListUserWebAuthnCredentials(ctx context.Context, userID int32) ([]WebauthnCredential, error)
 	ListUsers(ctx context.Context) ([]ListUsersRow, error)
+	LockSigningKeys(ctx context.Context) error
+	LockUser(ctx context.Context, arg LockUserParams) error
+	PrunePasswordHistory(ctx context.Context, arg PrunePasswordHistoryParams) error
+	RegisterFailedLogin(ctx context.Context, id int32) (RegisterFailedLoginRow, error)
+	RehashUserPassword(ctx context.Context, arg RehashUserPasswordParams) (int64, error)
 	RemovePermissionFromRole(ctx context.Context, arg RemovePermissionFromRoleParams) error
-	RevokeRefreshToken(ctx context.Context, token string) error
+	ResetFailedLogins(ctx context.Context, id int32) error
+	RetireActiveSigningKeys(ctx context.Context, retireAt pgtype.Timestamptz) error
+	RetireExpiredSigningKeys(ctx context.Context) (int64, error)
+	RevokeAccessToken(ctx context.Context, arg RevokeAccessTokenParams) error
+	RevokeRefreshToken(ctx context.Context, tokenHash string) error
+	RevokeRefreshTokenFamily(ctx context.Context, familyID pgtype.UUID) error
 	RevokeUserRefreshTokens(ctx context.Context, userID int32) error
+	RevokeUserSession(ctx context.Context, arg RevokeUserSessionParams) (int64, error)
+	RotateRefreshToken(ctx context.Context, arg RotateRefreshTokenParams) (int64, error)
+	// A state answers one callback only.
+	TakeOIDCLoginState(ctx context.Context, arg TakeOIDCLoginStateParams) (OidcLoginState, error)
+	// A request is answered once, a replayed response finds nothing.
+	TakeSAMLRequest(ctx context.Context, arg TakeSAMLRequestParams) (SamlRequest, error)
+	// Sessions are single use: finishing a ceremony deletes its state.
+	TakeWebAuthnSession(ctx context.Context, arg TakeWebAuthnSessionParams) (WebauthnSession, error)
 	UpdateRole(ctx context.Context, arg UpdateRoleParams) (Role, error)
+	UpdateSigningKeyPrivateKey(ctx context.Context, arg UpdateSigningKeyPrivateKeyParams) error
 	UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error)
+	UpdateUserAuthSource(ctx context.Context, arg UpdateUserAuthSourceParams) error
 	UpdateUserExternalLogin(ctx context.Context, arg UpdateUserExternalLoginParams) error
+	UpdateUserIdentityLogin(ctx context.Context, arg UpdateUserIdentityLoginParams) error
 	UpdateUserLastLogin(ctx context.Context, arg UpdateUserLastLoginParams) error
+	UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error
+	UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) error
+	// Stores the sign counter and flags of the last assertion.
+	UpdateWebAuthnCredentialUsage(ctx context.Context, arg UpdateWebAuthnCredentialUsageParams) error
+	// Starts (or restarts) an enrolment. Returns no row when a confirmed factor exists.
+	UpsertPendingUserTOTP(ctx context.Context, arg UpsertPendingUserTOTPParams) (UserTotp, error)
+	UseEmailLoginToken(ctx context.Context, id int32) (int64, error)
+	UseMFAChallenge(ctx context.Context, id int32) (int64, error)
+	UsePasswordResetToken(ctx context.Context, id int32) (int64, error)
+	UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (int64, error)
+	UseUserTOTPStep(ctx context.Context, arg UseUserTOTPStepParams) (int64, error)
 }
 
 var _ Querier = (*Queries)(nil)
@@ -13,61 +13,165 @@ import (
 
 const createRefreshToken = `-- name: CreateRefreshToken :one
 INSERT INTO refresh_tokens (
-    user_id, token, expires_at
+    user_id, token_hash, expires_at, family_id, user_agent, ip_address, client_name, session_started_at
 ) VALUES (
-    $1, $2, $3
+    $1, $2, $3, $4, $5, $6, $7, $8
 )
-RETURNING id, user_id, token, expires_at, created_at, revoked_at
+RETURNING id, user_id, expires_at, created_at, revoked_at, family_id, replaced_by, token_hash, user_agent, ip_address, client_name, session_started_at
 `
 
 type CreateRefreshTokenParams struct {
-	UserID    int32              `json:"user_id"`
-	Token     string             `json:"token"`
-	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+	UserID           int32              `json:"user_id"`
+	TokenHash        string             `json:"token_hash"`
+	ExpiresAt        pgtype.Timestamptz `json:"expires_at"`
+	FamilyID         pgtype.UUID        `json:"family_id"`
+	UserAgent        pgtype.Text        `json:"user_agent"`
+	IpAddress        pgtype.Text        `json:"ip_address"`
+	ClientName       pgtype.Text        `json:"client_name"`
+	SessionStartedAt pgtype.Timestamptz `json:"session_started_at"`
 }
 
 func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error) {
-	row := q.db.QueryRow(ctx, createRefreshToken, arg.UserID, arg.Token, arg.ExpiresAt)
+	row := q.db.QueryRow(ctx, createRefreshToken,
+		arg.UserID,
+		arg.TokenHash,
+		arg.ExpiresAt,
+		arg.FamilyID,
+		arg.UserAgent,
+		arg.IpAddress,
+		arg.ClientName,
+		arg.SessionStartedAt,
+	)
 	var i RefreshToken
 	err := row.Scan(
 		&i.ID,
 		&i.UserID,
-		&i.Token,
 		&i.ExpiresAt,
 		&i.CreatedAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.ReplacedBy,
+		&i.TokenHash,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.ClientName,
+		&i.SessionStartedAt,
+	)
+	return i, err
+}
+
+const findRefreshToken = `-- name: FindRefreshToken :one
+SELECT id, user_id, expires_at, created_at, revoked_at, family_id, replaced_by, token_hash, user_agent, ip_address, client_name, session_started_at FROM refresh_tokens
+WHERE token_hash = $1
+LIMIT 1
+`
+
+// Unlike GetRefreshToken this also returns revoked tokens, for reuse detection.
+func (q *Queries) FindRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRow(ctx, findRefreshToken, tokenHash)
+	var i RefreshToken
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.RevokedAt,
+		&i.FamilyID,
+		&i.ReplacedBy,
+		&i.TokenHash,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.ClientName,
+		&i.SessionStartedAt,
 	)
 	return i, err
 }
 
 const getRefreshToken = `-- name: GetRefreshToken :one
-SELECT id, user_id, token, expires_at, created_at, revoked_at FROM refresh_tokens
-WHERE token = $1 AND revoked_at IS NULL AND expires_at > NOW()
+SELECT id, user_id, expires_at, created_at, revoked_at, family_id, replaced_by, token_hash, user_agent, ip_address, client_name, session_started_at FROM refresh_tokens
+WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > NOW()
 LIMIT 1
 `
 
-func (q *Queries) GetRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
-	row := q.db.QueryRow(ctx, getRefreshToken, token)
+func (q *Queries) GetRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRow(ctx, getRefreshToken, tokenHash)
 	var i RefreshToken
 	err := row.Scan(
 		&i.ID,
 		&i.UserID,
-		&i.Token,
 		&i.ExpiresAt,
 		&i.CreatedAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.ReplacedBy,
+		&i.TokenHash,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.ClientName,
+		&i.SessionStartedAt,
 	)
 	return i, err
 }
 
+const listUserSessions = `-- name: ListUserSessions :many
+SELECT id, user_id, expires_at, created_at, revoked_at, family_id, replaced_by, token_hash, user_agent, ip_address, client_name, session_started_at FROM refresh_tokens
+WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+ORDER BY created_at DESC
+`
+
+// The live token of each family is the session.
+func (q *Queries) ListUserSessions(ctx context.Context, userID int32) ([]RefreshToken, error) {
+	rows, err := q.db.Query(ctx, listUserSessions, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RefreshToken
+	for rows.Next() {
+		var i RefreshToken
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.ExpiresAt,
+			&i.CreatedAt,
+			&i.RevokedAt,
+			&i.FamilyID,
+			&i.ReplacedBy,
+			&i.TokenHash,
+			&i.UserAgent,
+			&i.IpAddress,
+			&i.ClientName,
+			&i.SessionStartedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const revokeRefreshToken = `-- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
 SET revoked_at = NOW()
-WHERE token = $1
+WHERE token_hash = $1
 `
 
-func (q *Queries) RevokeRefreshToken(ctx context.Context, token string) error {
-	_, err := q.db.Exec(ctx, revokeRefreshToken, token)
+func (q *Queries) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	_, err := q.db.Exec(ctx, revokeRefreshToken, tokenHash)
+	return err
+}
+
+const revokeRefreshTokenFamily = `-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeRefreshTokenFamily(ctx context.Context, familyID pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, revokeRefreshTokenFamily, familyID)
 	return err
 }
 
@@ -81,3 +185,41 @@ func (q *Queries) RevokeUserRefreshTokens(ctx context.Context, userID int32) err
 	_, err := q.db.Exec(ctx, revokeUserRefreshTokens, userID)
 	return err
 }
+
+const revokeUserSession = `-- name: RevokeUserSession :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW()
+WHERE user_id = $1 AND family_id = $2 AND revoked_at IS NULL
+`
+
+type RevokeUserSessionParams struct {
+	UserID   int32       `json:"user_id"`
+	FamilyID pgtype.UUID `json:"family_id"`
+}
+
+func (q *Queries) RevokeUserSession(ctx context.Context, arg RevokeUserSessionParams) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeUserSession, arg.UserID, arg.FamilyID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const rotateRefreshToken = `-- name: RotateRefreshToken :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), replaced_by = $2
+WHERE id = $1 AND revoked_at IS NULL
+`
+
+type RotateRefreshTokenParams struct {
+	ID         int32       `json:"id"`
+	ReplacedBy pgtype.Int4 `json:"replaced_by"`
+}
+
+func (q *Queries) RotateRefreshToken(ctx context.Context, arg RotateRefreshTokenParams) (int64, error) {
+	result, err := q.db.Exec(ctx, rotateRefreshToken, arg.ID, arg.ReplacedBy)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,58 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.20.0
+// source: revoked_access_tokens.sql
+
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const deleteExpiredRevokedAccessTokens = `-- name: DeleteExpiredRevokedAccessTokens :execrows
+DELETE FROM revoked_access_tokens
+WHERE expires_at < NOW()
+`
+
+func (q *Queries) DeleteExpiredRevokedAccessTokens(ctx context.Context) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredRevokedAccessTokens)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const isAccessTokenRevoked = `-- name: IsAccessTokenRevoked :one
+SELECT EXISTS (
+    SELECT 1 FROM revoked_access_tokens WHERE jti = $1
+)
+`
+
+func (q *Queries) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	row := q.db.QueryRow(ctx, isAccessTokenRevoked, jti)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const revokeAccessToken = `-- name: RevokeAccessToken :exec
+INSERT INTO revoked_access_tokens (
+    jti, user_id, expires_at
+) VALUES (
+    $1, $2, $3
+)
+ON CONFLICT (jti) DO NOTHING
+`
+
+type RevokeAccessTokenParams struct {
+	Jti       string             `json:"jti"`
+	UserID    int32              `json:"user_id"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+}
+
+func (q *Queries) RevokeAccessToken(ctx context.Context, arg RevokeAccessTokenParams) error {
+	_, err := q.db.Exec(ctx, revokeAccessToken, arg.Jti, arg.UserID, arg.ExpiresAt)
+	return err
+}
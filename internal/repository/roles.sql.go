@@ -38,18 +38,21 @@ func (q *Queries) AssignPermissionToRole(ctx context.Context, arg AssignPermissi
 }
 
 const createRole = `-- name: CreateRole :one
-INSERT INTO roles (code, name, description, level, is_system, status)
-VALUES ($1, $2, $3, $4, $5, $6)
-RETURNING id, code, name, description, level, is_system, status, created_at, updated_at
+INSERT INTO roles (code, name, description, level, is_system, status, access_token_ttl_seconds, refresh_token_ttl_seconds, require_mfa)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING id, code, name, description, level, is_system, status, created_at, updated_at, access_token_ttl_seconds, refresh_token_ttl_seconds, require_mfa
 `
 
 type CreateRoleParams struct {
-	Code        string      `json:"code"`
-	Name        string      `json:"name"`
-	Description pgtype.Text `json:"description"`
-	Level       pgtype.Int4 `json:"level"`
-	IsSystem    pgtype.Bool `json:"is_system"`
-	Status      pgtype.Text `json:"status"`
+	Code                   string      `json:"code"`
+	Name                   string      `json:"name"`
+	Description            pgtype.Text `json:"description"`
+	Level                  pgtype.Int4 `json:"level"`
+	IsSystem               pgtype.Bool `json:"is_system"`
+	Status                 pgtype.Text `json:"status"`
+	AccessTokenTtlSeconds  pgtype.Int4 `json:"access_token_ttl_seconds"`
+	RefreshTokenTtlSeconds pgtype.Int4 `json:"refresh_token_ttl_seconds"`
+	RequireMfa             bool        `json:"require_mfa"`
 }
 
 func (q *Queries) CreateRole(ctx context.Context, arg CreateRoleParams) (Role, error) {
@@ -60,6 +63,9 @@ func (q *Queries) CreateRole(ctx context.Context, arg CreateRoleParams) (Role, e
 		arg.Level,
 		arg.IsSystem,
 		arg.Status,
+		arg.AccessTokenTtlSeconds,
+		arg.RefreshTokenTtlSeconds,
+		arg.RequireMfa,
 	)
 	var i Role
 	err := row.Scan(
@@ -72,6 +78,9 @@ func (q *Queries) CreateRole(ctx context.Context, arg CreateRoleParams) (Role, e
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.AccessTokenTtlSeconds,
+		&i.RefreshTokenTtlSeconds,
+		&i.RequireMfa,
 	)
 	return i, err
 }
@@ -86,7 +95,7 @@ func (q *Queries) DeleteRole(ctx context.Context, id int32) error {
 }
 
 const getRoleByCode = `-- name: GetRoleByCode :one
-SELECT id, code, name, description, level, is_system, status, created_at, updated_at FROM roles WHERE code = $1 LIMIT 1
+SELECT id, code, name, description, level, is_system, status, created_at, updated_at, access_token_ttl_seconds, refresh_token_ttl_seconds, require_mfa FROM roles WHERE code = $1 LIMIT 1
 `
 
 func (q *Queries) GetRoleByCode(ctx context.Context, code string) (Role, error) {
@@ -102,12 +111,15 @@ func (q *Queries) GetRoleByCode(ctx context.Context, code string) (Role, error)
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.AccessTokenTtlSeconds,
+		&i.RefreshTokenTtlSeconds,
+		&i.RequireMfa,
 	)
 	return i, err
 }
 
 const getRoleById = `-- name: GetRoleById :one
-SELECT id, code, name, description, level, is_system, status, created_at, updated_at FROM roles WHERE id = $1 LIMIT 1
+SELECT id, code, name, description, level, is_system, status, created_at, updated_at, access_token_ttl_seconds, refresh_token_ttl_seconds, require_mfa FROM roles WHERE id = $1 LIMIT 1
 `
 
 func (q *Queries) GetRoleById(ctx context.Context, id int32) (Role, error) {
@@ -123,6 +135,9 @@ func (q *Queries) GetRoleById(ctx context.Context, id int32) (Role, error) {
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.AccessTokenTtlSeconds,
+		&i.RefreshTokenTtlSeconds,
+		&i.RequireMfa,
 	)
 	return i, err
 }
@@ -281,7 +296,7 @@ func (q *Queries) ListRolePermissions(ctx context.Context, roleID int32) ([]List
 }
 
 const listRoles = `-- name: ListRoles :many
-SELECT id, code, name, description, level, is_system, status, created_at, updated_at FROM roles ORDER BY level ASC
+SELECT id, code, name, description, level, is_system, status, created_at, updated_at, access_token_ttl_seconds, refresh_token_ttl_seconds, require_mfa FROM roles ORDER BY level ASC
 `
 
 func (q *Queries) ListRoles(ctx context.Context) ([]Role, error) {
@@ -303,6 +318,9 @@ func (q *Queries) ListRoles(ctx context.Context) ([]Role, error) {
 			&i.Status,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.AccessTokenTtlSeconds,
+			&i.RefreshTokenTtlSeconds,
+			&i.RequireMfa,
 		); err != nil {
 			return nil, err
 		}
@@ -330,17 +348,21 @@ func (q *Queries) RemovePermissionFromRole(ctx context.Context, arg RemovePermis
 
 const updateRole = `-- name: UpdateRole :one
 UPDATE roles
-SET name = $2, description = $3, level = $4, status = $5, updated_at = NOW()
+SET name = $2, description = $3, level = $4, status = $5,
+    access_token_ttl_seconds = $6, refresh_token_ttl_seconds = $7, require_mfa = $8, updated_at = NOW()
 WHERE id = $1
-RETURNING id, code, name, description, level, is_system, status, created_at, updated_at
+RETURNING id, code, name, description, level, is_system, status, created_at, updated_at, access_token_ttl_seconds, refresh_token_ttl_seconds, require_mfa
 `
 
 type UpdateRoleParams struct {
-	ID          int32       `json:"id"`
-	Name        string      `json:"name"`
-	Description pgtype.Text `json:"description"`
-	Level       pgtype.Int4 `json:"level"`
-	Status      pgtype.Text `json:"status"`
+	ID                     int32       `json:"id"`
+	Name                   string      `json:"name"`
+	Description            pgtype.Text `json:"description"`
+	Level                  pgtype.Int4 `json:"level"`
+	Status                 pgtype.Text `json:"status"`
+	AccessTokenTtlSeconds  pgtype.Int4 `json:"access_token_ttl_seconds"`
+	RefreshTokenTtlSeconds pgtype.Int4 `json:"refresh_token_ttl_seconds"`
+	RequireMfa             bool        `json:"require_mfa"`
 }
 
 func (q *Queries) UpdateRole(ctx context.Context, arg UpdateRoleParams) (Role, error) {
@@ -350,6 +372,9 @@ func (q *Queries) UpdateRole(ctx context.Context, arg UpdateRoleParams) (Role, e
 		arg.Description,
 		arg.Level,
 		arg.Status,
+		arg.AccessTokenTtlSeconds,
+		arg.RefreshTokenTtlSeconds,
+		arg.RequireMfa,
 	)
 	var i Role
 	err := row.Scan(
@@ -362,6 +387,9 @@ func (q *Queries) UpdateRole(ctx context.Context, arg UpdateRoleParams) (Role, e
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.AccessTokenTtlSeconds,
+		&i.RefreshTokenTtlSeconds,
+		&i.RequireMfa,
 	)
 	return i, err
 }
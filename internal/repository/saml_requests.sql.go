@@ -0,0 +1,82 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.20.0
+// source: saml_requests.sql
+
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const createSAMLRequest = `-- name: CreateSAMLRequest :exec
+INSERT INTO saml_requests (
+    relay_state_hash, provider, request_id, return_to, expires_at, link_user_id
+) VALUES (
+    $1, $2, $3, $4, $5, $6
+)
+`
+
+type CreateSAMLRequestParams struct {
+	RelayStateHash string             `json:"relay_state_hash"`
+	Provider       string             `json:"provider"`
+	RequestID      string             `json:"request_id"`
+	ReturnTo       string             `json:"return_to"`
+	ExpiresAt      pgtype.Timestamptz `json:"expires_at"`
+	LinkUserID     pgtype.Int4        `json:"link_user_id"`
+}
+
+func (q *Queries) CreateSAMLRequest(ctx context.Context, arg CreateSAMLRequestParams) error {
+	_, err := q.db.Exec(ctx, createSAMLRequest,
+		arg.RelayStateHash,
+		arg.Provider,
+		arg.RequestID,
+		arg.ReturnTo,
+		arg.ExpiresAt,
+		arg.LinkUserID,
+	)
+	return err
+}
+
+const deleteExpiredSAMLRequests = `-- name: DeleteExpiredSAMLRequests :execrows
+DELETE FROM saml_requests
+WHERE expires_at < NOW()
+`
+
+func (q *Queries) DeleteExpiredSAMLRequests(ctx context.Context) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredSAMLRequests)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const takeSAMLRequest = `-- name: TakeSAMLRequest :one
+DELETE FROM saml_requests
+WHERE relay_state_hash = $1 AND provider = $2
+RETURNING id, relay_state_hash, provider, request_id, return_to, expires_at, created_at, link_user_id
+`
+
+type TakeSAMLRequestParams struct {
+	RelayStateHash string `json:"relay_state_hash"`
+	Provider       string `json:"provider"`
+}
+
+// A request is answered once, a replayed response finds nothing.
+func (q *Queries) TakeSAMLRequest(ctx context.Context, arg TakeSAMLRequestParams) (SamlRequest, error) {
+	row := q.db.QueryRow(ctx, takeSAMLRequest, arg.RelayStateHash, arg.Provider)
+	var i SamlRequest
+	err := row.Scan(
+		&i.ID,
+		&i.RelayStateHash,
+		&i.Provider,
+		&i.RequestID,
+		&i.ReturnTo,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.LinkUserID,
+	)
+	return i, err
+}
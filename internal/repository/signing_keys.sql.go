@@ -0,0 +1,184 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.20.0
+// source: signing_keys.sql
+
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const activateSigningKey = `-- name: ActivateSigningKey :exec
+UPDATE signing_keys
+SET state = 'ACTIVE', activated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) ActivateSigningKey(ctx context.Context, id int32) error {
+	_, err := q.db.Exec(ctx, activateSigningKey, id)
+	return err
+}
+
+const createSigningKey = `-- name: CreateSigningKey :one
+INSERT INTO signing_keys (
+    kid, algorithm, private_key, state, activated_at
+) VALUES (
+    $1, $2, $3, $4, $5
+)
+RETURNING id, kid, algorithm, private_key, state, activated_at, retire_at, retired_at, created_at
+`
+
+type CreateSigningKeyParams struct {
+	Kid         string             `json:"kid"`
+	Algorithm   string             `json:"algorithm"`
+	PrivateKey  string             `json:"private_key"`
+	State       string             `json:"state"`
+	ActivatedAt pgtype.Timestamptz `json:"activated_at"`
+}
+
+func (q *Queries) CreateSigningKey(ctx context.Context, arg CreateSigningKeyParams) (SigningKey, error) {
+	row := q.db.QueryRow(ctx, createSigningKey,
+		arg.Kid,
+		arg.Algorithm,
+		arg.PrivateKey,
+		arg.State,
+		arg.ActivatedAt,
+	)
+	var i SigningKey
+	err := row.Scan(
+		&i.ID,
+		&i.Kid,
+		&i.Algorithm,
+		&i.PrivateKey,
+		&i.State,
+		&i.ActivatedAt,
+		&i.RetireAt,
+		&i.RetiredAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listPublishedSigningKeys = `-- name: ListPublishedSigningKeys :many
+SELECT id, kid, algorithm, private_key, state, activated_at, retire_at, retired_at, created_at FROM signing_keys
+WHERE state <> 'RETIRED'
+ORDER BY created_at DESC, id DESC
+`
+
+func (q *Queries) ListPublishedSigningKeys(ctx context.Context) ([]SigningKey, error) {
+	rows, err := q.db.Query(ctx, listPublishedSigningKeys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SigningKey
+	for rows.Next() {
+		var i SigningKey
+		if err := rows.Scan(
+			&i.ID,
+			&i.Kid,
+			&i.Algorithm,
+			&i.PrivateKey,
+			&i.State,
+			&i.ActivatedAt,
+			&i.RetireAt,
+			&i.RetiredAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSigningKeys = `-- name: ListSigningKeys :many
+SELECT id, kid, algorithm, private_key, state, activated_at, retire_at, retired_at, created_at FROM signing_keys
+ORDER BY created_at DESC, id DESC
+`
+
+func (q *Queries) ListSigningKeys(ctx context.Context) ([]SigningKey, error) {
+	rows, err := q.db.Query(ctx, listSigningKeys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SigningKey
+	for rows.Next() {
+		var i SigningKey
+		if err := rows.Scan(
+			&i.ID,
+			&i.Kid,
+			&i.Algorithm,
+			&i.PrivateKey,
+			&i.State,
+			&i.ActivatedAt,
+			&i.RetireAt,
+			&i.RetiredAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockSigningKeys = `-- name: LockSigningKeys :exec
+SELECT pg_advisory_xact_lock(hashtext('signing_keys'))
+`
+
+func (q *Queries) LockSigningKeys(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, lockSigningKeys)
+	return err
+}
+
+const retireActiveSigningKeys = `-- name: RetireActiveSigningKeys :exec
+UPDATE signing_keys
+SET state = 'RETIRING', retire_at = $1
+WHERE state = 'ACTIVE'
+`
+
+func (q *Queries) RetireActiveSigningKeys(ctx context.Context, retireAt pgtype.Timestamptz) error {
+	_, err := q.db.Exec(ctx, retireActiveSigningKeys, retireAt)
+	return err
+}
+
+const retireExpiredSigningKeys = `-- name: RetireExpiredSigningKeys :execrows
+UPDATE signing_keys
+SET state = 'RETIRED', retired_at = NOW()
+WHERE state = 'RETIRING' AND retire_at <= NOW()
+`
+
+func (q *Queries) RetireExpiredSigningKeys(ctx context.Context) (int64, error) {
+	result, err := q.db.Exec(ctx, retireExpiredSigningKeys)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateSigningKeyPrivateKey = `-- name: UpdateSigningKeyPrivateKey :exec
+UPDATE signing_keys
+SET private_key = $2
+WHERE id = $1
+`
+
+type UpdateSigningKeyPrivateKeyParams struct {
+	ID         int32  `json:"id"`
+	PrivateKey string `json:"private_key"`
+}
+
+func (q *Queries) UpdateSigningKeyPrivateKey(ctx context.Context, arg UpdateSigningKeyPrivateKeyParams) error {
+	_, err := q.db.Exec(ctx, updateSigningKeyPrivateKey, arg.ID, arg.PrivateKey)
+	return err
+}
@@ -1,12 +1,16 @@
 package repository
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // Store defines all functions to execute db queries and transactions
 type Store interface {
 	Querier
+	ExecTx(ctx context.Context, fn func(Querier) error) error
 }
 
 // SQLStore provides all functions to execute SQL queries and transactions
@@ -22,3 +26,20 @@ func NewStore(db *pgxpool.Pool) Store {
 		db:      db,
 	}
 }
+
+// ExecTx executes a function within a database transaction
+func (store *SQLStore) ExecTx(ctx context.Context, fn func(Querier) error) error {
+	tx, err := store.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(New(tx)); err != nil {
+		if rbErr := tx.Rollback(ctx); rbErr != nil {
+			return fmt.Errorf("tx err: %v, rb err: %v", err, rbErr)
+		}
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,154 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.20.0
+// source: user_identities.sql
+
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const countUserIdentities = `-- name: CountUserIdentities :one
+SELECT COUNT(*) FROM user_identities WHERE user_id = $1
+`
+
+func (q *Queries) CountUserIdentities(ctx context.Context, userID int32) (int64, error) {
+	row := q.db.QueryRow(ctx, countUserIdentities, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createUserIdentity = `-- name: CreateUserIdentity :one
+INSERT INTO user_identities (
+    user_id, provider, subject, email, last_login_at
+) VALUES (
+    $1, $2, $3, $4, $5
+)
+RETURNING id, user_id, provider, subject, email, last_login_at, created_at
+`
+
+type CreateUserIdentityParams struct {
+	UserID      int32              `json:"user_id"`
+	Provider    string             `json:"provider"`
+	Subject     string             `json:"subject"`
+	Email       pgtype.Text        `json:"email"`
+	LastLoginAt pgtype.Timestamptz `json:"last_login_at"`
+}
+
+func (q *Queries) CreateUserIdentity(ctx context.Context, arg CreateUserIdentityParams) (UserIdentity, error) {
+	row := q.db.QueryRow(ctx, createUserIdentity,
+		arg.UserID,
+		arg.Provider,
+		arg.Subject,
+		arg.Email,
+		arg.LastLoginAt,
+	)
+	var i UserIdentity
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Provider,
+		&i.Subject,
+		&i.Email,
+		&i.LastLoginAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteUserIdentity = `-- name: DeleteUserIdentity :execrows
+DELETE FROM user_identities
+WHERE id = $1 AND user_id = $2
+`
+
+type DeleteUserIdentityParams struct {
+	ID     int32 `json:"id"`
+	UserID int32 `json:"user_id"`
+}
+
+func (q *Queries) DeleteUserIdentity(ctx context.Context, arg DeleteUserIdentityParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteUserIdentity, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const getUserIdentity = `-- name: GetUserIdentity :one
+SELECT id, user_id, provider, subject, email, last_login_at, created_at FROM user_identities
+WHERE provider = $1 AND subject = $2 LIMIT 1
+`
+
+type GetUserIdentityParams struct {
+	Provider string `json:"provider"`
+	Subject  string `json:"subject"`
+}
+
+func (q *Queries) GetUserIdentity(ctx context.Context, arg GetUserIdentityParams) (UserIdentity, error) {
+	row := q.db.QueryRow(ctx, getUserIdentity, arg.Provider, arg.Subject)
+	var i UserIdentity
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Provider,
+		&i.Subject,
+		&i.Email,
+		&i.LastLoginAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listUserIdentities = `-- name: ListUserIdentities :many
+SELECT id, user_id, provider, subject, email, last_login_at, created_at FROM user_identities
+WHERE user_id = $1
+ORDER BY created_at ASC
+`
+
+func (q *Queries) ListUserIdentities(ctx context.Context, userID int32) ([]UserIdentity, error) {
+	rows, err := q.db.Query(ctx, listUserIdentities, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserIdentity
+	for rows.Next() {
+		var i UserIdentity
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Provider,
+			&i.Subject,
+			&i.Email,
+			&i.LastLoginAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateUserIdentityLogin = `-- name: UpdateUserIdentityLogin :exec
+UPDATE user_identities
+SET email = $2, last_login_at = NOW()
+WHERE id = $1
+`
+
+type UpdateUserIdentityLoginParams struct {
+	ID    int32       `json:"id"`
+	Email pgtype.Text `json:"email"`
+}
+
+func (q *Queries) UpdateUserIdentityLogin(ctx context.Context, arg UpdateUserIdentityLoginParams) error {
+	_, err := q.db.Exec(ctx, updateUserIdentityLogin, arg.ID, arg.Email)
+	return err
+}
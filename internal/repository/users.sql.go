@@ -29,22 +29,24 @@ func (q *Queries) AssignEmployeeId(ctx context.Context, arg AssignEmployeeIdPara
 
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (
-  username, password_hash, full_name, email, phone, avatar, role_id, status
+  username, password_hash, full_name, email, phone, avatar, role_id, status, must_change_password, password_changed_at
 ) VALUES (
-  $1, $2, $3, $4, $5, $6, $7, $8
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, $10
 )
-RETURNING id, username, password_hash, external_login, employee_id, role_id, full_name, email, phone, avatar, status, last_login_ip, last_login_at, created_at, updated_at, deleted_at
+RETURNING id, username, password_hash, external_login, employee_id, role_id, full_name, email, phone, avatar, status, last_login_ip, last_login_at, created_at, updated_at, deleted_at, failed_login_attempts, locked_until, lockout_count, must_change_password, password_changed_at, auth_source
 `
 
 type CreateUserParams struct {
-	Username     string      `json:"username"`
-	PasswordHash pgtype.Text `json:"password_hash"`
-	FullName     string      `json:"full_name"`
-	Email        pgtype.Text `json:"email"`
-	Phone        pgtype.Text `json:"phone"`
-	Avatar       pgtype.Text `json:"avatar"`
-	RoleID       pgtype.Int4 `json:"role_id"`
-	Status       pgtype.Text `json:"status"`
+	Username           string             `json:"username"`
+	PasswordHash       pgtype.Text        `json:"password_hash"`
+	FullName           string             `json:"full_name"`
+	Email              pgtype.Text        `json:"email"`
+	Phone              pgtype.Text        `json:"phone"`
+	Avatar             pgtype.Text        `json:"avatar"`
+	RoleID             pgtype.Int4        `json:"role_id"`
+	Status             pgtype.Text        `json:"status"`
+	MustChangePassword bool               `json:"must_change_password"`
+	PasswordChangedAt  pgtype.Timestamptz `json:"password_changed_at"`
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
@@ -57,6 +59,8 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		arg.Avatar,
 		arg.RoleID,
 		arg.Status,
+		arg.MustChangePassword,
+		arg.PasswordChangedAt,
 	)
 	var i User
 	err := row.Scan(
@@ -76,6 +80,12 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.LockoutCount,
+		&i.MustChangePassword,
+		&i.PasswordChangedAt,
+		&i.AuthSource,
 	)
 	return i, err
 }
@@ -90,7 +100,7 @@ func (q *Queries) DeleteUser(ctx context.Context, id int32) error {
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, username, password_hash, external_login, employee_id, role_id, full_name, email, phone, avatar, status, last_login_ip, last_login_at, created_at, updated_at, deleted_at FROM users
+SELECT id, username, password_hash, external_login, employee_id, role_id, full_name, email, phone, avatar, status, last_login_ip, last_login_at, created_at, updated_at, deleted_at, failed_login_attempts, locked_until, lockout_count, must_change_password, password_changed_at, auth_source FROM users
 WHERE email = $1 AND deleted_at IS NULL LIMIT 1
 `
 
@@ -114,12 +124,18 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email pgtype.Text) (User,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.LockoutCount,
+		&i.MustChangePassword,
+		&i.PasswordChangedAt,
+		&i.AuthSource,
 	)
 	return i, err
 }
 
 const getUserById = `-- name: GetUserById :one
-SELECT id, username, password_hash, external_login, employee_id, role_id, full_name, email, phone, avatar, status, last_login_ip, last_login_at, created_at, updated_at, deleted_at FROM users
+SELECT id, username, password_hash, external_login, employee_id, role_id, full_name, email, phone, avatar, status, last_login_ip, last_login_at, created_at, updated_at, deleted_at, failed_login_attempts, locked_until, lockout_count, must_change_password, password_changed_at, auth_source FROM users
 WHERE id = $1 AND deleted_at IS NULL LIMIT 1
 `
 
@@ -143,12 +159,18 @@ func (q *Queries) GetUserById(ctx context.Context, id int32) (User, error) {
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.LockoutCount,
+		&i.MustChangePassword,
+		&i.PasswordChangedAt,
+		&i.AuthSource,
 	)
 	return i, err
 }
 
 const getUserByUsername = `-- name: GetUserByUsername :one
-SELECT id, username, password_hash, external_login, employee_id, role_id, full_name, email, phone, avatar, status, last_login_ip, last_login_at, created_at, updated_at, deleted_at FROM users
+SELECT id, username, password_hash, external_login, employee_id, role_id, full_name, email, phone, avatar, status, last_login_ip, last_login_at, created_at, updated_at, deleted_at, failed_login_attempts, locked_until, lockout_count, must_change_password, password_changed_at, auth_source FROM users
 WHERE username = $1 AND deleted_at IS NULL LIMIT 1
 `
 
@@ -172,12 +194,18 @@ func (q *Queries) GetUserByUsername(ctx context.Context, username string) (User,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.LockoutCount,
+		&i.MustChangePassword,
+		&i.PasswordChangedAt,
+		&i.AuthSource,
 	)
 	return i, err
 }
 
 const listUsers = `-- name: ListUsers :many
-SELECT u.id, u.username, u.password_hash, u.external_login, u.employee_id, u.role_id, u.full_name, u.email, u.phone, u.avatar, u.status, u.last_login_ip, u.last_login_at, u.created_at, u.updated_at, u.deleted_at, r.name as role_name, r.code as role_code
+SELECT u.id, u.username, u.password_hash, u.external_login, u.employee_id, u.role_id, u.full_name, u.email, u.phone, u.avatar, u.status, u.last_login_ip, u.last_login_at, u.created_at, u.updated_at, u.deleted_at, u.failed_login_attempts, u.locked_until, u.lockout_count, u.must_change_password, u.password_changed_at, u.auth_source, r.name as role_name, r.code as role_code
 FROM users u
 LEFT JOIN roles r ON u.role_id = r.id
 WHERE u.deleted_at IS NULL
@@ -185,24 +213,30 @@ ORDER BY u.created_at DESC
 `
 
 type ListUsersRow struct {
-	ID            int32              `json:"id"`
-	Username      string             `json:"username"`
-	PasswordHash  pgtype.Text        `json:"password_hash"`
-	ExternalLogin pgtype.Bool        `json:"external_login"`
-	EmployeeID    pgtype.Int4        `json:"employee_id"`
-	RoleID        pgtype.Int4        `json:"role_id"`
-	FullName      string             `json:"full_name"`
-	Email         pgtype.Text        `json:"email"`
-	Phone         pgtype.Text        `json:"phone"`
-	Avatar        pgtype.Text        `json:"avatar"`
-	Status        pgtype.Text        `json:"status"`
-	LastLoginIp   pgtype.Text        `json:"last_login_ip"`
-	LastLoginAt   pgtype.Timestamptz `json:"last_login_at"`
-	CreatedAt     pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt     pgtype.Timestamptz `json:"updated_at"`
-	DeletedAt     pgtype.Timestamptz `json:"deleted_at"`
-	RoleName      pgtype.Text        `json:"role_name"`
-	RoleCode      pgtype.Text        `json:"role_code"`
+	ID                  int32              `json:"id"`
+	Username            string             `json:"username"`
+	PasswordHash        pgtype.Text        `json:"password_hash"`
+	ExternalLogin       pgtype.Bool        `json:"external_login"`
+	EmployeeID          pgtype.Int4        `json:"employee_id"`
+	RoleID              pgtype.Int4        `json:"role_id"`
+	FullName            string             `json:"full_name"`
+	Email               pgtype.Text        `json:"email"`
+	Phone               pgtype.Text        `json:"phone"`
+	Avatar              pgtype.Text        `json:"avatar"`
+	Status              pgtype.Text        `json:"status"`
+	LastLoginIp         pgtype.Text        `json:"last_login_ip"`
+	LastLoginAt         pgtype.Timestamptz `json:"last_login_at"`
+	CreatedAt           pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt           pgtype.Timestamptz `json:"updated_at"`
+	DeletedAt           pgtype.Timestamptz `json:"deleted_at"`
+	FailedLoginAttempts int32              `json:"failed_login_attempts"`
+	LockedUntil         pgtype.Timestamptz `json:"locked_until"`
+	LockoutCount        int32              `json:"lockout_count"`
+	MustChangePassword  bool               `json:"must_change_password"`
+	PasswordChangedAt   pgtype.Timestamptz `json:"password_changed_at"`
+	AuthSource          string             `json:"auth_source"`
+	RoleName            pgtype.Text        `json:"role_name"`
+	RoleCode            pgtype.Text        `json:"role_code"`
 }
 
 func (q *Queries) ListUsers(ctx context.Context) ([]ListUsersRow, error) {
@@ -231,6 +265,12 @@ func (q *Queries) ListUsers(ctx context.Context) ([]ListUsersRow, error) {
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.DeletedAt,
+			&i.FailedLoginAttempts,
+			&i.LockedUntil,
+			&i.LockoutCount,
+			&i.MustChangePassword,
+			&i.PasswordChangedAt,
+			&i.AuthSource,
 			&i.RoleName,
 			&i.RoleCode,
 		); err != nil {
@@ -244,11 +284,77 @@ func (q *Queries) ListUsers(ctx context.Context) ([]ListUsersRow, error) {
 	return items, nil
 }
 
+const lockUser = `-- name: LockUser :exec
+UPDATE users
+SET locked_until = $2, lockout_count = lockout_count + 1, failed_login_attempts = 0
+WHERE id = $1
+`
+
+type LockUserParams struct {
+	ID          int32              `json:"id"`
+	LockedUntil pgtype.Timestamptz `json:"locked_until"`
+}
+
+func (q *Queries) LockUser(ctx context.Context, arg LockUserParams) error {
+	_, err := q.db.Exec(ctx, lockUser, arg.ID, arg.LockedUntil)
+	return err
+}
+
+const registerFailedLogin = `-- name: RegisterFailedLogin :one
+UPDATE users
+SET failed_login_attempts = failed_login_attempts + 1
+WHERE id = $1
+RETURNING failed_login_attempts, lockout_count
+`
+
+type RegisterFailedLoginRow struct {
+	FailedLoginAttempts int32 `json:"failed_login_attempts"`
+	LockoutCount        int32 `json:"lockout_count"`
+}
+
+func (q *Queries) RegisterFailedLogin(ctx context.Context, id int32) (RegisterFailedLoginRow, error) {
+	row := q.db.QueryRow(ctx, registerFailedLogin, id)
+	var i RegisterFailedLoginRow
+	err := row.Scan(&i.FailedLoginAttempts, &i.LockoutCount)
+	return i, err
+}
+
+const rehashUserPassword = `-- name: RehashUserPassword :execrows
+UPDATE users
+SET password_hash = $1
+WHERE id = $2 AND password_hash = $3
+`
+
+type RehashUserPasswordParams struct {
+	NewHash pgtype.Text `json:"new_hash"`
+	ID      int32       `json:"id"`
+	OldHash pgtype.Text `json:"old_hash"`
+}
+
+func (q *Queries) RehashUserPassword(ctx context.Context, arg RehashUserPasswordParams) (int64, error) {
+	result, err := q.db.Exec(ctx, rehashUserPassword, arg.NewHash, arg.ID, arg.OldHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const resetFailedLogins = `-- name: ResetFailedLogins :exec
+UPDATE users
+SET failed_login_attempts = 0, lockout_count = 0, locked_until = NULL
+WHERE id = $1
+`
+
+func (q *Queries) ResetFailedLogins(ctx context.Context, id int32) error {
+	_, err := q.db.Exec(ctx, resetFailedLogins, id)
+	return err
+}
+
 const updateUser = `-- name: UpdateUser :one
 UPDATE users
 SET full_name = $2, email = $3, phone = $4, avatar = $5, role_id = $6, status = $7, updated_at = NOW()
 WHERE id = $1
-RETURNING id, username, password_hash, external_login, employee_id, role_id, full_name, email, phone, avatar, status, last_login_ip, last_login_at, created_at, updated_at, deleted_at
+RETURNING id, username, password_hash, external_login, employee_id, role_id, full_name, email, phone, avatar, status, last_login_ip, last_login_at, created_at, updated_at, deleted_at, failed_login_attempts, locked_until, lockout_count, must_change_password, password_changed_at, auth_source
 `
 
 type UpdateUserParams struct {
@@ -289,10 +395,32 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.LockoutCount,
+		&i.MustChangePassword,
+		&i.PasswordChangedAt,
+		&i.AuthSource,
 	)
 	return i, err
 }
 
+const updateUserAuthSource = `-- name: UpdateUserAuthSource :exec
+UPDATE users
+SET auth_source = $2
+WHERE id = $1
+`
+
+type UpdateUserAuthSourceParams struct {
+	ID         int32  `json:"id"`
+	AuthSource string `json:"auth_source"`
+}
+
+func (q *Queries) UpdateUserAuthSource(ctx context.Context, arg UpdateUserAuthSourceParams) error {
+	_, err := q.db.Exec(ctx, updateUserAuthSource, arg.ID, arg.AuthSource)
+	return err
+}
+
 const updateUserExternalLogin = `-- name: UpdateUserExternalLogin :exec
 UPDATE users
 SET external_login = $2
@@ -324,3 +452,36 @@ func (q *Queries) UpdateUserLastLogin(ctx context.Context, arg UpdateUserLastLog
 	_, err := q.db.Exec(ctx, updateUserLastLogin, arg.ID, arg.LastLoginIp)
 	return err
 }
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users
+SET password_hash = $2, must_change_password = $3, password_changed_at = NOW(), updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateUserPasswordParams struct {
+	ID                 int32       `json:"id"`
+	PasswordHash       pgtype.Text `json:"password_hash"`
+	MustChangePassword bool        `json:"must_change_password"`
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.Exec(ctx, updateUserPassword, arg.ID, arg.PasswordHash, arg.MustChangePassword)
+	return err
+}
+
+const updateUserRole = `-- name: UpdateUserRole :exec
+UPDATE users
+SET role_id = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateUserRoleParams struct {
+	ID     int32       `json:"id"`
+	RoleID pgtype.Int4 `json:"role_id"`
+}
+
+func (q *Queries) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) error {
+	_, err := q.db.Exec(ctx, updateUserRole, arg.ID, arg.RoleID)
+	return err
+}
@@ -0,0 +1,205 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.20.0
+// source: webauthn.sql
+
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const countUserWebAuthnCredentials = `-- name: CountUserWebAuthnCredentials :one
+SELECT COUNT(*) FROM webauthn_credentials
+WHERE user_id = $1
+`
+
+func (q *Queries) CountUserWebAuthnCredentials(ctx context.Context, userID int32) (int64, error) {
+	row := q.db.QueryRow(ctx, countUserWebAuthnCredentials, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createWebAuthnCredential = `-- name: CreateWebAuthnCredential :one
+INSERT INTO webauthn_credentials (
+    user_id, credential_id, name, credential
+) VALUES (
+    $1, $2, $3, $4
+)
+RETURNING id, user_id, credential_id, name, credential, last_used_at, created_at
+`
+
+type CreateWebAuthnCredentialParams struct {
+	UserID       int32  `json:"user_id"`
+	CredentialID []byte `json:"credential_id"`
+	Name         string `json:"name"`
+	Credential   []byte `json:"credential"`
+}
+
+func (q *Queries) CreateWebAuthnCredential(ctx context.Context, arg CreateWebAuthnCredentialParams) (WebauthnCredential, error) {
+	row := q.db.QueryRow(ctx, createWebAuthnCredential,
+		arg.UserID,
+		arg.CredentialID,
+		arg.Name,
+		arg.Credential,
+	)
+	var i WebauthnCredential
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.CredentialID,
+		&i.Name,
+		&i.Credential,
+		&i.LastUsedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createWebAuthnSession = `-- name: CreateWebAuthnSession :exec
+INSERT INTO webauthn_sessions (
+    token_hash, user_id, ceremony, session_data, expires_at
+) VALUES (
+    $1, $2, $3, $4, $5
+)
+`
+
+type CreateWebAuthnSessionParams struct {
+	TokenHash   string             `json:"token_hash"`
+	UserID      pgtype.Int4        `json:"user_id"`
+	Ceremony    string             `json:"ceremony"`
+	SessionData []byte             `json:"session_data"`
+	ExpiresAt   pgtype.Timestamptz `json:"expires_at"`
+}
+
+func (q *Queries) CreateWebAuthnSession(ctx context.Context, arg CreateWebAuthnSessionParams) error {
+	_, err := q.db.Exec(ctx, createWebAuthnSession,
+		arg.TokenHash,
+		arg.UserID,
+		arg.Ceremony,
+		arg.SessionData,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const deleteExpiredWebAuthnSessions = `-- name: DeleteExpiredWebAuthnSessions :execrows
+DELETE FROM webauthn_sessions
+WHERE expires_at < NOW()
+`
+
+func (q *Queries) DeleteExpiredWebAuthnSessions(ctx context.Context) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredWebAuthnSessions)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteUserWebAuthnCredentials = `-- name: DeleteUserWebAuthnCredentials :exec
+DELETE FROM webauthn_credentials WHERE user_id = $1
+`
+
+func (q *Queries) DeleteUserWebAuthnCredentials(ctx context.Context, userID int32) error {
+	_, err := q.db.Exec(ctx, deleteUserWebAuthnCredentials, userID)
+	return err
+}
+
+const deleteWebAuthnCredential = `-- name: DeleteWebAuthnCredential :execrows
+DELETE FROM webauthn_credentials
+WHERE id = $1 AND user_id = $2
+`
+
+type DeleteWebAuthnCredentialParams struct {
+	ID     int32 `json:"id"`
+	UserID int32 `json:"user_id"`
+}
+
+func (q *Queries) DeleteWebAuthnCredential(ctx context.Context, arg DeleteWebAuthnCredentialParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteWebAuthnCredential, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const listUserWebAuthnCredentials = `-- name: ListUserWebAuthnCredentials :many
+SELECT id, user_id, credential_id, name, credential, last_used_at, created_at FROM webauthn_credentials
+WHERE user_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) ListUserWebAuthnCredentials(ctx context.Context, userID int32) ([]WebauthnCredential, error) {
+	rows, err := q.db.Query(ctx, listUserWebAuthnCredentials, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebauthnCredential
+	for rows.Next() {
+		var i WebauthnCredential
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.CredentialID,
+			&i.Name,
+			&i.Credential,
+			&i.LastUsedAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const takeWebAuthnSession = `-- name: TakeWebAuthnSession :one
+DELETE FROM webauthn_sessions
+WHERE token_hash = $1 AND ceremony = $2
+RETURNING id, token_hash, user_id, ceremony, session_data, expires_at, created_at
+`
+
+type TakeWebAuthnSessionParams struct {
+	TokenHash string `json:"token_hash"`
+	Ceremony  string `json:"ceremony"`
+}
+
+// Sessions are single use: finishing a ceremony deletes its state.
+func (q *Queries) TakeWebAuthnSession(ctx context.Context, arg TakeWebAuthnSessionParams) (WebauthnSession, error) {
+	row := q.db.QueryRow(ctx, takeWebAuthnSession, arg.TokenHash, arg.Ceremony)
+	var i WebauthnSession
+	err := row.Scan(
+		&i.ID,
+		&i.TokenHash,
+		&i.UserID,
+		&i.Ceremony,
+		&i.SessionData,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const updateWebAuthnCredentialUsage = `-- name: UpdateWebAuthnCredentialUsage :exec
+UPDATE webauthn_credentials
+SET credential = $2, last_used_at = NOW()
+WHERE credential_id = $1
+`
+
+type UpdateWebAuthnCredentialUsageParams struct {
+	CredentialID []byte `json:"credential_id"`
+	Credential   []byte `json:"credential"`
+}
+
+// Stores the sign counter and flags of the last assertion.
+func (q *Queries) UpdateWebAuthnCredentialUsage(ctx context.Context, arg UpdateWebAuthnCredentialUsageParams) error {
+	_, err := q.db.Exec(ctx, updateWebAuthnCredentialUsage, arg.CredentialID, arg.Credential)
+	return err
+}
@@ -0,0 +1,63 @@
+package signing
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+)
+
+// JWK is the public representation of a signing key (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK builds the public JWK for a signing key.
+func NewJWK(k *Key) (JWK, error) {
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Algorithm}
+
+	switch pub := k.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = b64(pub.N.Bytes())
+		jwk.E = b64(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		ecdhPub, err := pub.ECDH()
+		if err != nil {
+			return JWK{}, err
+		}
+		// Uncompressed point: 0x04 || X || Y, both padded to the curve size.
+		point := ecdhPub.Bytes()
+		size := (len(point) - 1) / 2
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = b64(point[1 : 1+size])
+		jwk.Y = b64(point[1+size:])
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = b64(pub)
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key type %T", pub)
+	}
+	return jwk, nil
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
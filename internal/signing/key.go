@@ -0,0 +1,221 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key is an asymmetric private key used to sign access tokens.
+type Key struct {
+	ID        string
+	Algorithm string
+	Private   crypto.Signer
+}
+
+// LoadKeyFile reads a PEM encoded private key (PKCS#8, PKCS#1 or SEC 1) from disk.
+// An empty alg picks the default algorithm for the key type, an empty kid is
+// derived from the RFC 7638 thumbprint of the public key.
+func LoadKeyFile(path, alg, kid string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read private key: %w", err)
+	}
+	priv, err := ParsePrivateKeyPEM(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewKey(priv, alg, kid)
+}
+
+// NewKey validates that alg can be used with priv and fills in defaults.
+func NewKey(priv crypto.Signer, alg, kid string) (*Key, error) {
+	if alg == "" {
+		alg = defaultAlgorithm(priv)
+	}
+	if err := checkAlgorithm(priv, alg); err != nil {
+		return nil, err
+	}
+
+	key := &Key{ID: kid, Algorithm: alg, Private: priv}
+	if key.ID == "" {
+		thumbprint, err := key.Thumbprint()
+		if err != nil {
+			return nil, err
+		}
+		key.ID = thumbprint
+	}
+	return key, nil
+}
+
+// ParsePrivateKeyPEM decodes the first private key block found in data.
+func ParsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("no private key found in PEM data")
+		}
+
+		switch block.Type {
+		case "PRIVATE KEY":
+			k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("parse PKCS#8 private key: %w", err)
+			}
+			signer, ok := k.(crypto.Signer)
+			if !ok {
+				return nil, fmt.Errorf("unsupported private key type %T", k)
+			}
+			return signer, nil
+		case "RSA PRIVATE KEY":
+			return x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			return x509.ParseECPrivateKey(block.Bytes)
+		}
+	}
+}
+
+// Method returns the jwt signing method for the key algorithm.
+func (k *Key) Method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// Public returns the public half of the key.
+func (k *Key) Public() crypto.PublicKey {
+	return k.Private.Public()
+}
+
+// Thumbprint computes the base64url encoded RFC 7638 SHA-256 thumbprint of the public key.
+func (k *Key) Thumbprint() (string, error) {
+	jwk, err := NewJWK(k)
+	if err != nil {
+		return "", err
+	}
+
+	// Required members only, in lexicographic order.
+	var members interface{}
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func defaultAlgorithm(priv crypto.Signer) string {
+	switch k := priv.(type) {
+	case *rsa.PrivateKey:
+		return "RS256"
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P384():
+			return "ES384"
+		case elliptic.P521():
+			return "ES512"
+		}
+		return "ES256"
+	case ed25519.PrivateKey:
+		return "EdDSA"
+	}
+	return ""
+}
+
+func checkAlgorithm(priv crypto.Signer, alg string) error {
+	ok := false
+	switch k := priv.(type) {
+	case *rsa.PrivateKey:
+		switch alg {
+		case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512":
+			ok = k.N.BitLen() >= 2048
+		}
+	case *ecdsa.PrivateKey:
+		switch alg {
+		case "ES256":
+			ok = k.Curve == elliptic.P256()
+		case "ES384":
+			ok = k.Curve == elliptic.P384()
+		case "ES512":
+			ok = k.Curve == elliptic.P521()
+		}
+	case ed25519.PrivateKey:
+		ok = alg == "EdDSA"
+	default:
+		return fmt.Errorf("unsupported private key type %T", priv)
+	}
+
+	if !ok {
+		return fmt.Errorf("algorithm %q cannot be used with %T", alg, priv)
+	}
+	return nil
+}
+
+// GenerateKey creates a fresh private key suitable for alg.
+func GenerateKey(alg string) (*Key, error) {
+	var (
+		priv crypto.Signer
+		err  error
+	)
+	switch alg {
+	case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512":
+		priv, err = rsa.GenerateKey(rand.Reader, 3072)
+	case "ES256":
+		priv, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ES384":
+		priv, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case "ES512":
+		priv, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case "EdDSA":
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("cannot generate key for algorithm %q", alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewKey(priv, alg, "")
+}
+
+// EncodePEM serialises the private key as a PKCS#8 PEM block.
+func (k *Key) EncodePEM() (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(k.Private)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
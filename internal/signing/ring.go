@@ -0,0 +1,107 @@
+package signing
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key states, in lifecycle order.
+const (
+	StateNext     = "NEXT"     // published so consumers can cache it, not signing yet
+	StateActive   = "ACTIVE"   // signs new tokens
+	StateRetiring = "RETIRING" // still published until the tokens it signed expire
+	StateRetired  = "RETIRED"  // no longer published or accepted
+)
+
+// RingKey is a key together with its lifecycle state.
+type RingKey struct {
+	Key   *Key
+	State string
+}
+
+// KeyRing signs with the active key and verifies with, and publishes, every
+// key that is not retired. It is safe for concurrent use and is refreshed
+// from the key store with Replace.
+type KeyRing struct {
+	mu     sync.RWMutex
+	active *Key
+	keys   map[string]*Key
+	jwks   JWKSet
+}
+
+func NewKeyRing() *KeyRing {
+	return &KeyRing{keys: map[string]*Key{}, jwks: JWKSet{Keys: []JWK{}}}
+}
+
+// Replace swaps the ring contents. Keys are expected newest first; if several
+// keys are ACTIVE the newest one signs.
+func (r *KeyRing) Replace(keys []RingKey) error {
+	var active *Key
+	published := make(map[string]*Key, len(keys))
+	jwks := JWKSet{Keys: make([]JWK, 0, len(keys))}
+
+	for _, rk := range keys {
+		if rk.State == StateRetired {
+			continue
+		}
+		jwk, err := NewJWK(rk.Key)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", rk.Key.ID, err)
+		}
+		published[rk.Key.ID] = rk.Key
+		jwks.Keys = append(jwks.Keys, jwk)
+
+		if rk.State == StateActive && active == nil {
+			active = rk.Key
+		}
+	}
+	if active == nil {
+		return errors.New("key ring has no active key")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.active = active
+	r.keys = published
+	r.jwks = jwks
+	return nil
+}
+
+// Lookup returns a published key by kid.
+func (r *KeyRing) Lookup(kid string) (*Key, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	k, ok := r.keys[kid]
+	return k, ok
+}
+
+func (r *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	r.mu.RLock()
+	active := r.active
+	r.mu.RUnlock()
+	if active == nil {
+		return "", errors.New("key ring has no active key")
+	}
+
+	t := jwt.NewWithClaims(active.Method(), claims)
+	t.Header["kid"] = active.ID
+	return t.SignedString(active.Private)
+}
+
+func (r *KeyRing) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	k, ok := r.Lookup(kid)
+	if !ok || token.Method.Alg() != k.Algorithm {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return k.Public(), nil
+}
+
+func (r *KeyRing) JWKS() JWKSet {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.jwks
+}
@@ -0,0 +1,68 @@
+package signing
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// sealedPrefix marks private keys encrypted by a Sealer, telling them apart
+// from PEM stored before encryption was introduced.
+const sealedPrefix = "sealed:v1:"
+
+var ErrUnsealKey = errors.New("cannot decrypt signing key, wrong JWT_KEY_ENCRYPTION_KEY?")
+
+// Sealer encrypts private keys at rest with AES-256-GCM under a key
+// encryption key. The kid is authenticated along, so a sealed key cannot be
+// moved to another row.
+type Sealer struct {
+	aead cipher.AEAD
+}
+
+func NewSealer(kek []byte) (*Sealer, error) {
+	if len(kek) != 32 {
+		return nil, fmt.Errorf("key encryption key must be 32 bytes, got %d", len(kek))
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Sealer{aead: aead}, nil
+}
+
+// Seal encrypts the PEM of the key kid.
+func (s *Sealer) Seal(kid, pemStr string) (string, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := s.aead.Seal(nonce, nonce, []byte(pemStr), []byte(kid))
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a key sealed by Seal.
+func (s *Sealer) Open(kid, stored string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, sealedPrefix))
+	if err != nil || !IsSealed(stored) || len(raw) < s.aead.NonceSize() {
+		return "", ErrUnsealKey
+	}
+	nonce, ciphertext := raw[:s.aead.NonceSize()], raw[s.aead.NonceSize():]
+	plain, err := s.aead.Open(nil, nonce, ciphertext, []byte(kid))
+	if err != nil {
+		return "", ErrUnsealKey
+	}
+	return string(plain), nil
+}
+
+// IsSealed reports whether a stored key is encrypted.
+func IsSealed(stored string) bool {
+	return strings.HasPrefix(stored, sealedPrefix)
+}
@@ -0,0 +1,39 @@
+package signing
+
+import (
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Signer issues and verifies access tokens.
+type Signer interface {
+	Sign(claims jwt.Claims) (string, error)
+	Keyfunc(token *jwt.Token) (interface{}, error)
+	JWKS() JWKSet
+}
+
+type hmacSigner struct {
+	secret []byte
+}
+
+// NewHMACSigner keeps the legacy HS256 shared-secret behaviour. Nothing is
+// published in the JWKS since the key cannot be shared.
+func NewHMACSigner(secret string) Signer {
+	return &hmacSigner{secret: []byte(secret)}
+}
+
+func (s *hmacSigner) Sign(claims jwt.Claims) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+}
+
+func (s *hmacSigner) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if token.Method != jwt.SigningMethodHS256 {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return s.secret, nil
+}
+
+func (s *hmacSigner) JWKS() JWKSet {
+	return JWKSet{Keys: []JWK{}}
+}
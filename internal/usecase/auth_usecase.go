@@ -2,38 +2,134 @@ package usecase
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/zomzem/identity-service/internal/config"
+	"github.com/zomzem/identity-service/internal/directory"
+	"github.com/zomzem/identity-service/internal/idp"
+	"github.com/zomzem/identity-service/internal/notify"
+	"github.com/zomzem/identity-service/internal/password"
 	"github.com/zomzem/identity-service/internal/repository"
-	"golang.org/x/crypto/bcrypt"
-	"google.golang.org/api/idtoken"
+	"github.com/zomzem/identity-service/internal/signing"
 )
 
 type AuthUseCase interface {
-	Login(ctx context.Context, username, password string) (*LoginResponse, error)
-	LoginGoogle(ctx context.Context, idToken string) (*LoginResponse, error)
-	Refresh(ctx context.Context, refreshToken string) (*LoginResponse, error)
+	Login(ctx context.Context, username, password string, client ClientInfo) (*LoginResponse, error)
+	// LoginOIDC signs in with an ID token issued by the named upstream provider.
+	LoginOIDC(ctx context.Context, provider, idToken string, client ClientInfo) (*LoginResponse, error)
+	ListOIDCProviders() []OIDCProviderResponse
+	// StartOIDCLogin and FinishOIDCLogin run the authorization code flow with
+	// PKCE at the provider, for clients that leave the login to this service.
+	StartOIDCLogin(ctx context.Context, provider, returnTo string) (string, string, error)
+	FinishOIDCLogin(ctx context.Context, provider string, req OIDCCallbackRequest, client ClientInfo) (*LoginResponse, string, error)
+	ListSAMLProviders() []SAMLProviderResponse
+	// SAMLMetadata returns the SP metadata to register at the SAML provider.
+	SAMLMetadata(provider string) ([]byte, error)
+	// StartSAMLLogin and FinishSAMLLogin run an SP-initiated login at the
+	// SAML provider, answered at its assertion consumer service.
+	StartSAMLLogin(ctx context.Context, provider, returnTo string) (string, string, error)
+	FinishSAMLLogin(ctx context.Context, provider string, req SAMLResponseRequest, client ClientInfo) (*LoginResponse, string, error)
+	// StartSAMLLink starts the same login for a signed-in user, linking the
+	// asserted identity to the account when it finishes.
+	StartSAMLLink(ctx context.Context, userID int32, provider, returnTo string) (string, string, error)
+	// VerifyMFA completes a login that Login answered with an MFA challenge.
+	VerifyMFA(ctx context.Context, req MFAVerifyRequest, client ClientInfo) (*LoginResponse, error)
+	// BeginMFAWebAuthn starts the assertion answering an MFA challenge with a security key.
+	BeginMFAWebAuthn(ctx context.Context, mfaToken string) (*WebAuthnCeremonyResponse, error)
+	// BeginWebAuthnLogin and FinishWebAuthnLogin log in with a passkey alone.
+	BeginWebAuthnLogin(ctx context.Context) (*WebAuthnCeremonyResponse, error)
+	FinishWebAuthnLogin(ctx context.Context, req WebAuthnAssertion, client ClientInfo) (*LoginResponse, error)
+	// StartEmailLogin mails a one-time code and link to the account with the
+	// email, if there is one. It succeeds either way so callers cannot probe
+	// for accounts.
+	StartEmailLogin(ctx context.Context, req EmailLoginStartRequest, client ClientInfo) error
+	// VerifyEmailLogin logs in with the code or link token from StartEmailLogin.
+	VerifyEmailLogin(ctx context.Context, req EmailLoginVerifyRequest, client ClientInfo) (*LoginResponse, error)
+	Refresh(ctx context.Context, refreshToken string, client ClientInfo) (*LoginResponse, error)
+	// Logout ends the session of the presented refresh token and, when the
+	// denylist is enabled, revokes the presented access token.
+	Logout(ctx context.Context, refreshToken, accessToken string) error
+	// LogoutAll ends every session of the user owning the presented tokens.
+	LogoutAll(ctx context.Context, refreshToken, accessToken string) error
+	VerifyAccessToken(ctx context.Context, accessToken string) (*AccessTokenClaims, error)
+	Introspect(ctx context.Context, accessToken string) *IntrospectionResponse
 }
 
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected, session revoked")
+	ErrInvalidAccessToken  = errors.New("invalid or expired access token")
+	ErrNoSession           = errors.New("refresh token or access token required")
+)
+
 type authUseCase struct {
-	store  repository.Store
-	config *config.Config
+	store     repository.Store
+	config    *config.Config
+	signer    signing.Signer
+	events    SecurityEventSink
+	lockout   lockoutPolicy
+	phantoms  *phantomLockouts
+	webauthn  *webauthn.WebAuthn
+	notifier  notify.Notifier
+	providers *idp.Registry
+	directory directory.Authenticator
+
+	passwordPolicy password.Policy
+	hasher         password.Hasher
+
+	dummyHash     string
+	dummyHashOnce sync.Once
+}
+
+func NewAuthUseCase(store repository.Store, cfg *config.Config, signer signing.Signer, events SecurityEventSink, wa *webauthn.WebAuthn, providers *idp.Registry, dir directory.Authenticator, notifier notify.Notifier) AuthUseCase {
+	lockout := newLockoutPolicy(cfg)
+	return &authUseCase{
+		store:     store,
+		config:    cfg,
+		signer:    signer,
+		events:    events,
+		lockout:   lockout,
+		phantoms:  newPhantomLockouts(lockout),
+		webauthn:  wa,
+		notifier:  notifier,
+		providers: providers,
+		directory: dir,
+
+		passwordPolicy: newPasswordPolicy(cfg, nil),
+		hasher:         newPasswordHasher(cfg),
+	}
 }
 
-func NewAuthUseCase(store repository.Store, cfg *config.Config) AuthUseCase {
-	return &authUseCase{store: store, config: cfg}
+// ClientInfo describes the client a session is established from.
+type ClientInfo struct {
+	IP         string
+	UserAgent  string
+	ClientName string
 }
 
+// LoginResponse carries either the session tokens or, when the user has MFA
+// enabled, only the MFA challenge to answer at /auth/mfa/verify.
 type LoginResponse struct {
-	AccessToken  string       `json:"accessToken"`
-	RefreshToken string       `json:"refreshToken"`
-	User         UserResponse `json:"user"`
+	AccessToken           string                `json:"accessToken,omitempty"`
+	AccessTokenExpiresAt  time.Time             `json:"accessTokenExpiresAt,omitzero"`
+	RefreshToken          string                `json:"refreshToken,omitempty"`
+	RefreshTokenExpiresAt time.Time             `json:"refreshTokenExpiresAt,omitzero"`
+	MustChangePassword    bool                  `json:"mustChangePassword"`
+	PasswordExpiresAt     *time.Time            `json:"passwordExpiresAt,omitempty"`
+	MFAEnrollmentRequired bool                  `json:"mfaEnrollmentRequired,omitempty"` // AccessToken only enrolls a factor
+	MFA                   *MFAChallengeResponse `json:"mfa,omitempty"`
+	User                  *UserResponse         `json:"user,omitempty"`
 }
 
 type UserResponse struct {
@@ -46,170 +142,369 @@ type UserResponse struct {
 	Permissions []string `json:"permissions"`
 }
 
-func (u *authUseCase) Login(ctx context.Context, username, password string) (*LoginResponse, error) {
-	// 1. Get User
+func (u *authUseCase) Login(ctx context.Context, username, password string, client ClientInfo) (*LoginResponse, error) {
+	attempt := loginAttempt{Username: username, Method: LoginMethodPassword, Outcome: LoginOutcomeFailure}
+
+	// 1. Get User. Unknown usernames go through the same lockout and password
+	// check as existing ones so the responses don't leak which exist.
+	login := username
+	if u.directory != nil {
+		if name, ok := u.directory.Username(login); ok {
+			username = name
+		}
+	}
 	user, err := u.store.GetUserByUsername(ctx, username)
+	if u.usesDirectory(user, err == nil, username) {
+		attempt.Method = LoginMethodLDAP
+		return u.loginDirectory(ctx, user, err == nil, login, username, password, attempt, client)
+	}
 	if err != nil {
-		return nil, errors.New("invalid credentials") // Don't leak exists or not
+		u.recordLoginEvent(ctx, attempt.fail(FailureUnknownUser), client)
+		if until, locked := u.phantoms.check(username); locked {
+			return nil, &AccountLockedError{Until: until}
+		}
+		u.verifyPassword(pgtype.Text{}, password)
+		return nil, u.registerUnknownLogin(username)
 	}
+	attempt.UserID = user.ID
 
-	// 2. Verify Password
-	if user.PasswordHash.Valid {
-		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash.String), []byte(password)); err != nil {
-			return nil, errors.New("invalid credentials")
-		}
-	} else {
-		// External login or no password
-		return nil, errors.New("password not set")
+	// 2. Refuse locked accounts without looking at the password
+	if until, locked := lockedUntil(user); locked {
+		u.recordLoginEvent(ctx, attempt.fail(FailureAccountLocked), client)
+		return nil, &AccountLockedError{Until: until}
 	}
 
-	// 3. Get Permissions
-	var permissions []string
-	perms, err := u.store.GetUserPermissions(ctx, user.ID)
-	if err == nil {
-		for _, p := range perms {
-			permissions = append(permissions, p.PermissionCode)
+	// 3. Verify Password. External logins have no password and always fail.
+	if !u.verifyPassword(user.PasswordHash, password) {
+		reason := FailureInvalidPassword
+		if !user.PasswordHash.Valid {
+			reason = FailurePasswordNotSet
 		}
+		u.recordLoginEvent(ctx, attempt.fail(reason), client)
+		return nil, u.registerFailedLogin(ctx, user)
 	}
+	u.rehashPassword(ctx, user, password)
 
-	// 4. Generate Token
+	// 4. Ask for the second factor before issuing tokens
+	if resp, err := u.challengeMFA(ctx, user, attempt, client); resp != nil || err != nil {
+		return resp, err
+	}
+	u.resetFailedLogins(ctx, user)
 
-	accessToken, refreshToken, err := u.generateTokens(ctx, user)
+	// 5. Generate Tokens
+	tokens, err := u.generateTokens(ctx, user, client)
 	if err != nil {
 		return nil, err
 	}
 
-	// 4. Update Last Login
-	_ = u.store.UpdateUserLastLogin(ctx, repository.UpdateUserLastLoginParams{
-		ID:          user.ID,
-		LastLoginIp: pgtype.Text{Valid: false},
-	})
+	// 6. Update Last Login
+	u.completeLogin(ctx, user, attempt, client)
 
-	// 5. Get Role Code
-	roleCode := ""
-	if user.RoleID.Valid {
-		role, err := u.store.GetRoleById(ctx, user.RoleID.Int32)
-		if err == nil {
-			roleCode = role.Code
-		}
+	return u.newLoginResponse(ctx, user, tokens), nil
+}
+
+func (u *authUseCase) Refresh(ctx context.Context, refreshTokenStr string, client ClientInfo) (*LoginResponse, error) {
+	attempt := loginAttempt{Method: LoginMethodRefresh, Outcome: LoginOutcomeFailure}
+
+	// 1. Look up the token, including revoked ones
+	rt, err := u.store.FindRefreshToken(ctx, hashToken(refreshTokenStr))
+	if err != nil {
+		u.recordLoginEvent(ctx, attempt.fail(FailureInvalidRefreshToken), client)
+		return nil, ErrInvalidRefreshToken
 	}
+	attempt.UserID = rt.UserID
 
-	return &LoginResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		User: UserResponse{
-			ID:          user.ID,
-			Username:    user.Username,
-			FullName:    user.FullName,
-			Avatar:      stringPtr(user.Avatar.String, user.Avatar.Valid),
-			Email:       stringPtr(user.Email.String, user.Email.Valid),
-			Role:        roleCode,
-			Permissions: permissions,
-		},
-	}, nil
-}
+	// 2. An already rotated token must never come back: assume it was stolen
+	if rt.ReplacedBy.Valid {
+		u.revokeFamily(ctx, rt)
+		u.recordLoginEvent(ctx, attempt.fail(FailureRefreshTokenReuse), client)
+		return nil, ErrRefreshTokenReused
+	}
+	if rt.RevokedAt.Valid || !rt.ExpiresAt.Time.After(time.Now()) {
+		u.recordLoginEvent(ctx, attempt.fail(FailureInvalidRefreshToken), client)
+		return nil, ErrInvalidRefreshToken
+	}
 
-func (u *authUseCase) LoginGoogle(ctx context.Context, idTokenStr string) (*LoginResponse, error) {
-	// 1. Verify Google Token
-	payload, err := idtoken.Validate(ctx, idTokenStr, u.config.GoogleClientID)
+	// 3. Get User
+	user, err := u.store.GetUserById(ctx, rt.UserID)
 	if err != nil {
-		log.Printf("[Auth] Google ID Token validation failed: %v (ClientID: %s)", err, u.config.GoogleClientID)
-		return nil, errors.New("invalid google token")
+		u.recordLoginEvent(ctx, attempt.fail(FailureUserNotFound), client)
+		return nil, errors.New("user not found")
 	}
+	attempt.Username = user.Username
 
-	email, _ := payload.Claims["email"].(string)
-	name, _ := payload.Claims["name"].(string)
-	picture, _ := payload.Claims["picture"].(string)
+	// 4. Sessions of roles requiring MFA end until a second factor is enrolled
+	if len(mfaMethods(ctx, u.store, user.ID)) == 0 && roleRequiresMFA(ctx, u.store, user) {
+		if err := u.store.RevokeRefreshToken(ctx, rt.TokenHash); err != nil {
+			return nil, err
+		}
+		return u.mfaEnrollmentResponse(ctx, user, attempt, client)
+	}
 
-	// 2. Check if user exists
-	user, err := u.store.GetUserByEmail(ctx, pgtype.Text{String: email, Valid: true})
+	// 5. Rotate: issue the successor in the same family and mark the current
+	// token as replaced. Losing the race to a concurrent refresh is reuse too.
+	accessTTL, refreshTTL := u.tokenLifetimes(ctx, user)
+	tokens := &issuedTokens{}
+	tokens.AccessToken, tokens.AccessTokenExpiresAt, err = u.signAccessToken(ctx, user, accessTTL, "")
 	if err != nil {
-		// Create user if not found
-		username := email
-		user, err = u.store.CreateUser(ctx, repository.CreateUserParams{
-			Username:     username,
-			PasswordHash: pgtype.Text{Valid: false},
-			FullName:     name,
-			Email:        pgtype.Text{String: email, Valid: true},
-			Avatar:       pgtype.Text{String: picture, Valid: true},
-			Status:       pgtype.Text{String: "ACTIVE", Valid: true},
-		})
+		return nil, err
+	}
+
+	err = u.store.ExecTx(ctx, func(q repository.Querier) error {
+		// The successor keeps the session identity and start, with fresh client details
+		clientName := rt.ClientName
+		if client.ClientName != "" {
+			clientName = textOrNull(client.ClientName)
+		}
+		token, created, err := u.createRefreshToken(ctx, q, repository.CreateRefreshTokenParams{
+			UserID:           user.ID,
+			FamilyID:         rt.FamilyID,
+			UserAgent:        textOrNull(client.UserAgent),
+			IpAddress:        textOrNull(client.IP),
+			ClientName:       clientName,
+			SessionStartedAt: rt.SessionStartedAt,
+		}, refreshTTL)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		
-		// Set as external login
-		_ = u.store.UpdateUserExternalLogin(ctx, repository.UpdateUserExternalLoginParams{
-			ID:            user.ID,
-			ExternalLogin: pgtype.Bool{Bool: true, Valid: true},
+		rows, err := q.RotateRefreshToken(ctx, repository.RotateRefreshTokenParams{
+			ID:         rt.ID,
+			ReplacedBy: pgtype.Int4{Int32: created.ID, Valid: true},
 		})
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrRefreshTokenReused
+		}
+		tokens.RefreshToken = token
+		tokens.RefreshTokenExpiresAt = created.ExpiresAt.Time
+		return nil
+	})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		u.revokeFamily(ctx, rt)
+		u.recordLoginEvent(ctx, attempt.fail(FailureRefreshTokenReuse), client)
+		return nil, err
 	}
-
-	// 3. Generate Tokens
-	accessToken, refreshToken, err := u.generateTokens(ctx, user)
 	if err != nil {
 		return nil, err
 	}
 
-	// 5. Update Last Login
+	attempt.Outcome = LoginOutcomeSuccess
+	u.recordLoginEvent(ctx, attempt, client)
+
+	return u.newLoginResponse(ctx, user, tokens), nil
+}
+
+func (u *authUseCase) Logout(ctx context.Context, refreshTokenStr, accessToken string) error {
+	if refreshTokenStr != "" {
+		if err := u.store.RevokeRefreshToken(ctx, hashToken(refreshTokenStr)); err != nil {
+			return err
+		}
+	}
+	if accessToken != "" {
+		u.denyAccessToken(ctx, accessToken)
+	}
+	return nil
+}
+
+func (u *authUseCase) LogoutAll(ctx context.Context, refreshTokenStr, accessToken string) error {
+	// 1. Resolve the user, preferring the access token
+	var userID int32
+	if accessToken != "" {
+		claims, err := u.VerifyAccessToken(ctx, accessToken)
+		if err != nil {
+			return err
+		}
+		userID = claims.UserID
+	} else if refreshTokenStr != "" {
+		rt, err := u.store.GetRefreshToken(ctx, hashToken(refreshTokenStr))
+		if err != nil {
+			return ErrInvalidRefreshToken
+		}
+		userID = rt.UserID
+	} else {
+		return ErrNoSession
+	}
+
+	// 2. Revoke every refresh token of the user
+	if err := u.store.RevokeUserRefreshTokens(ctx, userID); err != nil {
+		return err
+	}
+	if accessToken != "" {
+		u.denyAccessToken(ctx, accessToken)
+	}
+	return nil
+}
+
+// completeLogin records a successful login on the user and in the login history.
+func (u *authUseCase) completeLogin(ctx context.Context, user repository.User, attempt loginAttempt, client ClientInfo) {
 	_ = u.store.UpdateUserLastLogin(ctx, repository.UpdateUserLastLoginParams{
 		ID:          user.ID,
-		LastLoginIp: pgtype.Text{Valid: false},
+		LastLoginIp: textOrNull(client.IP),
 	})
 
-	// 6. Get Permissions & Role
-	var permissions []string
-	perms, _ := u.store.GetUserPermissions(ctx, user.ID)
-	for _, p := range perms {
-		permissions = append(permissions, p.PermissionCode)
+	attempt.UserID = user.ID
+	attempt.Outcome = LoginOutcomeSuccess
+	u.recordLoginEvent(ctx, attempt, client)
+}
+
+// verifyPassword checks password against hash. Without a hash it verifies
+// against a dummy one so the response takes the same time.
+func (u *authUseCase) verifyPassword(hash pgtype.Text, password string) bool {
+	if !hash.Valid {
+		u.dummyHashOnce.Do(func() {
+			u.dummyHash, _ = u.hasher.Hash("dummy-password")
+		})
+		_, _ = u.hasher.Verify(u.dummyHash, password)
+		return false
 	}
 
-	roleCode := ""
-	if user.RoleID.Valid {
-		role, err := u.store.GetRoleById(ctx, user.RoleID.Int32)
+	ok, err := u.hasher.Verify(hash.String, password)
+	if err != nil {
+		log.Printf("[Auth] Failed to verify password hash: %v", err)
+	}
+	return ok
+}
+
+// rehashPassword upgrades a hash made with an outdated algorithm or cost
+// while the plaintext is at hand. A concurrent password change wins.
+func (u *authUseCase) rehashPassword(ctx context.Context, user repository.User, password string) {
+	if !u.hasher.NeedsRehash(user.PasswordHash.String) {
+		return
+	}
+	hash, err := u.hasher.Hash(password)
+	if err != nil {
+		log.Printf("[Auth] Failed to rehash password of user %d: %v", user.ID, err)
+		return
+	}
+	if _, err := u.store.RehashUserPassword(ctx, repository.RehashUserPasswordParams{
+		ID:      user.ID,
+		NewHash: textOrNull(hash),
+		OldHash: user.PasswordHash,
+	}); err != nil {
+		log.Printf("[Auth] Failed to store rehashed password of user %d: %v", user.ID, err)
+	}
+}
+
+type issuedTokens struct {
+	AccessToken           string
+	AccessTokenExpiresAt  time.Time
+	RefreshToken          string
+	RefreshTokenExpiresAt time.Time
+}
+
+func (u *authUseCase) generateTokens(ctx context.Context, user repository.User, client ClientInfo) (*issuedTokens, error) {
+	accessTTL, refreshTTL := u.tokenLifetimes(ctx, user)
+
+	tokens := &issuedTokens{}
+	var err error
+	tokens.AccessToken, tokens.AccessTokenExpiresAt, err = u.signAccessToken(ctx, user, accessTTL, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// Every login starts a new refresh token family
+	familyID, err := newFamilyID()
+	if err != nil {
+		return nil, err
+	}
+	token, created, err := u.createRefreshToken(ctx, u.store, repository.CreateRefreshTokenParams{
+		UserID:           user.ID,
+		FamilyID:         familyID,
+		UserAgent:        textOrNull(client.UserAgent),
+		IpAddress:        textOrNull(client.IP),
+		ClientName:       textOrNull(client.ClientName),
+		SessionStartedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true},
+	}, refreshTTL)
+	if err != nil {
+		return nil, err
+	}
+	tokens.RefreshToken = token
+	tokens.RefreshTokenExpiresAt = created.ExpiresAt.Time
+
+	return tokens, nil
+}
+
+// tokenLifetimes returns the access and refresh token lifetimes for the user,
+// applying the overrides of their role on top of the global configuration.
+func (u *authUseCase) tokenLifetimes(ctx context.Context, user repository.User) (time.Duration, time.Duration) {
+	accessTTL, refreshTTL := u.config.JWTExpiresIn, u.config.RefreshTokenExpiry
+	if !user.RoleID.Valid {
+		return accessTTL, refreshTTL
+	}
+
+	role, err := u.store.GetRoleById(ctx, user.RoleID.Int32)
+	if err != nil {
+		return accessTTL, refreshTTL
+	}
+	if role.AccessTokenTtlSeconds.Valid {
+		accessTTL = time.Duration(role.AccessTokenTtlSeconds.Int32) * time.Second
+	}
+	if role.RefreshTokenTtlSeconds.Valid {
+		refreshTTL = time.Duration(role.RefreshTokenTtlSeconds.Int32) * time.Second
+	}
+	return accessTTL, refreshTTL
+}
+
+// signAccessToken signs an access token, restricted to scope when not empty.
+func (u *authUseCase) signAccessToken(ctx context.Context, user repository.User, ttl time.Duration, scope string) (string, time.Time, error) {
+	var permissions []string
+	if scope == "" {
+		perms, err := u.store.GetUserPermissions(ctx, user.ID)
 		if err == nil {
-			roleCode = role.Code
+			for _, p := range perms {
+				permissions = append(permissions, p.PermissionCode)
+			}
 		}
 	}
 
-	return &LoginResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		User: UserResponse{
-			ID:          user.ID,
-			Username:    user.Username,
-			FullName:    user.FullName,
-			Avatar:      stringPtr(user.Avatar.String, user.Avatar.Valid),
-			Email:       stringPtr(user.Email.String, user.Email.Valid),
-			Role:        roleCode,
-			Permissions: permissions,
+	jti, err := newTokenID()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	claims := AccessTokenClaims{
+		UserID:      user.ID,
+		Permissions: permissions,
+		Scope:       scope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Subject:   user.Username,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 		},
-	}, nil
-}
+	}
 
-func (u *authUseCase) Refresh(ctx context.Context, refreshTokenStr string) (*LoginResponse, error) {
-	// 1. Verify Refresh Token in DB
-	rt, err := u.store.GetRefreshToken(ctx, refreshTokenStr)
+	token, err := u.signer.Sign(claims)
 	if err != nil {
-		return nil, errors.New("invalid or expired refresh token")
+		return "", time.Time{}, err
 	}
+	return token, expiresAt, nil
+}
 
-	// 2. Get User
-	user, err := u.store.GetUserById(ctx, rt.UserID)
+// createRefreshToken stores a new token described by arg, filling in the
+// token hash and expiry.
+func (u *authUseCase) createRefreshToken(ctx context.Context, q repository.Querier, arg repository.CreateRefreshTokenParams, ttl time.Duration) (string, repository.RefreshToken, error) {
+	refreshTokenStr, err := newOpaqueToken()
 	if err != nil {
-		return nil, errors.New("user not found")
+		return "", repository.RefreshToken{}, err
 	}
 
-	// 3. Revoke current token
-	_ = u.store.RevokeRefreshToken(ctx, refreshTokenStr)
-
-	// 4. Generate new tokens
-	accessToken, newRefreshToken, err := u.generateTokens(ctx, user)
+	// Only the hash is stored, the plaintext goes back to the client
+	arg.TokenHash = hashToken(refreshTokenStr)
+	arg.ExpiresAt = pgtype.Timestamptz{Time: time.Now().Add(ttl), Valid: true}
+	created, err := q.CreateRefreshToken(ctx, arg)
 	if err != nil {
-		return nil, err
+		return "", repository.RefreshToken{}, err
 	}
 
-	// 5. Get Permissions & Role
+	return refreshTokenStr, created, nil
+}
+
+func (u *authUseCase) newLoginResponse(ctx context.Context, user repository.User, tokens *issuedTokens) *LoginResponse {
 	var permissions []string
 	perms, _ := u.store.GetUserPermissions(ctx, user.ID)
 	for _, p := range perms {
@@ -217,17 +512,40 @@ func (u *authUseCase) Refresh(ctx context.Context, refreshTokenStr string) (*Log
 	}
 
 	roleCode := ""
+	requireMFA := false
 	if user.RoleID.Valid {
 		role, err := u.store.GetRoleById(ctx, user.RoleID.Int32)
 		if err == nil {
 			roleCode = role.Code
+			requireMFA = role.RequireMfa
+		}
+	}
+	if requireMFA {
+		requireMFA = len(mfaMethods(ctx, u.store, user.ID)) == 0
+	}
+
+	// Passwords past the maximum age have to be changed like forced ones
+	mustChange := user.MustChangePassword
+	var passwordExpiresAt *time.Time
+	if user.PasswordHash.Valid && u.passwordPolicy.MaxAge > 0 {
+		changedAt := user.PasswordChangedAt.Time
+		if !user.PasswordChangedAt.Valid {
+			changedAt = user.CreatedAt.Time
 		}
+		expiresAt := changedAt.Add(u.passwordPolicy.MaxAge)
+		passwordExpiresAt = &expiresAt
+		mustChange = mustChange || u.passwordPolicy.Expired(changedAt)
 	}
 
 	return &LoginResponse{
-		AccessToken:  accessToken,
-		RefreshToken: newRefreshToken,
-		User: UserResponse{
+		AccessToken:           tokens.AccessToken,
+		AccessTokenExpiresAt:  tokens.AccessTokenExpiresAt,
+		RefreshToken:          tokens.RefreshToken,
+		RefreshTokenExpiresAt: tokens.RefreshTokenExpiresAt,
+		MustChangePassword:    mustChange,
+		PasswordExpiresAt:     passwordExpiresAt,
+		MFAEnrollmentRequired: requireMFA,
+		User: &UserResponse{
 			ID:          user.ID,
 			Username:    user.Username,
 			FullName:    user.FullName,
@@ -236,47 +554,51 @@ func (u *authUseCase) Refresh(ctx context.Context, refreshTokenStr string) (*Log
 			Role:        roleCode,
 			Permissions: permissions,
 		},
-	}, nil
-}
-
-func (u *authUseCase) generateTokens(ctx context.Context, user repository.User) (string, string, error) {
-	// 1. Get Permissions
-	var permissions []string
-	perms, err := u.store.GetUserPermissions(ctx, user.ID)
-	if err == nil {
-		for _, p := range perms {
-			permissions = append(permissions, p.PermissionCode)
-		}
 	}
+}
 
-	// 2. Access Token
-	claims := jwt.MapClaims{
-		"userId":      user.ID,
-		"sub":         user.Username,
-		"permissions": permissions,
-		"exp":         time.Now().Add(15 * time.Minute).Unix(),
+// revokeFamily ends every session descending from the same login.
+func (u *authUseCase) revokeFamily(ctx context.Context, rt repository.RefreshToken) {
+	if err := u.store.RevokeRefreshTokenFamily(ctx, rt.FamilyID); err != nil {
+		log.Printf("[Auth] Failed to revoke refresh token family %s: %v", rt.FamilyID, err)
 	}
+	u.events.Emit(ctx, SecurityEvent{
+		Type:   EventRefreshTokenReuse,
+		UserID: rt.UserID,
+		Details: map[string]string{
+			"familyId": rt.FamilyID.String(),
+			"tokenId":  fmt.Sprint(rt.ID),
+		},
+	})
+}
 
-	at := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	accessToken, err := at.SignedString([]byte(u.config.JWTSecret))
-	if err != nil {
-		return "", "", err
+// newOpaqueToken returns an opaque token with 256 bits of entropy.
+func newOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
 
-	// 3. Refresh Token
-	refreshTokenStr := fmt.Sprintf("%d-%d", user.ID, time.Now().UnixNano()) // Simple token for now
-	expiresAt := time.Now().Add(7 * 24 * time.Hour)
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
 
-	_, err = u.store.CreateRefreshToken(ctx, repository.CreateRefreshTokenParams{
-		UserID:    user.ID,
-		Token:     refreshTokenStr,
-		ExpiresAt: pgtype.Timestamptz{Time: expiresAt, Valid: true},
-	})
-	if err != nil {
-		return "", "", err
+func newFamilyID() (pgtype.UUID, error) {
+	var id pgtype.UUID
+	if _, err := rand.Read(id.Bytes[:]); err != nil {
+		return id, err
 	}
+	id.Bytes[6] = (id.Bytes[6] & 0x0f) | 0x40 // version 4
+	id.Bytes[8] = (id.Bytes[8] & 0x3f) | 0x80 // RFC 4122 variant
+	id.Valid = true
+	return id, nil
+}
 
-	return accessToken, refreshTokenStr, nil
+func textOrNull(s string) pgtype.Text {
+	return pgtype.Text{String: s, Valid: s != ""}
 }
 
 func stringPtr(s string, valid bool) *string {
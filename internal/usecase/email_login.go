@@ -0,0 +1,216 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/zomzem/identity-service/internal/notify"
+	"github.com/zomzem/identity-service/internal/repository"
+)
+
+var ErrInvalidEmailLogin = errors.New("invalid or expired login code")
+
+// emailLoginCodeDigits is short enough to type from a phone; guessing is
+// bounded by EMAIL_LOGIN_MAX_ATTEMPTS per request.
+const emailLoginCodeDigits = 6
+
+type EmailLoginStartRequest struct {
+	Email string `json:"email"`
+}
+
+// EmailLoginVerifyRequest carries either the email and the code, or the
+// token of the link.
+type EmailLoginVerifyRequest struct {
+	Email string `json:"email"`
+	Code  string `json:"code"`
+	Token string `json:"token"`
+}
+
+func (u *authUseCase) StartEmailLogin(ctx context.Context, req EmailLoginStartRequest, client ClientInfo) error {
+	// 1. Find the account. Unknown emails are silently ignored.
+	email := strings.TrimSpace(req.Email)
+	if email == "" {
+		return nil
+	}
+	user, err := u.store.GetUserByEmail(ctx, pgtype.Text{String: email, Valid: true})
+	if err != nil {
+		return nil
+	}
+
+	// 2. Issue a code and link token, invalidating earlier ones
+	token, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+	code, err := newNumericCode(emailLoginCodeDigits)
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(u.config.EmailLoginTTL)
+	err = u.store.ExecTx(ctx, func(q repository.Querier) error {
+		if err := q.InvalidateUserEmailLoginTokens(ctx, user.ID); err != nil {
+			return err
+		}
+		return q.CreateEmailLoginToken(ctx, repository.CreateEmailLoginTokenParams{
+			UserID:    user.ID,
+			TokenHash: hashToken(token),
+			CodeHash:  hashToken(code),
+			ExpiresAt: pgtype.Timestamptz{Time: expiresAt, Valid: true},
+			IpAddress: textOrNull(client.IP),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	// 3. Deliver in the background so the response time does not tell
+	// whether the account exists
+	msg := u.emailLoginMessage(user, code, token, expiresAt)
+	go func() {
+		if err := u.notifier.Notify(context.WithoutCancel(ctx), msg); err != nil {
+			log.Printf("[Auth] Failed to send login code to user %d: %v", user.ID, err)
+		}
+	}()
+
+	if _, err := u.store.DeleteExpiredEmailLoginTokens(ctx); err != nil {
+		log.Printf("[Auth] Failed to purge expired email login tokens: %v", err)
+	}
+	return nil
+}
+
+func (u *authUseCase) VerifyEmailLogin(ctx context.Context, req EmailLoginVerifyRequest, client ClientInfo) (*LoginResponse, error) {
+	attempt := loginAttempt{Username: req.Email, Method: LoginMethodEmail, Outcome: LoginOutcomeFailure}
+
+	// 1. Find the pending login and check the code or token
+	lt, err := u.checkEmailLogin(ctx, req)
+	if err != nil {
+		if errors.Is(err, ErrInvalidEmailLogin) {
+			u.recordLoginEvent(ctx, attempt.fail(FailureInvalidEmailCode), client)
+		}
+		return nil, err
+	}
+	attempt.UserID = lt.UserID
+
+	// 2. Use it up
+	rows, err := u.store.UseEmailLoginToken(ctx, lt.ID)
+	if err != nil {
+		return nil, err
+	}
+	if rows == 0 {
+		u.recordLoginEvent(ctx, attempt.fail(FailureInvalidEmailCode), client)
+		return nil, ErrInvalidEmailLogin
+	}
+
+	user, err := u.store.GetUserById(ctx, lt.UserID)
+	if err != nil {
+		u.recordLoginEvent(ctx, attempt.fail(FailureUserNotFound), client)
+		return nil, ErrInvalidEmailLogin
+	}
+	attempt.Username = user.Username
+
+	// 3. The mailbox replaces the password, a second factor is still asked for
+	if resp, err := u.challengeMFA(ctx, user, attempt, client); resp != nil || err != nil {
+		return resp, err
+	}
+
+	// 4. Generate Tokens
+	tokens, err := u.generateTokens(ctx, user, client)
+	if err != nil {
+		return nil, err
+	}
+
+	// 5. Update Last Login
+	u.completeLogin(ctx, user, attempt, client)
+
+	return u.newLoginResponse(ctx, user, tokens), nil
+}
+
+func (u *authUseCase) checkEmailLogin(ctx context.Context, req EmailLoginVerifyRequest) (repository.EmailLoginToken, error) {
+	if req.Token != "" {
+		lt, err := u.store.GetEmailLoginTokenByHash(ctx, hashToken(req.Token))
+		if err != nil {
+			return lt, ErrInvalidEmailLogin
+		}
+		return lt, nil
+	}
+
+	email := strings.TrimSpace(req.Email)
+	if email == "" {
+		return repository.EmailLoginToken{}, ErrInvalidEmailLogin
+	}
+	user, err := u.store.GetUserByEmail(ctx, pgtype.Text{String: email, Valid: true})
+	if err != nil {
+		return repository.EmailLoginToken{}, ErrInvalidEmailLogin
+	}
+	lt, err := u.store.GetLatestEmailLoginToken(ctx, user.ID)
+	if err != nil {
+		return lt, ErrInvalidEmailLogin
+	}
+
+	// Every guess counts; too many burn the request
+	attempts, err := u.store.IncrementEmailLoginAttempts(ctx, lt.ID)
+	if err != nil {
+		return lt, err
+	}
+	if int(attempts) > u.config.EmailLoginMaxAttempts {
+		_, _ = u.store.UseEmailLoginToken(ctx, lt.ID)
+		return lt, ErrInvalidEmailLogin
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(strings.TrimSpace(req.Code))), []byte(lt.CodeHash)) != 1 {
+		return lt, ErrInvalidEmailLogin
+	}
+	return lt, nil
+}
+
+func (u *authUseCase) emailLoginMessage(user repository.User, code, token string, expiresAt time.Time) notify.Message {
+	link := u.config.EmailLoginURL
+	if link != "" {
+		sep := "?"
+		if strings.Contains(link, "?") {
+			sep = "&"
+		}
+		link += sep + "token=" + url.QueryEscape(token)
+	}
+
+	text := fmt.Sprintf("Hello %s,\n\nYour login code is %s. It expires at %s.",
+		user.FullName, code, expiresAt.UTC().Format(time.RFC1123))
+	if link != "" {
+		text += "\n\nOr log in with this link:\n\n" + link
+	}
+	text += "\n\nIf you did not try to log in, you can ignore this message."
+	return notify.Message{
+		Type:    notify.TypeEmailLogin,
+		UserID:  user.ID,
+		To:      user.Email.String,
+		Subject: "Your login code",
+		Text:    text,
+		Data: map[string]string{
+			"code":      code,
+			"token":     token,
+			"link":      link,
+			"expiresAt": expiresAt.UTC().Format(time.RFC3339),
+		},
+	}
+}
+
+// newNumericCode returns a uniformly random code of n decimal digits.
+func newNumericCode(n int) (string, error) {
+	limit := big.NewInt(1)
+	for range n {
+		limit.Mul(limit, big.NewInt(10))
+	}
+	v, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", n, v), nil
+}
@@ -0,0 +1,175 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/zomzem/identity-service/internal/config"
+	"github.com/zomzem/identity-service/internal/notify"
+	"github.com/zomzem/identity-service/internal/repository"
+	"github.com/zomzem/identity-service/internal/signing"
+)
+
+const testEmail = "jane@example.com"
+
+type emailLoginFixture struct {
+	store *fakeStore
+	inbox *notify.Capture
+	auth  AuthUseCase
+}
+
+func newEmailLoginFixture(t *testing.T) *emailLoginFixture {
+	t.Helper()
+	cfg := &config.Config{
+		EmailLoginTTL:         10 * time.Minute,
+		EmailLoginURL:         "https://app.example.com/login/email",
+		EmailLoginMaxAttempts: 3,
+		JWTExpiresIn:          15 * time.Minute,
+		RefreshTokenExpiry:    24 * time.Hour,
+	}
+	store := newFakeStore(repository.User{ID: 3, Username: "jane", Email: pgtype.Text{String: testEmail, Valid: true}, AuthSource: AuthSourceLocal})
+	inbox := notify.NewCapture()
+	return &emailLoginFixture{
+		store: store,
+		inbox: inbox,
+		auth:  NewAuthUseCase(store, cfg, signing.NewHMACSigner("test-secret"), &recordingEvents{}, nil, nil, nil, inbox),
+	}
+}
+
+// waitForMessages waits for the n-th message, sent in the background, and
+// returns it.
+func waitForMessages(t *testing.T, inbox *notify.Capture, n int) notify.Message {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if msgs := inbox.Messages(); len(msgs) >= n {
+			return msgs[n-1]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("message %d was not sent", n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// start requests a login for jane and returns the n-th message she got.
+func (f *emailLoginFixture) start(t *testing.T, n int) notify.Message {
+	t.Helper()
+	if err := f.auth.StartEmailLogin(context.Background(), EmailLoginStartRequest{Email: testEmail}, ClientInfo{}); err != nil {
+		t.Fatalf("StartEmailLogin: %v", err)
+	}
+	msg := waitForMessages(t, f.inbox, n)
+	if msg.Type != notify.TypeEmailLogin || msg.To != testEmail || msg.UserID != 3 {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+	return msg
+}
+
+func TestEmailLoginWithCode(t *testing.T) {
+	f := newEmailLoginFixture(t)
+	ctx := context.Background()
+	msg := f.start(t, 1)
+	code := msg.Data["code"]
+	if len(code) != emailLoginCodeDigits || !strings.Contains(msg.Text, code) {
+		t.Fatalf("no code in %q", msg.Text)
+	}
+
+	_, err := f.auth.VerifyEmailLogin(ctx, EmailLoginVerifyRequest{Email: testEmail, Code: "not-it"}, ClientInfo{})
+	if !errors.Is(err, ErrInvalidEmailLogin) {
+		t.Fatalf("wrong code: got %v, want ErrInvalidEmailLogin", err)
+	}
+	resp, err := f.auth.VerifyEmailLogin(ctx, EmailLoginVerifyRequest{Email: "Jane@Example.com", Code: code}, ClientInfo{})
+	if err != nil {
+		t.Fatalf("right code: %v", err)
+	}
+	if resp.AccessToken == "" || resp.User.ID != 3 {
+		t.Errorf("unexpected response %+v", resp)
+	}
+
+	_, err = f.auth.VerifyEmailLogin(ctx, EmailLoginVerifyRequest{Email: testEmail, Code: code}, ClientInfo{})
+	if !errors.Is(err, ErrInvalidEmailLogin) {
+		t.Errorf("code used twice: got %v, want ErrInvalidEmailLogin", err)
+	}
+}
+
+func TestEmailLoginWithLink(t *testing.T) {
+	f := newEmailLoginFixture(t)
+	ctx := context.Background()
+	msg := f.start(t, 1)
+	token := msg.Data["token"]
+	if !strings.HasPrefix(msg.Data["link"], "https://app.example.com/login/email?token=") || !strings.Contains(msg.Text, msg.Data["link"]) {
+		t.Fatalf("no link in %q", msg.Text)
+	}
+
+	resp, err := f.auth.VerifyEmailLogin(ctx, EmailLoginVerifyRequest{Token: token}, ClientInfo{})
+	if err != nil {
+		t.Fatalf("link: %v", err)
+	}
+	if resp.AccessToken == "" || resp.User.ID != 3 {
+		t.Errorf("unexpected response %+v", resp)
+	}
+
+	_, err = f.auth.VerifyEmailLogin(ctx, EmailLoginVerifyRequest{Token: token}, ClientInfo{})
+	if !errors.Is(err, ErrInvalidEmailLogin) {
+		t.Errorf("link used twice: got %v, want ErrInvalidEmailLogin", err)
+	}
+	_, err = f.auth.VerifyEmailLogin(ctx, EmailLoginVerifyRequest{Email: testEmail, Code: msg.Data["code"]}, ClientInfo{})
+	if !errors.Is(err, ErrInvalidEmailLogin) {
+		t.Errorf("code of a used link: got %v, want ErrInvalidEmailLogin", err)
+	}
+}
+
+func TestEmailLoginAttemptsBurnTheRequest(t *testing.T) {
+	f := newEmailLoginFixture(t)
+	ctx := context.Background()
+	msg := f.start(t, 1)
+
+	for i := range 3 {
+		_, err := f.auth.VerifyEmailLogin(ctx, EmailLoginVerifyRequest{Email: testEmail, Code: "000000"}, ClientInfo{})
+		if !errors.Is(err, ErrInvalidEmailLogin) {
+			t.Fatalf("wrong code %d: got %v, want ErrInvalidEmailLogin", i+1, err)
+		}
+	}
+	if got := f.store.emailLogins[0].Attempts; got != 3 {
+		t.Errorf("counted %d attempts, want 3", got)
+	}
+
+	// The right code comes too late, and the link of the request is gone with it
+	_, err := f.auth.VerifyEmailLogin(ctx, EmailLoginVerifyRequest{Email: testEmail, Code: msg.Data["code"]}, ClientInfo{})
+	if !errors.Is(err, ErrInvalidEmailLogin) {
+		t.Errorf("right code after the last attempt: got %v, want ErrInvalidEmailLogin", err)
+	}
+	_, err = f.auth.VerifyEmailLogin(ctx, EmailLoginVerifyRequest{Token: msg.Data["token"]}, ClientInfo{})
+	if !errors.Is(err, ErrInvalidEmailLogin) {
+		t.Errorf("link after the last attempt: got %v, want ErrInvalidEmailLogin", err)
+	}
+}
+
+func TestEmailLoginNewRequestReplacesEarlier(t *testing.T) {
+	f := newEmailLoginFixture(t)
+	ctx := context.Background()
+	first := f.start(t, 1)
+	second := f.start(t, 2)
+
+	_, err := f.auth.VerifyEmailLogin(ctx, EmailLoginVerifyRequest{Token: first.Data["token"]}, ClientInfo{})
+	if !errors.Is(err, ErrInvalidEmailLogin) {
+		t.Errorf("earlier link: got %v, want ErrInvalidEmailLogin", err)
+	}
+	if _, err := f.auth.VerifyEmailLogin(ctx, EmailLoginVerifyRequest{Email: testEmail, Code: second.Data["code"]}, ClientInfo{}); err != nil {
+		t.Errorf("latest code: %v", err)
+	}
+}
+
+func TestEmailLoginUnknownEmail(t *testing.T) {
+	f := newEmailLoginFixture(t)
+	if err := f.auth.StartEmailLogin(context.Background(), EmailLoginStartRequest{Email: "nobody@example.com"}, ClientInfo{}); err != nil {
+		t.Fatalf("unknown email: %v", err)
+	}
+	if len(f.store.emailLogins) != 0 || len(f.inbox.Messages()) != 0 {
+		t.Error("a login was started for an unknown email")
+	}
+}
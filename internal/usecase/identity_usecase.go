@@ -0,0 +1,165 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/zomzem/identity-service/internal/idp"
+	"github.com/zomzem/identity-service/internal/repository"
+)
+
+var (
+	ErrIdentityNotFound      = errors.New("linked identity not found")
+	ErrIdentityAlreadyLinked = errors.New("identity is linked to another account")
+	ErrLastLoginMethod       = errors.New("cannot unlink the only way to log in")
+)
+
+// IdentityUseCase manages the upstream provider logins linked to a user.
+type IdentityUseCase interface {
+	ListIdentities(ctx context.Context, userID int32) ([]UserIdentityResponse, error)
+	// LinkIdentity links the login asserted by an ID token of the provider.
+	LinkIdentity(ctx context.Context, userID int32, provider, idToken string) (*UserIdentityResponse, error)
+	UnlinkIdentity(ctx context.Context, userID, id int32) error
+}
+
+type identityUseCase struct {
+	store     repository.Store
+	providers *idp.Registry
+	events    SecurityEventSink
+}
+
+func NewIdentityUseCase(store repository.Store, providers *idp.Registry, events SecurityEventSink) IdentityUseCase {
+	return &identityUseCase{store: store, providers: providers, events: events}
+}
+
+type UserIdentityResponse struct {
+	ID          int32      `json:"id"`
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"subject"`
+	Email       *string    `json:"email"`
+	LastLoginAt *time.Time `json:"lastLoginAt"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+func (u *identityUseCase) ListIdentities(ctx context.Context, userID int32) ([]UserIdentityResponse, error) {
+	rows, err := u.store.ListUserIdentities(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]UserIdentityResponse, 0, len(rows))
+	for _, row := range rows {
+		res = append(res, *newUserIdentityResponse(row))
+	}
+	return res, nil
+}
+
+func (u *identityUseCase) LinkIdentity(ctx context.Context, userID int32, provider, idToken string) (*UserIdentityResponse, error) {
+	// 1. Verify the ID token
+	p, err := u.providers.Get(provider)
+	if err != nil {
+		return nil, ErrUnknownOIDCProvider
+	}
+	identity, err := p.VerifyIDToken(ctx, idToken)
+	if err != nil {
+		log.Printf("[Identity] %s ID token validation failed: %v", provider, err)
+		if errors.Is(err, idp.ErrInvalidIDToken) {
+			return nil, ErrInvalidIDToken
+		}
+		return nil, err
+	}
+
+	// 2. Link it
+	link, err := linkIdentity(ctx, u.store, u.events, userID, identity)
+	if err != nil {
+		return nil, err
+	}
+	return newUserIdentityResponse(link), nil
+}
+
+// linkIdentity links an upstream identity to the user. An identity logs in
+// to one account only, linking it again to the same user is a no-op.
+func linkIdentity(ctx context.Context, store repository.Store, events SecurityEventSink, userID int32, identity *idp.Identity) (repository.UserIdentity, error) {
+	existing, err := store.GetUserIdentity(ctx, repository.GetUserIdentityParams{Provider: identity.Provider, Subject: identity.Subject})
+	if err == nil {
+		if existing.UserID != userID {
+			return repository.UserIdentity{}, ErrIdentityAlreadyLinked
+		}
+		return existing, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return repository.UserIdentity{}, err
+	}
+
+	link, err := store.CreateUserIdentity(ctx, repository.CreateUserIdentityParams{
+		UserID:   userID,
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    textOrNull(identity.Email),
+	})
+	if err != nil {
+		return repository.UserIdentity{}, err
+	}
+
+	events.Emit(ctx, SecurityEvent{
+		Type:    EventIdentityLinked,
+		UserID:  userID,
+		Details: map[string]string{"provider": link.Provider, "identityId": strconv.Itoa(int(link.ID))},
+	})
+	return link, nil
+}
+
+func (u *identityUseCase) UnlinkIdentity(ctx context.Context, userID, id int32) error {
+	user, err := u.store.GetUserById(ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	// Users without a password or passkey must keep one linked login
+	if !user.PasswordHash.Valid {
+		identities, err := u.store.CountUserIdentities(ctx, userID)
+		if err != nil {
+			return err
+		}
+		passkeys, err := u.store.CountUserWebAuthnCredentials(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if identities <= 1 && passkeys == 0 {
+			return ErrLastLoginMethod
+		}
+	}
+
+	rows, err := u.store.DeleteUserIdentity(ctx, repository.DeleteUserIdentityParams{ID: id, UserID: userID})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrIdentityNotFound
+	}
+
+	u.events.Emit(ctx, SecurityEvent{
+		Type:    EventIdentityUnlinked,
+		UserID:  userID,
+		Details: map[string]string{"identityId": strconv.Itoa(int(id))},
+	})
+	return nil
+}
+
+func newUserIdentityResponse(i repository.UserIdentity) *UserIdentityResponse {
+	return &UserIdentityResponse{
+		ID:          i.ID,
+		Provider:    i.Provider,
+		Subject:     i.Subject,
+		Email:       stringPtr(i.Email.String, i.Email.Valid),
+		LastLoginAt: timePtr(i.LastLoginAt),
+		CreatedAt:   i.CreatedAt.Time,
+	}
+}
@@ -0,0 +1,339 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/zomzem/identity-service/internal/config"
+	"github.com/zomzem/identity-service/internal/repository"
+	"github.com/zomzem/identity-service/internal/signing"
+)
+
+type KeyUseCase interface {
+	// Bootstrap makes sure an ACTIVE and a NEXT key exist and loads the ring.
+	Bootstrap(ctx context.Context) error
+	// Refresh retires expired keys, rotates when the active key is due and reloads the ring.
+	Refresh(ctx context.Context) error
+	Rotate(ctx context.Context) ([]SigningKeyResponse, error)
+	ListKeys(ctx context.Context) ([]SigningKeyResponse, error)
+	// Run calls Refresh on every JWT_KEY_REFRESH_INTERVAL tick until ctx is done.
+	Run(ctx context.Context)
+}
+
+type keyUseCase struct {
+	store  repository.Store
+	config *config.Config
+	ring   *signing.KeyRing // nil when used outside the server (keyctl)
+	sealer *signing.Sealer
+}
+
+func NewKeyUseCase(store repository.Store, cfg *config.Config, ring *signing.KeyRing) (KeyUseCase, error) {
+	sealer, err := signing.NewSealer(cfg.KeyEncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("JWT_KEY_ENCRYPTION_KEY: %w", err)
+	}
+	return &keyUseCase{store: store, config: cfg, ring: ring, sealer: sealer}, nil
+}
+
+type SigningKeyResponse struct {
+	Kid         string     `json:"kid"`
+	Algorithm   string     `json:"algorithm"`
+	State       string     `json:"state"`
+	ActivatedAt *time.Time `json:"activatedAt"`
+	RetireAt    *time.Time `json:"retireAt"`
+	RetiredAt   *time.Time `json:"retiredAt"`
+	CreatedAt   *time.Time `json:"createdAt"`
+}
+
+func (u *keyUseCase) Bootstrap(ctx context.Context) error {
+	var imported *signing.Key
+	if u.config.JWTPrivateKeyFile != "" {
+		key, err := signing.LoadKeyFile(u.config.JWTPrivateKeyFile, u.config.JWTSigningAlg, u.config.JWTKeyID)
+		if err != nil {
+			return err
+		}
+		imported = key
+	}
+
+	err := u.store.ExecTx(ctx, func(q repository.Querier) error {
+		if err := q.LockSigningKeys(ctx); err != nil {
+			return err
+		}
+		keys, err := q.ListSigningKeys(ctx)
+		if err != nil {
+			return err
+		}
+
+		if err := u.sealPlaintextKeys(ctx, q, keys); err != nil {
+			return err
+		}
+
+		if findKey(keys, signing.StateActive) == nil {
+			key := imported
+			if key == nil || containsKid(keys, key.ID) {
+				if key, err = signing.GenerateKey(u.algorithm(keys)); err != nil {
+					return err
+				}
+			}
+			if err := u.createKey(ctx, q, key, signing.StateActive); err != nil {
+				return err
+			}
+			log.Printf("[Keys] Activated signing key %s (%s)", key.ID, key.Algorithm)
+
+			if keys, err = q.ListSigningKeys(ctx); err != nil {
+				return err
+			}
+		}
+
+		if findKey(keys, signing.StateNext) == nil {
+			return u.generateKey(ctx, q, keys, signing.StateNext)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return u.reload(ctx)
+}
+
+func (u *keyUseCase) Refresh(ctx context.Context) error {
+	err := u.store.ExecTx(ctx, func(q repository.Querier) error {
+		if err := q.LockSigningKeys(ctx); err != nil {
+			return err
+		}
+		retired, err := q.RetireExpiredSigningKeys(ctx)
+		if err != nil {
+			return err
+		}
+		if retired > 0 {
+			log.Printf("[Keys] Retired %d signing key(s)", retired)
+		}
+
+		if u.config.JWTKeyRotationInterval <= 0 {
+			return nil
+		}
+		keys, err := q.ListPublishedSigningKeys(ctx)
+		if err != nil {
+			return err
+		}
+		active := findKey(keys, signing.StateActive)
+		if active != nil && active.ActivatedAt.Valid &&
+			time.Since(active.ActivatedAt.Time) < u.config.JWTKeyRotationInterval {
+			return nil
+		}
+		return u.rotate(ctx, q, keys)
+	})
+	if err != nil {
+		return err
+	}
+	return u.reload(ctx)
+}
+
+func (u *keyUseCase) Rotate(ctx context.Context) ([]SigningKeyResponse, error) {
+	err := u.store.ExecTx(ctx, func(q repository.Querier) error {
+		if err := q.LockSigningKeys(ctx); err != nil {
+			return err
+		}
+		keys, err := q.ListPublishedSigningKeys(ctx)
+		if err != nil {
+			return err
+		}
+		return u.rotate(ctx, q, keys)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := u.reload(ctx); err != nil {
+		return nil, err
+	}
+	return u.ListKeys(ctx)
+}
+
+func (u *keyUseCase) ListKeys(ctx context.Context) ([]SigningKeyResponse, error) {
+	keys, err := u.store.ListSigningKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]SigningKeyResponse, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, SigningKeyResponse{
+			Kid:         k.Kid,
+			Algorithm:   k.Algorithm,
+			State:       k.State,
+			ActivatedAt: timePtr(k.ActivatedAt),
+			RetireAt:    timePtr(k.RetireAt),
+			RetiredAt:   timePtr(k.RetiredAt),
+			CreatedAt:   timePtr(k.CreatedAt),
+		})
+	}
+	return res, nil
+}
+
+func (u *keyUseCase) Run(ctx context.Context) {
+	ticker := time.NewTicker(u.config.JWTKeyRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := u.Refresh(ctx); err != nil {
+				log.Printf("[Keys] Refresh failed: %v", err)
+			}
+		}
+	}
+}
+
+// rotate moves ACTIVE to RETIRING, promotes the oldest NEXT key and
+// generates a new NEXT key. Must run inside the signing_keys lock.
+func (u *keyUseCase) rotate(ctx context.Context, q repository.Querier, keys []repository.SigningKey) error {
+	retireAt := time.Now().Add(u.config.JWTKeyRetireAfter)
+	if err := q.RetireActiveSigningKeys(ctx, pgtype.Timestamptz{Time: retireAt, Valid: true}); err != nil {
+		return err
+	}
+
+	// Keys are listed newest first, so the last NEXT key is the one that has
+	// been published the longest.
+	var next *repository.SigningKey
+	for i := range keys {
+		if keys[i].State == signing.StateNext {
+			next = &keys[i]
+		}
+	}
+
+	if next != nil {
+		if err := q.ActivateSigningKey(ctx, next.ID); err != nil {
+			return err
+		}
+		log.Printf("[Keys] Promoted signing key %s to ACTIVE", next.Kid)
+	} else {
+		if err := u.generateKey(ctx, q, keys, signing.StateActive); err != nil {
+			return err
+		}
+	}
+	return u.generateKey(ctx, q, keys, signing.StateNext)
+}
+
+func (u *keyUseCase) generateKey(ctx context.Context, q repository.Querier, keys []repository.SigningKey, state string) error {
+	key, err := signing.GenerateKey(u.algorithm(keys))
+	if err != nil {
+		return err
+	}
+	if err := u.createKey(ctx, q, key, state); err != nil {
+		return err
+	}
+	log.Printf("[Keys] Generated %s signing key %s (%s)", state, key.ID, key.Algorithm)
+	return nil
+}
+
+func (u *keyUseCase) createKey(ctx context.Context, q repository.Querier, key *signing.Key, state string) error {
+	pemStr, err := key.EncodePEM()
+	if err != nil {
+		return err
+	}
+	sealed, err := u.sealer.Seal(key.ID, pemStr)
+	if err != nil {
+		return err
+	}
+	_, err = q.CreateSigningKey(ctx, repository.CreateSigningKeyParams{
+		Kid:         key.ID,
+		Algorithm:   key.Algorithm,
+		PrivateKey:  sealed,
+		State:       state,
+		ActivatedAt: pgtype.Timestamptz{Time: time.Now(), Valid: state == signing.StateActive},
+	})
+	return err
+}
+
+// sealPlaintextKeys encrypts keys stored before JWT_KEY_ENCRYPTION_KEY was
+// introduced. Must run inside the signing_keys lock.
+func (u *keyUseCase) sealPlaintextKeys(ctx context.Context, q repository.Querier, keys []repository.SigningKey) error {
+	for _, k := range keys {
+		if signing.IsSealed(k.PrivateKey) {
+			continue
+		}
+		sealed, err := u.sealer.Seal(k.Kid, k.PrivateKey)
+		if err != nil {
+			return err
+		}
+		if err := q.UpdateSigningKeyPrivateKey(ctx, repository.UpdateSigningKeyPrivateKeyParams{ID: k.ID, PrivateKey: sealed}); err != nil {
+			return err
+		}
+		log.Printf("[Keys] Encrypted signing key %s at rest", k.Kid)
+	}
+	return nil
+}
+
+// reload loads every published key into the ring, reusing keys it already parsed.
+func (u *keyUseCase) reload(ctx context.Context) error {
+	if u.ring == nil {
+		return nil
+	}
+
+	keys, err := u.store.ListPublishedSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	ringKeys := make([]signing.RingKey, 0, len(keys))
+	for _, k := range keys {
+		key, ok := u.ring.Lookup(k.Kid)
+		if !ok {
+			pemStr, err := u.sealer.Open(k.Kid, k.PrivateKey)
+			if err != nil {
+				return fmt.Errorf("signing key %s: %w", k.Kid, err)
+			}
+			priv, err := signing.ParsePrivateKeyPEM([]byte(pemStr))
+			if err != nil {
+				return err
+			}
+			if key, err = signing.NewKey(priv, k.Algorithm, k.Kid); err != nil {
+				return err
+			}
+		}
+		ringKeys = append(ringKeys, signing.RingKey{Key: key, State: k.State})
+	}
+	return u.ring.Replace(ringKeys)
+}
+
+// algorithm picks the algorithm for newly generated keys: the configured one,
+// otherwise the one of the current active key.
+func (u *keyUseCase) algorithm(keys []repository.SigningKey) string {
+	if u.config.JWTSigningAlg != "" {
+		return u.config.JWTSigningAlg
+	}
+	if active := findKey(keys, signing.StateActive); active != nil {
+		return active.Algorithm
+	}
+	return "RS256"
+}
+
+func findKey(keys []repository.SigningKey, state string) *repository.SigningKey {
+	for i := range keys {
+		if keys[i].State == state {
+			return &keys[i]
+		}
+	}
+	return nil
+}
+
+func containsKid(keys []repository.SigningKey, kid string) bool {
+	for _, k := range keys {
+		if k.Kid == kid {
+			return true
+		}
+	}
+	return false
+}
+
+func timePtr(t pgtype.Timestamptz) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
@@ -0,0 +1,187 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/zomzem/identity-service/internal/config"
+	"github.com/zomzem/identity-service/internal/directory"
+	"github.com/zomzem/identity-service/internal/idp"
+	"github.com/zomzem/identity-service/internal/repository"
+)
+
+// Where a user's password is checked
+const (
+	AuthSourceLocal = "LOCAL"
+	AuthSourceLDAP  = "LDAP"
+)
+
+var ErrDirectoryUnavailable = errors.New("directory unavailable, try again later")
+
+// NewDirectory configures the LDAP credential backend. It returns nil when
+// LDAP_URL is not set.
+func NewDirectory(cfg *config.Config) (directory.Authenticator, error) {
+	if cfg.LDAPURL == "" {
+		return nil, nil
+	}
+	groupRoles, err := parseGroupRoles(cfg.LDAPGroupRoles)
+	if err != nil {
+		return nil, err
+	}
+	return directory.NewLDAPAuthenticator(directory.Config{
+		URL:                cfg.LDAPURL,
+		StartTLS:           cfg.LDAPStartTLS,
+		CAFile:             cfg.LDAPTLSCAFile,
+		InsecureSkipVerify: cfg.LDAPTLSInsecureSkipVerify,
+		Timeout:            cfg.LDAPTimeout,
+		UserDNTemplate:     cfg.LDAPUserDNTemplate,
+		BindDN:             cfg.LDAPBindDN,
+		BindPassword:       cfg.LDAPBindPassword,
+		BaseDN:             cfg.LDAPBaseDN,
+		UserFilter:         cfg.LDAPUserFilter,
+		EmailAttribute:     cfg.LDAPEmailAttribute,
+		NameAttribute:      cfg.LDAPNameAttribute,
+		GroupsAttribute:    cfg.LDAPGroupsAttribute,
+		UsernameDomains:    cfg.LDAPUsernameDomains,
+		GroupRoles:         groupRoles,
+		DefaultRole:        cfg.LDAPDefaultRole,
+	})
+}
+
+// parseGroupRoles reads "<group>=><role>;..." pairs. Group DNs contain commas
+// and equal signs, hence the separators.
+func parseGroupRoles(s string) ([]directory.GroupRole, error) {
+	var res []directory.GroupRole
+	for _, pair := range strings.Split(s, ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		group, role, ok := strings.Cut(pair, "=>")
+		group, role = strings.TrimSpace(group), strings.TrimSpace(role)
+		if !ok || group == "" || role == "" {
+			return nil, fmt.Errorf("LDAP_GROUP_ROLES: invalid entry %q", pair)
+		}
+		res = append(res, directory.GroupRole{Group: group, Role: role})
+	}
+	return res, nil
+}
+
+// usesDirectory reports whether the password of a login is checked by LDAP:
+// for users marked so and for unknown logins of a directory domain.
+func (u *authUseCase) usesDirectory(user repository.User, found bool, username string) bool {
+	if u.directory == nil {
+		return false
+	}
+	if found {
+		return user.AuthSource == AuthSourceLDAP
+	}
+	_, ok := u.directory.Username(username)
+	return ok
+}
+
+// loginDirectory checks the password of login with the directory. username
+// is the account name the login maps to.
+func (u *authUseCase) loginDirectory(ctx context.Context, user repository.User, found bool, login, username, password string, attempt loginAttempt, client ClientInfo) (*LoginResponse, error) {
+	// 1. Refuse locked accounts without asking the directory
+	if found {
+		if until, locked := lockedUntil(user); locked {
+			u.recordLoginEvent(ctx, attempt.fail(FailureAccountLocked), client)
+			return nil, &AccountLockedError{Until: until}
+		}
+	} else if until, locked := u.phantoms.check(username); locked {
+		u.recordLoginEvent(ctx, attempt.fail(FailureUnknownUser), client)
+		return nil, &AccountLockedError{Until: until}
+	}
+
+	// 2. Bind as the user
+	entry, err := u.directory.Authenticate(ctx, login, password)
+	if err != nil {
+		if !errors.Is(err, directory.ErrInvalidCredentials) {
+			log.Printf("[Auth] LDAP authentication of %q failed: %v", login, err)
+			return nil, ErrDirectoryUnavailable
+		}
+		u.recordLoginEvent(ctx, attempt.fail(FailureInvalidPassword), client)
+		if !found {
+			return nil, u.registerUnknownLogin(username)
+		}
+		return nil, u.registerFailedLogin(ctx, user)
+	}
+
+	// 3. Create the account on first login, keep the role in line with the groups
+	role := u.directory.Role(entry.Groups)
+	if !found {
+		user, err = u.provisionDirectoryUser(ctx, username, entry, role)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		u.syncDirectoryRole(ctx, &user, role)
+	}
+	attempt.UserID = user.ID
+
+	// 4. Ask for the second factor before issuing tokens
+	if resp, err := u.challengeMFA(ctx, user, attempt, client); resp != nil || err != nil {
+		return resp, err
+	}
+	u.resetFailedLogins(ctx, user)
+
+	// 5. Generate Tokens
+	tokens, err := u.generateTokens(ctx, user, client)
+	if err != nil {
+		return nil, err
+	}
+
+	// 6. Update Last Login
+	u.completeLogin(ctx, user, attempt, client)
+
+	return u.newLoginResponse(ctx, user, tokens), nil
+}
+
+func (u *authUseCase) provisionDirectoryUser(ctx context.Context, username string, entry *directory.Entry, role string) (repository.User, error) {
+	identity := &idp.Identity{Provider: "ldap", Subject: entry.DN, Email: entry.Email, Name: entry.Name, Groups: entry.Groups}
+	if identity.Name == "" {
+		identity.Name = username
+	}
+
+	var user repository.User
+	err := u.store.ExecTx(ctx, func(q repository.Querier) error {
+		var err error
+		user, err = provisionUser(ctx, q, username, identity, role)
+		if err != nil {
+			return err
+		}
+		user.AuthSource = AuthSourceLDAP
+		return q.UpdateUserAuthSource(ctx, repository.UpdateUserAuthSourceParams{ID: user.ID, AuthSource: AuthSourceLDAP})
+	})
+	if err != nil {
+		return user, err
+	}
+	log.Printf("[Auth] Provisioned user %d from LDAP entry %s", user.ID, entry.DN)
+	return user, nil
+}
+
+// syncDirectoryRole gives the user the role mapped from their groups. Users
+// matching no mapping and without a default role keep theirs.
+func (u *authUseCase) syncDirectoryRole(ctx context.Context, user *repository.User, roleCode string) {
+	if roleCode == "" {
+		return
+	}
+	role, err := u.store.GetRoleByCode(ctx, roleCode)
+	if err != nil {
+		log.Printf("[Auth] LDAP role %q not found: %v", roleCode, err)
+		return
+	}
+	if user.RoleID.Valid && user.RoleID.Int32 == role.ID {
+		return
+	}
+	roleID := pgtype.Int4{Int32: role.ID, Valid: true}
+	if err := u.store.UpdateUserRole(ctx, repository.UpdateUserRoleParams{ID: user.ID, RoleID: roleID}); err != nil {
+		log.Printf("[Auth] Failed to update role of user %d: %v", user.ID, err)
+		return
+	}
+	user.RoleID = roleID
+}
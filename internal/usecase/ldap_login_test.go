@@ -0,0 +1,75 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zomzem/identity-service/internal/config"
+	"github.com/zomzem/identity-service/internal/directory"
+	"github.com/zomzem/identity-service/internal/signing"
+)
+
+// fakeDirectory knows jane of corp.example.com, or CORP, with one password.
+// Account names are mapped as the LDAP authenticator does.
+type fakeDirectory struct {
+	directory.Authenticator
+	logins []string
+}
+
+func (d *fakeDirectory) Authenticate(ctx context.Context, login, password string) (*directory.Entry, error) {
+	d.logins = append(d.logins, login)
+	if name, _ := d.Username(login); name != "jane@corp.example.com" || password != testPassword {
+		return nil, directory.ErrInvalidCredentials
+	}
+	return &directory.Entry{DN: "CN=Jane Doe,OU=Users,DC=corp,DC=example,DC=com", Email: "jane@corp.example.com", Name: "Jane Doe"}, nil
+}
+
+func (d *fakeDirectory) Username(login string) (string, bool) {
+	if user, ok := strings.CutPrefix(strings.ToLower(login), `corp\`); ok {
+		return user + "@corp.example.com", true
+	}
+	if user, ok := strings.CutSuffix(strings.ToLower(login), "@corp.example.com"); ok {
+		return user + "@corp.example.com", true
+	}
+	return "", false
+}
+
+func (d *fakeDirectory) Role(groups []string) string { return "" }
+
+func TestDirectoryLoginFormsShareOneAccount(t *testing.T) {
+	cfg := &config.Config{
+		LockoutThreshold:    3,
+		LockoutBaseDuration: time.Minute,
+		LockoutMaxDuration:  time.Hour,
+		JWTExpiresIn:        15 * time.Minute,
+		RefreshTokenExpiry:  24 * time.Hour,
+	}
+	store := newFakeStore()
+	dir := &fakeDirectory{}
+	auth := NewAuthUseCase(store, cfg, signing.NewHMACSigner("test-secret"), &recordingEvents{}, nil, nil, dir, nil)
+
+	var ids []int32
+	for _, login := range []string{`CORP\jane`, "jane@corp.example.com", "Jane@Corp.Example.com"} {
+		resp, err := auth.Login(context.Background(), login, testPassword, ClientInfo{})
+		if err != nil {
+			t.Fatalf("Login(%q): %v", login, err)
+		}
+		ids = append(ids, resp.User.ID)
+	}
+	if ids[0] != ids[1] || ids[1] != ids[2] {
+		t.Errorf("logins went to different accounts %v", ids)
+	}
+	if len(store.users) != 1 {
+		t.Fatalf("provisioned %d accounts, want 1", len(store.users))
+	}
+	user := store.users[ids[0]]
+	if user.Username != "jane@corp.example.com" || user.AuthSource != AuthSourceLDAP {
+		t.Errorf("unexpected account %q from %s", user.Username, user.AuthSource)
+	}
+	// The directory still gets the login as typed
+	if dir.logins[0] != `CORP\jane` {
+		t.Errorf("directory asked for %q", dir.logins[0])
+	}
+}
@@ -0,0 +1,229 @@
+package usecase
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/zomzem/identity-service/internal/config"
+	"github.com/zomzem/identity-service/internal/repository"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrAccountLocked      = errors.New("account temporarily locked")
+)
+
+// AccountLockedError is returned by Login while an account is locked out.
+// It matches ErrAccountLocked with errors.Is.
+type AccountLockedError struct {
+	Until time.Time
+}
+
+func (e *AccountLockedError) Error() string {
+	return ErrAccountLocked.Error()
+}
+
+func (e *AccountLockedError) Is(target error) bool {
+	return target == ErrAccountLocked
+}
+
+// RetryAfter returns how long the client has to wait, rounded up to whole seconds.
+func (e *AccountLockedError) RetryAfter() time.Duration {
+	d := time.Until(e.Until).Round(time.Second)
+	if d < time.Second {
+		return time.Second
+	}
+	return d
+}
+
+// lockoutPolicy locks an account for base after threshold consecutive
+// failures, doubling the duration with every further lockout up to max.
+type lockoutPolicy struct {
+	threshold int
+	base      time.Duration
+	max       time.Duration
+}
+
+func newLockoutPolicy(cfg *config.Config) lockoutPolicy {
+	return lockoutPolicy{
+		threshold: cfg.LockoutThreshold,
+		base:      cfg.LockoutBaseDuration,
+		max:       cfg.LockoutMaxDuration,
+	}
+}
+
+func (p lockoutPolicy) enabled() bool {
+	return p.threshold > 0
+}
+
+// duration returns the length of the next lockout after previous lockouts.
+func (p lockoutPolicy) duration(previous int32) time.Duration {
+	d := p.base
+	for i := int32(0); i < previous && d < p.max; i++ {
+		d *= 2
+	}
+	return min(d, p.max)
+}
+
+// phantomRetention is how long the state of an unknown username is kept after
+// its last failure, and phantomMaxEntries how many usernames are tracked.
+const (
+	phantomRetention  = 24 * time.Hour
+	phantomMaxEntries = 10000
+)
+
+// phantomLockouts runs the lockout policy for usernames that do not exist, so
+// that unknown and existing accounts get the same responses. The state is kept
+// in memory only, in least recently failed order: a username spray evicts the
+// oldest entries rather than growing the map.
+type phantomLockouts struct {
+	mu      sync.Mutex
+	policy  lockoutPolicy
+	entries map[string]*list.Element // of *phantomLockout
+	order   *list.List               // most recent failure first
+}
+
+type phantomLockout struct {
+	username    string
+	failures    int32
+	lockouts    int32
+	lockedUntil time.Time
+	lastFailure time.Time
+}
+
+func newPhantomLockouts(policy lockoutPolicy) *phantomLockouts {
+	return &phantomLockouts{policy: policy, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+// check returns the end of the current lockout of username, if any.
+func (p *phantomLockouts) check(username string) (time.Time, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	el, ok := p.entries[username]
+	if !ok {
+		return time.Time{}, false
+	}
+	e := el.Value.(*phantomLockout)
+	if !e.lockedUntil.After(time.Now()) {
+		return time.Time{}, false
+	}
+	return e.lockedUntil, true
+}
+
+// fail registers a failed attempt and returns the lockout it triggered, if any.
+func (p *phantomLockouts) fail(username string) (time.Time, bool) {
+	if !p.policy.enabled() {
+		return time.Time{}, false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	var e *phantomLockout
+	if el, ok := p.entries[username]; ok {
+		e = el.Value.(*phantomLockout)
+		p.order.MoveToFront(el)
+	} else {
+		e = &phantomLockout{username: username}
+		p.entries[username] = p.order.PushFront(e)
+	}
+	e.lastFailure = now
+	p.evict(now)
+
+	e.failures++
+	if int(e.failures) < p.policy.threshold {
+		return time.Time{}, false
+	}
+
+	e.lockedUntil = now.Add(p.policy.duration(e.lockouts))
+	e.lockouts++
+	e.failures = 0
+	return e.lockedUntil, true
+}
+
+// evict drops entries past the retention and, beyond phantomMaxEntries, the
+// least recently failed ones. Each call removes from the back of the list
+// only, so the work per failure stays constant on average. Lockouts end at
+// most policy.max after the last failure, the retention outlasts them.
+func (p *phantomLockouts) evict(now time.Time) {
+	retention := max(phantomRetention, p.policy.max)
+	for el := p.order.Back(); el != nil; el = p.order.Back() {
+		e := el.Value.(*phantomLockout)
+		if p.order.Len() <= phantomMaxEntries && now.Sub(e.lastFailure) <= retention {
+			return
+		}
+		p.order.Remove(el)
+		delete(p.entries, e.username)
+	}
+}
+
+// lockedUntil returns the end of the user's current lockout, if any.
+func lockedUntil(user repository.User) (time.Time, bool) {
+	if !user.LockedUntil.Valid || !user.LockedUntil.Time.After(time.Now()) {
+		return time.Time{}, false
+	}
+	return user.LockedUntil.Time, true
+}
+
+// registerFailedLogin counts a failed password or second factor for the user
+// and locks the account once the threshold is reached. It returns the error for the client.
+func (u *authUseCase) registerFailedLogin(ctx context.Context, user repository.User) error {
+	if !u.lockout.enabled() {
+		return ErrInvalidCredentials
+	}
+
+	counts, err := u.store.RegisterFailedLogin(ctx, user.ID)
+	if err != nil {
+		log.Printf("[Auth] Failed to count failed login for user %d: %v", user.ID, err)
+		return ErrInvalidCredentials
+	}
+	if int(counts.FailedLoginAttempts) < u.lockout.threshold {
+		return ErrInvalidCredentials
+	}
+
+	until := time.Now().Add(u.lockout.duration(counts.LockoutCount))
+	if err := u.store.LockUser(ctx, repository.LockUserParams{
+		ID:          user.ID,
+		LockedUntil: pgtype.Timestamptz{Time: until, Valid: true},
+	}); err != nil {
+		log.Printf("[Auth] Failed to lock user %d: %v", user.ID, err)
+		return ErrInvalidCredentials
+	}
+
+	u.events.Emit(ctx, SecurityEvent{
+		Type:   EventAccountLocked,
+		UserID: user.ID,
+		Details: map[string]string{
+			"username":    user.Username,
+			"lockedUntil": until.UTC().Format(time.RFC3339),
+		},
+	})
+	return &AccountLockedError{Until: until}
+}
+
+// resetFailedLogins clears the failure count of a user who completed a login.
+// Logins with a second factor only count as completed once it is verified, so
+// a known password does not reset the guesses at the code.
+func (u *authUseCase) resetFailedLogins(ctx context.Context, user repository.User) {
+	if user.FailedLoginAttempts == 0 && user.LockoutCount == 0 && !user.LockedUntil.Valid {
+		return
+	}
+	if err := u.store.ResetFailedLogins(ctx, user.ID); err != nil {
+		log.Printf("[Auth] Failed to reset failed logins for user %d: %v", user.ID, err)
+	}
+}
+
+// registerUnknownLogin is registerFailedLogin for usernames that do not exist.
+func (u *authUseCase) registerUnknownLogin(username string) error {
+	if until, locked := u.phantoms.fail(username); locked {
+		return &AccountLockedError{Until: until}
+	}
+	return ErrInvalidCredentials
+}
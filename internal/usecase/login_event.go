@@ -0,0 +1,222 @@
+package usecase
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/zomzem/identity-service/internal/repository"
+)
+
+// Login methods, the values of login_events.method
+const (
+	LoginMethodPassword = "PASSWORD"
+	LoginMethodGoogle   = "GOOGLE" // upstream OIDC providers log their upper-cased name
+	LoginMethodRefresh  = "REFRESH"
+	LoginMethodMFA      = "MFA"
+	LoginMethodWebAuthn = "WEBAUTHN"
+	LoginMethodEmail    = "EMAIL"
+	LoginMethodSAML     = "SAML"
+	LoginMethodLDAP     = "LDAP"
+)
+
+// Login outcomes
+const (
+	LoginOutcomeSuccess = "SUCCESS"
+	LoginOutcomeFailure = "FAILURE"
+	// The password was right, a second factor is still needed
+	LoginOutcomeMFARequired = "MFA_REQUIRED"
+	// The role requires a second factor the user still has to enroll
+	LoginOutcomeMFAEnrollment = "MFA_ENROLLMENT"
+)
+
+// Failure reasons
+const (
+	FailureUnknownUser         = "UNKNOWN_USER"
+	FailureInvalidPassword     = "INVALID_PASSWORD"
+	FailurePasswordNotSet      = "PASSWORD_NOT_SET"
+	FailureAccountLocked       = "ACCOUNT_LOCKED"
+	FailureInvalidMFAChallenge = "INVALID_MFA_CHALLENGE"
+	FailureInvalidMFACode      = "INVALID_MFA_CODE"
+	FailureMFAAttemptsExceeded = "MFA_ATTEMPTS_EXCEEDED"
+	FailureInvalidWebAuthn     = "INVALID_WEBAUTHN_ASSERTION"
+	FailureInvalidEmailCode    = "INVALID_EMAIL_CODE"
+	FailureInvalidIDToken      = "INVALID_ID_TOKEN"
+	FailureInvalidSAMLResponse = "INVALID_SAML_RESPONSE"
+	FailureEmailNotVerified    = "EMAIL_NOT_VERIFIED"
+	FailureDomainNotAllowed    = "DOMAIN_NOT_ALLOWED"
+	FailureNotProvisioned      = "NOT_PROVISIONED"
+	FailureLinkRequired        = "LINK_REQUIRED"
+	FailureInvalidRefreshToken = "INVALID_REFRESH_TOKEN"
+	FailureRefreshTokenReuse   = "REFRESH_TOKEN_REUSE"
+	FailureUserNotFound        = "USER_NOT_FOUND"
+)
+
+// loginAttempt is recorded in login_events. UserID is 0 when the user could not be resolved.
+type loginAttempt struct {
+	UserID        int32
+	Username      string
+	Method        string
+	Outcome       string
+	FailureReason string
+}
+
+// fail returns a copy of the attempt marked as failed for reason.
+func (a loginAttempt) fail(reason string) loginAttempt {
+	a.Outcome = LoginOutcomeFailure
+	a.FailureReason = reason
+	return a
+}
+
+// recordLoginEvent is best effort: a failing audit insert must not block logins.
+func (u *authUseCase) recordLoginEvent(ctx context.Context, attempt loginAttempt, client ClientInfo) {
+	err := u.store.CreateLoginEvent(ctx, repository.CreateLoginEventParams{
+		UserID:        pgtype.Int4{Int32: attempt.UserID, Valid: attempt.UserID != 0},
+		Username:      textOrNull(attempt.Username),
+		Method:        attempt.Method,
+		Outcome:       attempt.Outcome,
+		FailureReason: textOrNull(attempt.FailureReason),
+		IpAddress:     textOrNull(client.IP),
+		UserAgent:     textOrNull(client.UserAgent),
+	})
+	if err != nil {
+		log.Printf("[Auth] Failed to record login event for %q: %v", attempt.Username, err)
+	}
+}
+
+type LoginEventUseCase interface {
+	ListUserLoginHistory(ctx context.Context, userID int32, page PageRequest) (*LoginEventPage, error)
+	ListLoginEvents(ctx context.Context, filter LoginEventFilter, page PageRequest) (*LoginEventPage, error)
+}
+
+type loginEventUseCase struct {
+	store repository.Store
+}
+
+func NewLoginEventUseCase(store repository.Store) LoginEventUseCase {
+	return &loginEventUseCase{store: store}
+}
+
+// PageRequest is a 1-based page with its size, clamped by Normalize.
+type PageRequest struct {
+	Page     int32
+	PageSize int32
+}
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+func (p PageRequest) Normalize() PageRequest {
+	if p.Page < 1 {
+		p.Page = 1
+	}
+	if p.PageSize < 1 {
+		p.PageSize = defaultPageSize
+	}
+	if p.PageSize > maxPageSize {
+		p.PageSize = maxPageSize
+	}
+	return p
+}
+
+func (p PageRequest) offset() int32 {
+	return (p.Page - 1) * p.PageSize
+}
+
+// LoginEventFilter narrows /auth/events. Zero values match everything.
+type LoginEventFilter struct {
+	UserID   *int32
+	Username string
+	Method   string
+	Outcome  string
+	IP       string
+	Since    *time.Time
+	Until    *time.Time
+}
+
+type LoginEventResponse struct {
+	ID            int64      `json:"id"`
+	UserID        *int32     `json:"userId"`
+	Username      *string    `json:"username"`
+	Method        string     `json:"method"`
+	Outcome       string     `json:"outcome"`
+	FailureReason *string    `json:"failureReason"`
+	IP            *string    `json:"ip"`
+	UserAgent     *string    `json:"userAgent"`
+	CreatedAt     *time.Time `json:"createdAt"`
+}
+
+type LoginEventPage struct {
+	Items    []LoginEventResponse `json:"items"`
+	Total    int64                `json:"total"`
+	Page     int32                `json:"page"`
+	PageSize int32                `json:"pageSize"`
+}
+
+func (u *loginEventUseCase) ListUserLoginHistory(ctx context.Context, userID int32, page PageRequest) (*LoginEventPage, error) {
+	return u.ListLoginEvents(ctx, LoginEventFilter{UserID: &userID}, page)
+}
+
+func (u *loginEventUseCase) ListLoginEvents(ctx context.Context, filter LoginEventFilter, page PageRequest) (*LoginEventPage, error) {
+	page = page.Normalize()
+
+	count := repository.CountLoginEventsParams{
+		UserID:    pgtype.Int4{Int32: getInt32(filter.UserID), Valid: filter.UserID != nil},
+		Username:  textOrNull(filter.Username),
+		Method:    textOrNull(filter.Method),
+		Outcome:   textOrNull(filter.Outcome),
+		IpAddress: textOrNull(filter.IP),
+		Since:     timestamptzOrNull(filter.Since),
+		Until:     timestamptzOrNull(filter.Until),
+	}
+	total, err := u.store.CountLoginEvents(ctx, count)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := u.store.ListLoginEvents(ctx, repository.ListLoginEventsParams{
+		UserID:     count.UserID,
+		Username:   count.Username,
+		Method:     count.Method,
+		Outcome:    count.Outcome,
+		IpAddress:  count.IpAddress,
+		Since:      count.Since,
+		Until:      count.Until,
+		PageLimit:  page.PageSize,
+		PageOffset: page.offset(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := &LoginEventPage{
+		Items:    make([]LoginEventResponse, 0, len(events)),
+		Total:    total,
+		Page:     page.Page,
+		PageSize: page.PageSize,
+	}
+	for _, e := range events {
+		res.Items = append(res.Items, LoginEventResponse{
+			ID:            e.ID,
+			UserID:        int32Ptr(e.UserID.Int32, e.UserID.Valid),
+			Username:      stringPtr(e.Username.String, e.Username.Valid),
+			Method:        e.Method,
+			Outcome:       e.Outcome,
+			FailureReason: stringPtr(e.FailureReason.String, e.FailureReason.Valid),
+			IP:            stringPtr(e.IpAddress.String, e.IpAddress.Valid),
+			UserAgent:     stringPtr(e.UserAgent.String, e.UserAgent.Valid),
+			CreatedAt:     timePtr(e.CreatedAt),
+		})
+	}
+	return res, nil
+}
+
+func timestamptzOrNull(t *time.Time) pgtype.Timestamptz {
+	if t == nil {
+		return pgtype.Timestamptz{}
+	}
+	return pgtype.Timestamptz{Time: *t, Valid: true}
+}
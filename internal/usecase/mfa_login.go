@@ -0,0 +1,170 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/zomzem/identity-service/internal/repository"
+)
+
+// challengeMFA answers a login whose first factor was verified with an MFA
+// challenge if the user has a second factor, with an enrollment token if their
+// role requires one they lack, or nil to issue tokens right away.
+func (u *authUseCase) challengeMFA(ctx context.Context, user repository.User, attempt loginAttempt, client ClientInfo) (*LoginResponse, error) {
+	methods := mfaMethods(ctx, u.store, user.ID)
+	if len(methods) == 0 {
+		if roleRequiresMFA(ctx, u.store, user) {
+			return u.mfaEnrollmentResponse(ctx, user, attempt, client)
+		}
+		return nil, nil
+	}
+	challenge, err := u.startMFAChallenge(ctx, user, methods, client)
+	if err != nil {
+		return nil, err
+	}
+	attempt.Outcome = LoginOutcomeMFARequired
+	u.recordLoginEvent(ctx, attempt, client)
+	return &LoginResponse{MFA: challenge}, nil
+}
+
+// mfaEnrollmentResponse answers with an access token only good for enrolling
+// a second factor and no session. Logging in again afterwards gets a challenge.
+func (u *authUseCase) mfaEnrollmentResponse(ctx context.Context, user repository.User, attempt loginAttempt, client ClientInfo) (*LoginResponse, error) {
+	token, expiresAt, err := u.signAccessToken(ctx, user, u.config.JWTExpiresIn, ScopeMFAEnrollment)
+	if err != nil {
+		return nil, err
+	}
+	attempt.UserID = user.ID
+	attempt.Outcome = LoginOutcomeMFAEnrollment
+	u.recordLoginEvent(ctx, attempt, client)
+	return u.newLoginResponse(ctx, user, &issuedTokens{AccessToken: token, AccessTokenExpiresAt: expiresAt}), nil
+}
+
+// startMFAChallenge creates the challenge a login with a verified password
+// has to answer with a second factor before it gets tokens.
+func (u *authUseCase) startMFAChallenge(ctx context.Context, user repository.User, methods []string, client ClientInfo) (*MFAChallengeResponse, error) {
+	token, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(u.config.MFAChallengeTTL)
+	if _, err := u.store.CreateMFAChallenge(ctx, repository.CreateMFAChallengeParams{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: pgtype.Timestamptz{Time: expiresAt, Valid: true},
+		IpAddress: textOrNull(client.IP),
+	}); err != nil {
+		return nil, err
+	}
+
+	return &MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    token,
+		ExpiresAt:   expiresAt,
+		Methods:     methods,
+	}, nil
+}
+
+func (u *authUseCase) VerifyMFA(ctx context.Context, req MFAVerifyRequest, client ClientInfo) (*LoginResponse, error) {
+	attempt := loginAttempt{Method: LoginMethodMFA, Outcome: LoginOutcomeFailure}
+
+	// 1. Get Challenge
+	challenge, err := u.store.GetMFAChallenge(ctx, hashToken(req.MFAToken))
+	if err != nil {
+		u.recordLoginEvent(ctx, attempt.fail(FailureInvalidMFAChallenge), client)
+		return nil, ErrInvalidMFAChallenge
+	}
+	attempt.UserID = challenge.UserID
+
+	user, err := u.store.GetUserById(ctx, challenge.UserID)
+	if err != nil {
+		u.recordLoginEvent(ctx, attempt.fail(FailureUserNotFound), client)
+		return nil, ErrInvalidMFAChallenge
+	}
+	attempt.Username = user.Username
+
+	// 2. Refuse locked accounts, failed codes lock them like failed passwords
+	if until, locked := lockedUntil(user); locked {
+		u.recordLoginEvent(ctx, attempt.fail(FailureAccountLocked), client)
+		return nil, &AccountLockedError{Until: until}
+	}
+
+	// 3. Count the attempt; a challenge that was guessed at too often is burnt
+	attempts, err := u.store.IncrementMFAChallengeAttempts(ctx, challenge.ID)
+	if err != nil {
+		return nil, err
+	}
+	if int(attempts) > u.config.MFAMaxAttempts {
+		_, _ = u.store.UseMFAChallenge(ctx, challenge.ID)
+		u.recordLoginEvent(ctx, attempt.fail(FailureMFAAttemptsExceeded), client)
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	// 4. Verify the second factor. Failures count against the account, new
+	// challenges do not give an attacker knowing the password fresh guesses.
+	ok, err := u.verifySecondFactor(ctx, user, req)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		u.recordLoginEvent(ctx, attempt.fail(FailureInvalidMFACode), client)
+		if err := u.registerFailedLogin(ctx, user); errors.Is(err, ErrAccountLocked) {
+			_, _ = u.store.UseMFAChallenge(ctx, challenge.ID)
+			return nil, err
+		}
+		return nil, ErrInvalidMFACode
+	}
+
+	// 5. Use up the challenge, losing a race with a concurrent verify
+	used, err := u.store.UseMFAChallenge(ctx, challenge.ID)
+	if err != nil {
+		return nil, err
+	}
+	if used == 0 {
+		u.recordLoginEvent(ctx, attempt.fail(FailureInvalidMFAChallenge), client)
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	u.resetFailedLogins(ctx, user)
+
+	// 6. Generate Tokens
+	tokens, err := u.generateTokens(ctx, user, client)
+	if err != nil {
+		return nil, err
+	}
+	u.completeLogin(ctx, user, attempt, client)
+
+	if _, err := u.store.DeleteExpiredMFAChallenges(ctx); err != nil {
+		log.Printf("[Auth] Failed to delete expired MFA challenges: %v", err)
+	}
+
+	return u.newLoginResponse(ctx, user, tokens), nil
+}
+
+func (u *authUseCase) verifySecondFactor(ctx context.Context, user repository.User, req MFAVerifyRequest) (bool, error) {
+	if req.WebAuthn != nil {
+		return u.verifyWebAuthnFactor(ctx, user, *req.WebAuthn)
+	}
+	if req.RecoveryCode != "" {
+		ok, err := useRecoveryCode(ctx, u.store, user.ID, req.RecoveryCode)
+		if ok {
+			remaining, _ := u.store.CountUnusedRecoveryCodes(ctx, user.ID)
+			u.events.Emit(ctx, SecurityEvent{
+				Type:    EventRecoveryCodeUsed,
+				UserID:  user.ID,
+				Details: map[string]string{"remaining": strconv.FormatInt(remaining, 10)},
+			})
+		}
+		return ok, err
+	}
+
+	factor, enabled := confirmedTOTP(ctx, u.store, user.ID)
+	if !enabled {
+		return false, nil
+	}
+	return useTOTPCode(ctx, u.store, factor, req.Code)
+}
@@ -0,0 +1,138 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/zomzem/identity-service/internal/config"
+	"github.com/zomzem/identity-service/internal/password"
+	"github.com/zomzem/identity-service/internal/repository"
+	"github.com/zomzem/identity-service/internal/signing"
+	"github.com/zomzem/identity-service/internal/totp"
+)
+
+const testPassword = "correct horse battery staple"
+
+type mfaFixture struct {
+	store  *fakeStore
+	auth   AuthUseCase
+	secret string
+}
+
+// newMFAFixture returns user 7 with a password and TOTP, locked after three
+// consecutive failures.
+func newMFAFixture(t *testing.T) *mfaFixture {
+	t.Helper()
+	cfg := &config.Config{
+		PasswordHashAlgorithm: password.AlgorithmBcrypt,
+		BcryptCost:            4,
+		LockoutThreshold:      3,
+		LockoutBaseDuration:   time.Minute,
+		LockoutMaxDuration:    time.Hour,
+		MFAChallengeTTL:       5 * time.Minute,
+		MFAMaxAttempts:        5,
+		JWTExpiresIn:          15 * time.Minute,
+		RefreshTokenExpiry:    24 * time.Hour,
+	}
+	hash, err := password.NewBcryptHasher(cfg.BcryptCost).Hash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := newFakeStore(repository.User{ID: 7, Username: "jane", AuthSource: AuthSourceLocal, PasswordHash: pgtype.Text{String: hash, Valid: true}})
+	store.totps[7] = repository.UserTotp{UserID: 7, Secret: secret, ConfirmedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true}}
+	return &mfaFixture{
+		store:  store,
+		auth:   NewAuthUseCase(store, cfg, signing.NewHMACSigner("test-secret"), &recordingEvents{}, nil, nil, nil, nil),
+		secret: secret,
+	}
+}
+
+// challenge logs in with the password and returns the MFA token.
+func (f *mfaFixture) challenge(t *testing.T) string {
+	t.Helper()
+	resp, err := f.auth.Login(context.Background(), "jane", testPassword, ClientInfo{})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if resp.MFA == nil {
+		t.Fatal("Login issued tokens without asking for the second factor")
+	}
+	return resp.MFA.MFAToken
+}
+
+func (f *mfaFixture) code(t *testing.T) string {
+	t.Helper()
+	code, err := totp.Code(f.secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func (f *mfaFixture) failedAttempts() int32 {
+	f.store.mu.Lock()
+	defer f.store.mu.Unlock()
+	return f.store.users[7].FailedLoginAttempts
+}
+
+func TestVerifyMFALocksAccountAfterFailedCodes(t *testing.T) {
+	f := newMFAFixture(t)
+	ctx := context.Background()
+
+	// Wrong codes and recovery codes count against the account...
+	_, err := f.auth.VerifyMFA(ctx, MFAVerifyRequest{MFAToken: f.challenge(t), Code: "000000"}, ClientInfo{})
+	if !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("wrong code: got %v, want ErrInvalidMFACode", err)
+	}
+	_, err = f.auth.VerifyMFA(ctx, MFAVerifyRequest{MFAToken: f.challenge(t), RecoveryCode: "AAAA-BBBB"}, ClientInfo{})
+	if !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("wrong recovery code: got %v, want ErrInvalidMFACode", err)
+	}
+	// ...and the password that starts a new challenge does not reset them
+	pending := f.challenge(t)
+	if got := f.failedAttempts(); got != 2 {
+		t.Fatalf("got %d failed attempts after a new challenge, want 2", got)
+	}
+
+	var locked *AccountLockedError
+	_, err = f.auth.VerifyMFA(ctx, MFAVerifyRequest{MFAToken: f.challenge(t), Code: "000000"}, ClientInfo{})
+	if !errors.As(err, &locked) {
+		t.Fatalf("third wrong code: got %v, want AccountLockedError", err)
+	}
+
+	// Locked, not even the right code of an earlier challenge gets in
+	_, err = f.auth.VerifyMFA(ctx, MFAVerifyRequest{MFAToken: pending, Code: f.code(t)}, ClientInfo{})
+	if !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("right code while locked: got %v, want ErrAccountLocked", err)
+	}
+	if _, err := f.auth.Login(ctx, "jane", testPassword, ClientInfo{}); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("password while locked: got %v, want ErrAccountLocked", err)
+	}
+}
+
+func TestVerifyMFAResetsFailedAttempts(t *testing.T) {
+	f := newMFAFixture(t)
+	ctx := context.Background()
+
+	token := f.challenge(t)
+	if _, err := f.auth.VerifyMFA(ctx, MFAVerifyRequest{MFAToken: token, Code: "000000"}, ClientInfo{}); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("wrong code: got %v, want ErrInvalidMFACode", err)
+	}
+	resp, err := f.auth.VerifyMFA(ctx, MFAVerifyRequest{MFAToken: token, Code: f.code(t)}, ClientInfo{})
+	if err != nil {
+		t.Fatalf("right code: %v", err)
+	}
+	if resp.AccessToken == "" {
+		t.Error("no access token after the second factor")
+	}
+	if got := f.failedAttempts(); got != 0 {
+		t.Errorf("got %d failed attempts after a login, want 0", got)
+	}
+}
@@ -0,0 +1,386 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/zomzem/identity-service/internal/config"
+	"github.com/zomzem/identity-service/internal/repository"
+	"github.com/zomzem/identity-service/internal/totp"
+)
+
+var (
+	ErrMFAAlreadyEnabled   = errors.New("mfa is already enabled")
+	ErrMFANotEnabled       = errors.New("mfa is not enabled")
+	ErrMFANotPending       = errors.New("no mfa enrollment in progress")
+	ErrMFARequiredByRole   = errors.New("mfa is required for your role")
+	ErrInvalidMFACode      = errors.New("invalid mfa code")
+	ErrInvalidMFAChallenge = errors.New("invalid or expired mfa challenge")
+)
+
+// MFA methods offered in a login challenge
+const (
+	MFAMethodTOTP         = "totp"
+	MFAMethodWebAuthn     = "webauthn"
+	MFAMethodRecoveryCode = "recovery_code"
+)
+
+type MFAUseCase interface {
+	GetStatus(ctx context.Context, userID int32) (*MFAStatusResponse, error)
+	// StartTOTPEnrollment creates a new secret. MFA is only enabled once
+	// ConfirmTOTPEnrollment proves the authenticator works.
+	StartTOTPEnrollment(ctx context.Context, userID int32) (*TOTPEnrollmentResponse, error)
+	ConfirmTOTPEnrollment(ctx context.Context, userID int32, code string) (*RecoveryCodesResponse, error)
+	DisableTOTP(ctx context.Context, userID int32, code string) error
+	RegenerateRecoveryCodes(ctx context.Context, userID int32, code string) (*RecoveryCodesResponse, error)
+	// ResetUserMFA removes every factor of a user, for admins helping a
+	// user who lost their authenticator and recovery codes.
+	ResetUserMFA(ctx context.Context, userID int32) error
+}
+
+type mfaUseCase struct {
+	store  repository.Store
+	config *config.Config
+	events SecurityEventSink
+}
+
+func NewMFAUseCase(store repository.Store, cfg *config.Config, events SecurityEventSink) MFAUseCase {
+	return &mfaUseCase{store: store, config: cfg, events: events}
+}
+
+type MFAStatusResponse struct {
+	TOTPEnabled            bool  `json:"totpEnabled"`
+	TOTPPending            bool  `json:"totpPending"`
+	WebAuthnCredentials    int64 `json:"webauthnCredentials"`
+	RecoveryCodesRemaining int64 `json:"recoveryCodesRemaining"`
+	Required               bool  `json:"required"`
+}
+
+type TOTPEnrollmentResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningUri"`
+}
+
+// RecoveryCodesResponse is the only time the codes are shown.
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// MFAChallengeResponse replaces the tokens of a login that needs a second factor.
+type MFAChallengeResponse struct {
+	MFARequired bool      `json:"mfaRequired"`
+	MFAToken    string    `json:"mfaToken"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	Methods     []string  `json:"methods"`
+}
+
+// MFAVerifyRequest answers a login challenge with one of the offered methods.
+type MFAVerifyRequest struct {
+	MFAToken     string             `json:"mfaToken"`
+	Code         string             `json:"code"`
+	RecoveryCode string             `json:"recoveryCode"`
+	WebAuthn     *WebAuthnAssertion `json:"webauthn"`
+}
+
+func (u *mfaUseCase) GetStatus(ctx context.Context, userID int32) (*MFAStatusResponse, error) {
+	user, err := u.store.GetUserById(ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	res := &MFAStatusResponse{Required: roleRequiresMFA(ctx, u.store, user)}
+	factor, err := u.store.GetUserTOTP(ctx, userID)
+	if err == nil {
+		res.TOTPEnabled = factor.ConfirmedAt.Valid
+		res.TOTPPending = !factor.ConfirmedAt.Valid
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	res.WebAuthnCredentials, err = u.store.CountUserWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	res.RecoveryCodesRemaining, err = u.store.CountUnusedRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (u *mfaUseCase) StartTOTPEnrollment(ctx context.Context, userID int32) (*TOTPEnrollmentResponse, error) {
+	user, err := u.store.GetUserById(ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := u.store.UpsertPendingUserTOTP(ctx, repository.UpsertPendingUserTOTPParams{
+		UserID: userID,
+		Secret: secret,
+	}); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrMFAAlreadyEnabled
+		}
+		return nil, err
+	}
+
+	account := user.Username
+	if user.Email.Valid && user.Email.String != "" {
+		account = user.Email.String
+	}
+	return &TOTPEnrollmentResponse{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(u.config.MFAIssuer, account, secret),
+	}, nil
+}
+
+func (u *mfaUseCase) ConfirmTOTPEnrollment(ctx context.Context, userID int32, code string) (*RecoveryCodesResponse, error) {
+	// 1. Check the code against the pending secret
+	factor, err := u.store.GetUserTOTP(ctx, userID)
+	if err != nil || factor.ConfirmedAt.Valid {
+		return nil, ErrMFANotPending
+	}
+	step, ok := totp.Validate(factor.Secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	// 2. Enable the factor and hand out fresh recovery codes
+	var codes []string
+	err = u.store.ExecTx(ctx, func(q repository.Querier) error {
+		rows, err := q.ConfirmUserTOTP(ctx, repository.ConfirmUserTOTPParams{
+			UserID:       userID,
+			LastUsedStep: pgtype.Int8{Int64: step, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrMFANotPending
+		}
+		codes, err = replaceRecoveryCodes(ctx, q, userID, u.config.MFARecoveryCodes)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	u.events.Emit(ctx, SecurityEvent{Type: EventMFAEnabled, UserID: userID})
+	return &RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+func (u *mfaUseCase) DisableTOTP(ctx context.Context, userID int32, code string) error {
+	user, err := u.store.GetUserById(ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	if roleRequiresMFA(ctx, u.store, user) {
+		// Security keys keep satisfying the role without the authenticator app
+		count, err := u.store.CountUserWebAuthnCredentials(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrMFARequiredByRole
+		}
+	}
+	if err := u.verifyTOTP(ctx, userID, code); err != nil {
+		return err
+	}
+
+	err = u.store.ExecTx(ctx, func(q repository.Querier) error {
+		if err := q.DeleteUserTOTP(ctx, userID); err != nil {
+			return err
+		}
+		return q.DeleteUserRecoveryCodes(ctx, userID)
+	})
+	if err != nil {
+		return err
+	}
+	u.events.Emit(ctx, SecurityEvent{Type: EventMFADisabled, UserID: userID})
+	return nil
+}
+
+func (u *mfaUseCase) RegenerateRecoveryCodes(ctx context.Context, userID int32, code string) (*RecoveryCodesResponse, error) {
+	if err := u.verifyTOTP(ctx, userID, code); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err := u.store.ExecTx(ctx, func(q repository.Querier) error {
+		var err error
+		codes, err = replaceRecoveryCodes(ctx, q, userID, u.config.MFARecoveryCodes)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+func (u *mfaUseCase) ResetUserMFA(ctx context.Context, userID int32) error {
+	if _, err := u.store.GetUserById(ctx, userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	if err := u.removeFactors(ctx, userID); err != nil {
+		return err
+	}
+	u.events.Emit(ctx, SecurityEvent{Type: EventMFAReset, UserID: userID})
+	return nil
+}
+
+// verifyTOTP checks a code of the user's enabled authenticator.
+func (u *mfaUseCase) verifyTOTP(ctx context.Context, userID int32, code string) error {
+	factor, err := u.store.GetUserTOTP(ctx, userID)
+	if err != nil || !factor.ConfirmedAt.Valid {
+		return ErrMFANotEnabled
+	}
+	ok, err := useTOTPCode(ctx, u.store, factor, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (u *mfaUseCase) removeFactors(ctx context.Context, userID int32) error {
+	return u.store.ExecTx(ctx, func(q repository.Querier) error {
+		if err := q.DeleteUserTOTP(ctx, userID); err != nil {
+			return err
+		}
+		if err := q.DeleteUserRecoveryCodes(ctx, userID); err != nil {
+			return err
+		}
+		if err := q.DeleteUserWebAuthnCredentials(ctx, userID); err != nil {
+			return err
+		}
+		return q.DeleteUserMFAChallenges(ctx, userID)
+	})
+}
+
+// mfaMethods lists the second factors the user can answer a login challenge
+// with, none if MFA is not enabled.
+func mfaMethods(ctx context.Context, q repository.Querier, userID int32) []string {
+	var methods []string
+	if _, enabled := confirmedTOTP(ctx, q, userID); enabled {
+		methods = append(methods, MFAMethodTOTP)
+	}
+	if count, err := q.CountUserWebAuthnCredentials(ctx, userID); err == nil && count > 0 {
+		methods = append(methods, MFAMethodWebAuthn)
+	}
+	if len(methods) == 0 {
+		return nil
+	}
+	if count, err := q.CountUnusedRecoveryCodes(ctx, userID); err == nil && count > 0 {
+		methods = append(methods, MFAMethodRecoveryCode)
+	}
+	return methods
+}
+
+// confirmedTOTP returns the user's authenticator if MFA is enabled.
+func confirmedTOTP(ctx context.Context, q repository.Querier, userID int32) (repository.UserTotp, bool) {
+	factor, err := q.GetUserTOTP(ctx, userID)
+	if err != nil || !factor.ConfirmedAt.Valid {
+		return factor, false
+	}
+	return factor, true
+}
+
+// useTOTPCode accepts a code at most once: a code for a step not newer than
+// the last accepted one is a replay.
+func useTOTPCode(ctx context.Context, q repository.Querier, factor repository.UserTotp, code string) (bool, error) {
+	step, ok := totp.Validate(factor.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	rows, err := q.UseUserTOTPStep(ctx, repository.UseUserTOTPStepParams{
+		UserID:       factor.UserID,
+		LastUsedStep: pgtype.Int8{Int64: step, Valid: true},
+	})
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+func useRecoveryCode(ctx context.Context, q repository.Querier, userID int32, code string) (bool, error) {
+	rows, err := q.UseRecoveryCode(ctx, repository.UseRecoveryCodeParams{
+		UserID:   userID,
+		CodeHash: hashToken(normalizeRecoveryCode(code)),
+	})
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// replaceRecoveryCodes invalidates the user's codes and returns n new ones.
+func replaceRecoveryCodes(ctx context.Context, q repository.Querier, userID int32, n int) ([]string, error) {
+	if err := q.DeleteUserRecoveryCodes(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, n)
+	for range n {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		if err := q.CreateRecoveryCode(ctx, repository.CreateRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: hashToken(normalizeRecoveryCode(code)),
+		}); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// newRecoveryCode returns 50 random bits as "xxxxx-xxxxx".
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	s := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:10]
+	return s[:5] + "-" + s[5:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func roleRequiresMFA(ctx context.Context, q repository.Querier, user repository.User) bool {
+	if !user.RoleID.Valid {
+		return false
+	}
+	role, err := q.GetRoleById(ctx, user.RoleID.Int32)
+	return err == nil && role.RequireMfa
+}
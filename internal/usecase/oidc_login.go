@@ -0,0 +1,290 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/zomzem/identity-service/internal/config"
+	"github.com/zomzem/identity-service/internal/idp"
+	"github.com/zomzem/identity-service/internal/repository"
+)
+
+var (
+	ErrUnknownOIDCProvider = errors.New("unknown identity provider")
+	ErrInvalidIDToken      = errors.New("invalid id token")
+	ErrEmailNotVerified    = errors.New("email address not verified by identity provider")
+	ErrDomainNotAllowed    = errors.New("domain not allowed to log in")
+	ErrUserNotProvisioned  = errors.New("no account for this email, ask for an invitation")
+	ErrAccountLinkRequired = errors.New("an account with this email exists, log in to it and link the provider")
+)
+
+// legacyGoogleProvider is the provider GOOGLE_CLIENT_ID configures, which
+// replaced the Google-only login.
+const legacyGoogleProvider = "google"
+
+type OIDCProviderResponse struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// NewIdentityProviders builds the registry of upstream OIDC and SAML providers.
+func NewIdentityProviders(cfg *config.Config) (*idp.Registry, error) {
+	configs := make([]idp.Config, 0, len(cfg.OIDCProviders))
+	for _, p := range cfg.OIDCProviders {
+		configs = append(configs, idp.Config{
+			Name:                 p.Name,
+			DisplayName:          p.DisplayName,
+			Issuer:               p.Issuer,
+			ClientID:             p.ClientID,
+			ClientSecret:         p.ClientSecret,
+			Scopes:               p.Scopes,
+			RequireVerifiedEmail: p.RequireVerifiedEmail,
+			Claims: idp.ClaimMapping{
+				Subject:       p.ClaimSubject,
+				Email:         p.ClaimEmail,
+				EmailVerified: p.ClaimEmailVerified,
+				Name:          p.ClaimName,
+				Picture:       p.ClaimPicture,
+				Username:      p.ClaimUsername,
+				Groups:        p.ClaimGroups,
+				HostedDomain:  p.ClaimHostedDomain,
+			},
+			Provisioning: provisioningRules(p.Provisioning, p.AllowedDomains, p.DefaultRole, p.DomainRoles),
+		})
+	}
+	registry := idp.NewRegistry(configs...)
+	if err := addSAMLProviders(registry, cfg); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+func provisioningRules(mode string, allowedDomains []string, defaultRole string, domainRoles map[string]string) idp.ProvisioningRules {
+	return idp.ProvisioningRules{
+		InviteOnly:     mode == "invite_only",
+		AllowedDomains: allowedDomains,
+		DefaultRole:    defaultRole,
+		DomainRoles:    domainRoles,
+	}
+}
+
+func (u *authUseCase) ListOIDCProviders() []OIDCProviderResponse {
+	res := make([]OIDCProviderResponse, 0)
+	for _, p := range u.providers.List() {
+		cfg := p.Config()
+		res = append(res, OIDCProviderResponse{Name: cfg.Name, DisplayName: cfg.DisplayName})
+	}
+	return res
+}
+
+func (u *authUseCase) LoginOIDC(ctx context.Context, provider, idToken string, client ClientInfo) (*LoginResponse, error) {
+	p, err := u.providers.Get(provider)
+	if err != nil {
+		return nil, ErrUnknownOIDCProvider
+	}
+	attempt := loginAttempt{Method: strings.ToUpper(provider), Outcome: LoginOutcomeFailure}
+
+	// 1. Verify the ID token against the provider's keys
+	identity, err := p.VerifyIDToken(ctx, idToken)
+	if err != nil {
+		log.Printf("[Auth] %s ID token validation failed: %v", provider, err)
+		u.recordLoginEvent(ctx, attempt.fail(FailureInvalidIDToken), client)
+		if errors.Is(err, idp.ErrInvalidIDToken) {
+			return nil, ErrInvalidIDToken
+		}
+		return nil, err
+	}
+	attempt.Username = identity.Email
+
+	return u.loginIdentity(ctx, p.Config(), identity, attempt, client)
+}
+
+// loginIdentity signs in the user asserted by an upstream provider. Users are
+// found by their linked identity, or on its first use by email, in which case
+// the identity gets linked and the account created as the provider's
+// provisioning rules allow.
+func (u *authUseCase) loginIdentity(ctx context.Context, provider idp.Config, identity *idp.Identity, attempt loginAttempt, client ClientInfo) (*LoginResponse, error) {
+	rules := provider.Provisioning
+	if !rules.AllowsDomain(identity.HostedDomain) {
+		u.recordLoginEvent(ctx, attempt.fail(FailureDomainNotAllowed), client)
+		return nil, ErrDomainNotAllowed
+	}
+
+	// 1. Check if the identity is linked
+	var user repository.User
+	link, err := u.store.GetUserIdentity(ctx, repository.GetUserIdentityParams{Provider: identity.Provider, Subject: identity.Subject})
+	switch {
+	case err == nil:
+		user, err = u.store.GetUserById(ctx, link.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if err := u.store.UpdateUserIdentityLogin(ctx, repository.UpdateUserIdentityLoginParams{
+			ID:    link.ID,
+			Email: textOrNull(identity.Email),
+		}); err != nil {
+			log.Printf("[Auth] Failed to update identity %d: %v", link.ID, err)
+		}
+	case errors.Is(err, pgx.ErrNoRows):
+		user, err = u.linkFirstLogin(ctx, provider, identity, attempt, client)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	attempt.UserID = user.ID
+
+	// 2. Ask for the second factor before issuing tokens, the provider's
+	// login does not replace the factor enrolled here
+	if resp, err := u.challengeMFA(ctx, user, attempt, client); resp != nil || err != nil {
+		return resp, err
+	}
+
+	// 3. Generate Tokens
+	tokens, err := u.generateTokens(ctx, user, client)
+	if err != nil {
+		return nil, err
+	}
+
+	// 4. Update Last Login
+	u.completeLogin(ctx, user, attempt, client)
+
+	return u.newLoginResponse(ctx, user, tokens), nil
+}
+
+// linkFirstLogin finds or provisions the user of an identity not linked yet
+// and links it.
+func (u *authUseCase) linkFirstLogin(ctx context.Context, provider idp.Config, identity *idp.Identity, attempt loginAttempt, client ClientInfo) (repository.User, error) {
+	rules := provider.Provisioning
+
+	// Only trust addresses the provider vouches for, they pick the account
+	if identity.Email == "" || (provider.RequireVerifiedEmail && !identity.EmailVerified) {
+		u.recordLoginEvent(ctx, attempt.fail(FailureEmailNotVerified), client)
+		return repository.User{}, ErrEmailNotVerified
+	}
+	user, err := u.store.GetUserByEmail(ctx, pgtype.Text{String: identity.Email, Valid: true})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return repository.User{}, err
+	}
+	exists := err == nil
+	if !exists && rules.InviteOnly {
+		u.recordLoginEvent(ctx, attempt.fail(FailureNotProvisioned), client)
+		return repository.User{}, ErrUserNotProvisioned
+	}
+
+	// An email match alone must not hand over an account someone already
+	// logs in to: providers letting users set any address would allow
+	// takeovers. Only invitations and accounts of the former Google login
+	// are claimed this way, others link under /me.
+	if exists {
+		claimable, err := u.claimableAccount(ctx, user, identity)
+		if err != nil {
+			return repository.User{}, err
+		}
+		if !claimable {
+			u.recordLoginEvent(ctx, attempt.fail(FailureLinkRequired), client)
+			return repository.User{}, ErrAccountLinkRequired
+		}
+	}
+
+	err = u.store.ExecTx(ctx, func(q repository.Querier) error {
+		if !exists {
+			var err error
+			user, err = provisionUser(ctx, q, identity.Email, identity, rules.Role(identity.HostedDomain))
+			if err != nil {
+				return err
+			}
+		}
+		_, err := q.CreateUserIdentity(ctx, repository.CreateUserIdentityParams{
+			UserID:      user.ID,
+			Provider:    identity.Provider,
+			Subject:     identity.Subject,
+			Email:       textOrNull(identity.Email),
+			LastLoginAt: pgtype.Timestamptz{Time: time.Now(), Valid: true},
+		})
+		return err
+	})
+	if err != nil {
+		return repository.User{}, err
+	}
+	if !exists {
+		log.Printf("[Auth] Provisioned user %d from %s", user.ID, identity.Provider)
+	}
+	return user, nil
+}
+
+// claimableAccount reports whether an account may be linked on a first
+// external login by email: an invitation without password, second factor or
+// linked identity that was never logged in to. Accounts the former Google
+// login created, which matched by email and predate user_identities, are
+// claimed by the google provider on their first login since.
+func (u *authUseCase) claimableAccount(ctx context.Context, user repository.User, identity *idp.Identity) (bool, error) {
+	if user.PasswordHash.Valid || user.AuthSource != AuthSourceLocal {
+		return false, nil
+	}
+	identities, err := u.store.CountUserIdentities(ctx, user.ID)
+	if err != nil {
+		return false, err
+	}
+	if identities > 0 {
+		return false, nil
+	}
+	if identity.Provider == legacyGoogleProvider && user.ExternalLogin.Bool {
+		return true, nil
+	}
+	if user.LastLoginAt.Valid {
+		return false, nil
+	}
+	passkeys, err := u.store.CountUserWebAuthnCredentials(ctx, user.ID)
+	if err != nil {
+		return false, err
+	}
+	if passkeys > 0 {
+		return false, nil
+	}
+	if _, err := u.store.GetUserTOTP(ctx, user.ID); !errors.Is(err, pgx.ErrNoRows) {
+		return false, err
+	}
+	return true, nil
+}
+
+// provisionUser creates the account of a first external login, with the
+// role of the given code if not empty.
+func provisionUser(ctx context.Context, q repository.Querier, username string, identity *idp.Identity, roleCode string) (repository.User, error) {
+	var roleID pgtype.Int4
+	if roleCode != "" {
+		role, err := q.GetRoleByCode(ctx, roleCode)
+		if err != nil {
+			return repository.User{}, fmt.Errorf("provisioning role %q: %w", roleCode, err)
+		}
+		roleID = pgtype.Int4{Int32: role.ID, Valid: true}
+	}
+
+	user, err := q.CreateUser(ctx, repository.CreateUserParams{
+		Username:     username,
+		PasswordHash: pgtype.Text{Valid: false},
+		FullName:     identity.Name,
+		Email:        textOrNull(identity.Email),
+		Avatar:       textOrNull(identity.Picture),
+		RoleID:       roleID,
+		Status:       pgtype.Text{String: "ACTIVE", Valid: true},
+	})
+	if err != nil {
+		return user, err
+	}
+
+	// Set as external login
+	err = q.UpdateUserExternalLogin(ctx, repository.UpdateUserExternalLoginParams{
+		ID:            user.ID,
+		ExternalLogin: pgtype.Bool{Bool: true, Valid: true},
+	})
+	return user, err
+}
@@ -0,0 +1,87 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/zomzem/identity-service/internal/config"
+	"github.com/zomzem/identity-service/internal/idp"
+	"github.com/zomzem/identity-service/internal/repository"
+	"github.com/zomzem/identity-service/internal/signing"
+)
+
+func newIdentityLoginUseCase(store *fakeStore) *authUseCase {
+	cfg := &config.Config{JWTExpiresIn: 15 * time.Minute, RefreshTokenExpiry: 24 * time.Hour}
+	return NewAuthUseCase(store, cfg, signing.NewHMACSigner("test-secret"), &recordingEvents{}, nil, nil, nil, nil).(*authUseCase)
+}
+
+func loginAs(u *authUseCase, provider, subject string) (*LoginResponse, error) {
+	identity := &idp.Identity{
+		Provider:      provider,
+		Subject:       subject,
+		Email:         "jane@example.com",
+		EmailVerified: true,
+		HostedDomain:  "example.com",
+	}
+	attempt := loginAttempt{Method: "TEST", Outcome: LoginOutcomeFailure}
+	return u.loginIdentity(context.Background(), idp.Config{Name: provider, RequireVerifiedEmail: true}, identity, attempt, ClientInfo{})
+}
+
+func TestFirstLoginClaimsAccountByEmail(t *testing.T) {
+	email := pgtype.Text{String: "jane@example.com", Valid: true}
+	loggedIn := pgtype.Timestamptz{Time: time.Now().Add(-24 * time.Hour), Valid: true}
+	// Accounts the former Google-only login created and kept logging in to
+	legacyGoogle := repository.User{ID: 7, Username: "jane@example.com", Email: email, AuthSource: AuthSourceLocal,
+		ExternalLogin: pgtype.Bool{Bool: true, Valid: true}, LastLoginAt: loggedIn}
+
+	tests := []struct {
+		name       string
+		user       repository.User
+		identities []repository.UserIdentity
+		provider   string
+		wantErr    error
+	}{
+		{name: "invitation", user: repository.User{ID: 7, Username: "jane", Email: email, AuthSource: AuthSourceLocal}, provider: "entra"},
+		{name: "invitation logged in to", user: repository.User{ID: 7, Username: "jane", Email: email, AuthSource: AuthSourceLocal, LastLoginAt: loggedIn}, provider: "entra", wantErr: ErrAccountLinkRequired},
+		{name: "password account", user: repository.User{ID: 7, Username: "jane", Email: email, AuthSource: AuthSourceLocal, PasswordHash: pgtype.Text{String: "hash", Valid: true}}, provider: "google", wantErr: ErrAccountLinkRequired},
+		{name: "legacy google account", user: legacyGoogle, provider: "google"},
+		{name: "legacy google account at another provider", user: legacyGoogle, provider: "entra", wantErr: ErrAccountLinkRequired},
+		{name: "legacy google account already claimed", user: legacyGoogle, provider: "google", wantErr: ErrAccountLinkRequired,
+			identities: []repository.UserIdentity{{ID: 1, UserID: 7, Provider: "google", Subject: "google-other"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeStore(tt.user)
+			store.identities = tt.identities
+			u := newIdentityLoginUseCase(store)
+
+			res, err := loginAs(u, tt.provider, "subject-1")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got %v, want %v", err, tt.wantErr)
+				}
+				if got, _ := store.CountUserIdentities(context.Background(), 7); got != int64(len(tt.identities)) {
+					t.Errorf("rejected login linked an identity")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("login: %v", err)
+			}
+			if res.User.ID != 7 {
+				t.Errorf("logged in as user %d, want 7", res.User.ID)
+			}
+
+			// The identity is linked, later logins find the account by it
+			if _, err := loginAs(u, tt.provider, "subject-1"); err != nil {
+				t.Fatalf("second login: %v", err)
+			}
+			if got, _ := store.CountUserIdentities(context.Background(), 7); got != 1 {
+				t.Errorf("got %d linked identities, want 1", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package usecase
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/zomzem/identity-service/internal/idp"
+	"github.com/zomzem/identity-service/internal/repository"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrInvalidReturnURL = errors.New("return url not allowed")
+	ErrInvalidOIDCState = errors.New("invalid or expired login state")
+	ErrOIDCLoginDenied  = errors.New("login denied by identity provider")
+)
+
+// OIDCCallbackRequest holds the query parameters the provider redirects back
+// with and the state the starting browser kept in a cookie.
+type OIDCCallbackRequest struct {
+	State            string
+	Code             string
+	Error            string
+	ErrorDescription string
+	BrowserState     string
+}
+
+// StartOIDCLogin returns the URL to send the browser to for logging in at the
+// provider and the state the browser has to present at the callback. returnTo
+// is where the browser goes once the login is done.
+func (u *authUseCase) StartOIDCLogin(ctx context.Context, provider, returnTo string) (string, string, error) {
+	p, err := u.providers.Get(provider)
+	if err != nil {
+		return "", "", ErrUnknownOIDCProvider
+	}
+	if returnTo == "" {
+		returnTo = u.config.OIDCReturnURLs[0]
+	}
+	if !allowedReturnURL(returnTo, u.config.OIDCReturnURLs) {
+		return "", "", ErrInvalidReturnURL
+	}
+
+	// 1. Fresh state, nonce and PKCE verifier for this login
+	state, err := newOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := newOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	authURL, err := p.AuthCodeURL(ctx, u.oidcCallbackURL(provider), state, nonce, verifier)
+	if err != nil {
+		return "", "", err
+	}
+
+	// 2. Remember them until the callback
+	err = u.store.CreateOIDCLoginState(ctx, repository.CreateOIDCLoginStateParams{
+		StateHash:    hashToken(state),
+		Provider:     provider,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ReturnTo:     returnTo,
+		ExpiresAt:    pgtype.Timestamptz{Time: time.Now().Add(u.config.OIDCLoginTTL), Valid: true},
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, state, nil
+}
+
+// FinishOIDCLogin completes a redirect login. The returned URL is where the
+// browser should go next; it is set whenever the state was valid, also on error.
+func (u *authUseCase) FinishOIDCLogin(ctx context.Context, provider string, req OIDCCallbackRequest, client ClientInfo) (*LoginResponse, string, error) {
+	p, err := u.providers.Get(provider)
+	if err != nil {
+		return nil, "", ErrUnknownOIDCProvider
+	}
+	attempt := loginAttempt{Method: strings.ToUpper(provider), Outcome: LoginOutcomeFailure}
+
+	// 1. Load the login started at /authorize, in this browser only: a
+	// callback URL of someone else's login must not sign in the victim
+	if req.BrowserState == "" || subtle.ConstantTimeCompare([]byte(req.BrowserState), []byte(req.State)) != 1 {
+		return nil, "", ErrInvalidOIDCState
+	}
+	state, err := u.store.TakeOIDCLoginState(ctx, repository.TakeOIDCLoginStateParams{
+		StateHash: hashToken(req.State),
+		Provider:  provider,
+	})
+	if err != nil || !state.ExpiresAt.Time.After(time.Now()) {
+		return nil, "", ErrInvalidOIDCState
+	}
+	if _, err := u.store.DeleteExpiredOIDCLoginStates(ctx); err != nil {
+		log.Printf("[Auth] Failed to delete expired OIDC login states: %v", err)
+	}
+	if req.Error != "" {
+		log.Printf("[Auth] %s login denied: %s %s", provider, req.Error, req.ErrorDescription)
+		return nil, state.ReturnTo, ErrOIDCLoginDenied
+	}
+
+	// 2. Redeem the code and verify the ID token
+	identity, err := p.Exchange(ctx, u.oidcCallbackURL(provider), req.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		log.Printf("[Auth] %s code exchange failed: %v", provider, err)
+		u.recordLoginEvent(ctx, attempt.fail(FailureInvalidIDToken), client)
+		if errors.Is(err, idp.ErrInvalidIDToken) || errors.Is(err, idp.ErrInvalidAuthCode) {
+			err = ErrInvalidIDToken
+		}
+		return nil, state.ReturnTo, err
+	}
+	attempt.Username = identity.Email
+
+	// 3. Log in as with a posted ID token
+	resp, err := u.loginIdentity(ctx, p.Config(), identity, attempt, client)
+	return resp, state.ReturnTo, err
+}
+
+func (u *authUseCase) oidcCallbackURL(provider string) string {
+	return strings.TrimRight(u.config.OIDCCallbackBaseURL, "/") + "/auth/oidc/" + url.PathEscape(provider) + "/callback"
+}
+
+// allowedReturnURL accepts URLs with the scheme and host of an allowed URL
+// and a path below its path. Comparing parsed URLs rather than strings keeps
+// e.g. https://app.example.com.evil.test out.
+func allowedReturnURL(returnTo string, allowed []string) bool {
+	target, err := url.Parse(returnTo)
+	if err != nil || target.User != nil {
+		return false
+	}
+	for _, a := range allowed {
+		base, err := url.Parse(a)
+		if err != nil {
+			continue
+		}
+		if !strings.EqualFold(target.Scheme, base.Scheme) || !strings.EqualFold(target.Host, base.Host) {
+			continue
+		}
+		prefix := strings.TrimSuffix(base.Path, "/")
+		if target.Path == prefix || strings.HasPrefix(target.Path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/zomzem/identity-service/internal/notify"
+	"github.com/zomzem/identity-service/internal/repository"
+)
+
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+
+// ForgotPasswordRequest identifies the account by username or email.
+type ForgotPasswordRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"newPassword"`
+}
+
+func (u *passwordUseCase) ForgotPassword(ctx context.Context, req ForgotPasswordRequest, client ClientInfo) error {
+	// 1. Find the account. Unknown accounts are silently ignored.
+	user, err := u.findResetUser(ctx, req)
+	if err != nil {
+		return nil
+	}
+	if !user.Email.Valid || user.Email.String == "" {
+		log.Printf("[Password] Reset requested for user %d without email", user.ID)
+		return nil
+	}
+	if !user.PasswordHash.Valid {
+		// External logins have no password to reset
+		return nil
+	}
+
+	// 2. Issue and deliver the link in the background: the database writes
+	// and the notifier only run for real accounts, so waiting for them would
+	// tell from the response time whether the account exists
+	go u.sendResetLink(context.WithoutCancel(ctx), user, client)
+	return nil
+}
+
+// sendResetLink issues a reset token, invalidating earlier ones, and mails it.
+func (u *passwordUseCase) sendResetLink(ctx context.Context, user repository.User, client ClientInfo) {
+	token, err := newOpaqueToken()
+	if err != nil {
+		log.Printf("[Password] Failed to issue reset token for user %d: %v", user.ID, err)
+		return
+	}
+	expiresAt := time.Now().Add(u.config.PasswordResetTokenTTL)
+	err = u.store.ExecTx(ctx, func(q repository.Querier) error {
+		if err := q.InvalidateUserPasswordResetTokens(ctx, user.ID); err != nil {
+			return err
+		}
+		_, err := q.CreatePasswordResetToken(ctx, repository.CreatePasswordResetTokenParams{
+			UserID:    user.ID,
+			TokenHash: hashToken(token),
+			ExpiresAt: pgtype.Timestamptz{Time: expiresAt, Valid: true},
+			IpAddress: textOrNull(client.IP),
+		})
+		return err
+	})
+	if err != nil {
+		log.Printf("[Password] Failed to issue reset token for user %d: %v", user.ID, err)
+		return
+	}
+
+	if err := u.notifier.Notify(ctx, u.passwordResetMessage(user, token, expiresAt)); err != nil {
+		log.Printf("[Password] Failed to send reset link to user %d: %v", user.ID, err)
+	}
+
+	// Expired tokens are purged opportunistically
+	if _, err := u.store.DeleteExpiredPasswordResetTokens(ctx); err != nil {
+		log.Printf("[Password] Failed to purge expired reset tokens: %v", err)
+	}
+}
+
+func (u *passwordUseCase) ResetPassword(ctx context.Context, req ResetPasswordRequest) error {
+	// 1. Look up the token
+	rt, err := u.store.GetPasswordResetToken(ctx, hashToken(req.Token))
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+
+	// 2. Validate the new password before using up the token
+	user, err := u.getUser(ctx, rt.UserID)
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+	hash, err := u.preparePassword(ctx, user, req.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	// 3. Use the token and store the password. Proving access to the mailbox
+	// also lifts a lockout.
+	return u.store.ExecTx(ctx, func(q repository.Querier) error {
+		rows, err := q.UsePasswordResetToken(ctx, rt.ID)
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrInvalidResetToken
+		}
+		if err := storePassword(ctx, q, u.policy, rt.UserID, hash, false); err != nil {
+			return err
+		}
+		return q.ResetFailedLogins(ctx, rt.UserID)
+	})
+}
+
+func (u *passwordUseCase) findResetUser(ctx context.Context, req ForgotPasswordRequest) (repository.User, error) {
+	if email := strings.TrimSpace(req.Email); email != "" {
+		return u.store.GetUserByEmail(ctx, pgtype.Text{String: email, Valid: true})
+	}
+	return u.store.GetUserByUsername(ctx, strings.TrimSpace(req.Username))
+}
+
+func (u *passwordUseCase) passwordResetMessage(user repository.User, token string, expiresAt time.Time) notify.Message {
+	link := u.config.PasswordResetURL
+	if link != "" {
+		sep := "?"
+		if strings.Contains(link, "?") {
+			sep = "&"
+		}
+		link += sep + "token=" + url.QueryEscape(token)
+	}
+	action := link
+	if action == "" {
+		action = "Reset token: " + token
+	}
+
+	text := fmt.Sprintf("Hello %s,\n\nUse the link below to choose a new password. It expires at %s.\n\n%s\n\nIf you did not ask for this, you can ignore this message.",
+		user.FullName, expiresAt.UTC().Format(time.RFC1123), action)
+	return notify.Message{
+		Type:    notify.TypePasswordReset,
+		UserID:  user.ID,
+		To:      user.Email.String,
+		Subject: "Reset your password",
+		Text:    text,
+		Data: map[string]string{
+			"token":     token,
+			"link":      link,
+			"expiresAt": expiresAt.UTC().Format(time.RFC3339),
+		},
+	}
+}
@@ -0,0 +1,163 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/zomzem/identity-service/internal/config"
+	"github.com/zomzem/identity-service/internal/notify"
+	"github.com/zomzem/identity-service/internal/password"
+	"github.com/zomzem/identity-service/internal/repository"
+)
+
+const newTestPassword = "a brand new passphrase"
+
+type passwordResetFixture struct {
+	store    *fakeStore
+	inbox    *notify.Capture
+	password PasswordUseCase
+}
+
+// newPasswordResetFixture returns user 5, locked out and logged in on one
+// device.
+func newPasswordResetFixture(t *testing.T) *passwordResetFixture {
+	t.Helper()
+	cfg := &config.Config{
+		PasswordHashAlgorithm: password.AlgorithmBcrypt,
+		BcryptCost:            4,
+		PasswordMinLength:     8,
+		PasswordMaxLength:     72,
+		PasswordResetTokenTTL: 30 * time.Minute,
+		PasswordResetURL:      "https://app.example.com/reset-password",
+	}
+	hash, err := password.NewBcryptHasher(cfg.BcryptCost).Hash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := newFakeStore(repository.User{
+		ID:                  5,
+		Username:            "jane",
+		Email:               pgtype.Text{String: testEmail, Valid: true},
+		PasswordHash:        pgtype.Text{String: hash, Valid: true},
+		AuthSource:          AuthSourceLocal,
+		FailedLoginAttempts: 5,
+		LockedUntil:         pgtype.Timestamptz{Time: time.Now().Add(time.Hour), Valid: true},
+	})
+	store.refresh = []repository.RefreshToken{{ID: 1, UserID: 5, TokenHash: "session-of-jane"}}
+	inbox := notify.NewCapture()
+	return &passwordResetFixture{store: store, inbox: inbox, password: NewPasswordUseCase(store, cfg, nil, inbox)}
+}
+
+// forgot asks for a reset of jane's password and returns the token of the
+// n-th message she got.
+func (f *passwordResetFixture) forgot(t *testing.T, n int) string {
+	t.Helper()
+	if err := f.password.ForgotPassword(context.Background(), ForgotPasswordRequest{Email: testEmail}, ClientInfo{}); err != nil {
+		t.Fatalf("ForgotPassword: %v", err)
+	}
+	msg := waitForMessages(t, f.inbox, n)
+	if msg.Type != notify.TypePasswordReset || msg.To != testEmail || !strings.Contains(msg.Text, msg.Data["link"]) {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+	return msg.Data["token"]
+}
+
+func (f *passwordResetFixture) user() repository.User {
+	f.store.mu.Lock()
+	defer f.store.mu.Unlock()
+	return f.store.users[5]
+}
+
+func (f *passwordResetFixture) passwordIs(pw string) bool {
+	ok, _ := password.NewBcryptHasher(4).Verify(f.user().PasswordHash.String, pw)
+	return ok
+}
+
+func TestResetPassword(t *testing.T) {
+	f := newPasswordResetFixture(t)
+	ctx := context.Background()
+	token := f.forgot(t, 1)
+
+	if err := f.password.ResetPassword(ctx, ResetPasswordRequest{Token: token, NewPassword: newTestPassword}); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	if !f.passwordIs(newTestPassword) {
+		t.Error("password not changed")
+	}
+	if user := f.user(); user.FailedLoginAttempts != 0 || user.LockedUntil.Valid {
+		t.Errorf("lockout not lifted: %d failures, locked until %v", user.FailedLoginAttempts, user.LockedUntil)
+	}
+	if !f.store.refresh[0].RevokedAt.Valid {
+		t.Error("existing sessions not revoked")
+	}
+
+	err := f.password.ResetPassword(ctx, ResetPasswordRequest{Token: token, NewPassword: "yet another passphrase"})
+	if !errors.Is(err, ErrInvalidResetToken) {
+		t.Fatalf("token used twice: got %v, want ErrInvalidResetToken", err)
+	}
+	if !f.passwordIs(newTestPassword) {
+		t.Error("a used token changed the password")
+	}
+}
+
+func TestResetPasswordExpiredToken(t *testing.T) {
+	f := newPasswordResetFixture(t)
+	token := f.forgot(t, 1)
+	f.store.mu.Lock()
+	f.store.resets[0].ExpiresAt = pgtype.Timestamptz{Time: time.Now().Add(-time.Second), Valid: true}
+	f.store.mu.Unlock()
+
+	err := f.password.ResetPassword(context.Background(), ResetPasswordRequest{Token: token, NewPassword: newTestPassword})
+	if !errors.Is(err, ErrInvalidResetToken) {
+		t.Fatalf("expired token: got %v, want ErrInvalidResetToken", err)
+	}
+	if !f.passwordIs(testPassword) || f.store.refresh[0].RevokedAt.Valid {
+		t.Error("an expired token changed the account")
+	}
+}
+
+func TestResetPasswordWeakPasswordKeepsToken(t *testing.T) {
+	f := newPasswordResetFixture(t)
+	ctx := context.Background()
+	token := f.forgot(t, 1)
+
+	err := f.password.ResetPassword(ctx, ResetPasswordRequest{Token: token, NewPassword: "short"})
+	if !errors.Is(err, ErrWeakPassword) {
+		t.Fatalf("weak password: got %v, want ErrWeakPassword", err)
+	}
+	if err := f.password.ResetPassword(ctx, ResetPasswordRequest{Token: token, NewPassword: newTestPassword}); err != nil {
+		t.Fatalf("retry with a strong password: %v", err)
+	}
+}
+
+func TestForgotPasswordReplacesEarlierToken(t *testing.T) {
+	f := newPasswordResetFixture(t)
+	ctx := context.Background()
+	first := f.forgot(t, 1)
+	second := f.forgot(t, 2)
+
+	err := f.password.ResetPassword(ctx, ResetPasswordRequest{Token: first, NewPassword: newTestPassword})
+	if !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("earlier token: got %v, want ErrInvalidResetToken", err)
+	}
+	if err := f.password.ResetPassword(ctx, ResetPasswordRequest{Token: second, NewPassword: newTestPassword}); err != nil {
+		t.Errorf("latest token: %v", err)
+	}
+}
+
+func TestForgotPasswordIgnoresUnknownAccounts(t *testing.T) {
+	f := newPasswordResetFixture(t)
+	for _, req := range []ForgotPasswordRequest{{Email: "nobody@example.com"}, {Username: "nobody"}} {
+		if err := f.password.ForgotPassword(context.Background(), req, ClientInfo{}); err != nil {
+			t.Errorf("ForgotPassword(%+v): %v", req, err)
+		}
+	}
+	// Nothing was started in the background either
+	if len(f.inbox.Messages()) != 0 || len(f.store.resets) != 0 {
+		t.Error("a reset was issued for an unknown account")
+	}
+}
@@ -0,0 +1,269 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/zomzem/identity-service/internal/config"
+	"github.com/zomzem/identity-service/internal/notify"
+	"github.com/zomzem/identity-service/internal/password"
+	"github.com/zomzem/identity-service/internal/repository"
+)
+
+var (
+	ErrWeakPassword           = errors.New("password does not meet requirements")
+	ErrInvalidCurrentPassword = errors.New("current password is incorrect")
+)
+
+type PasswordUseCase interface {
+	// ChangePassword replaces the user's password after checking the current one.
+	ChangePassword(ctx context.Context, userID int32, req ChangePasswordRequest) error
+	// SetPassword replaces a user's password without knowing the current one.
+	SetPassword(ctx context.Context, userID int32, req SetPasswordRequest) error
+	// ForgotPassword sends a reset link to the user, if there is one to send.
+	// It succeeds either way so callers cannot probe for accounts.
+	ForgotPassword(ctx context.Context, req ForgotPasswordRequest, client ClientInfo) error
+	// ResetPassword sets a new password using a token from ForgotPassword.
+	ResetPassword(ctx context.Context, req ResetPasswordRequest) error
+	// GetPolicy describes the rules new passwords have to follow.
+	GetPolicy() *PasswordPolicyResponse
+}
+
+type passwordUseCase struct {
+	store    repository.Store
+	config   *config.Config
+	notifier notify.Notifier
+	policy   password.Policy
+	hasher   password.Hasher
+}
+
+func NewPasswordUseCase(store repository.Store, cfg *config.Config, blocklist password.Blocklist, notifier notify.Notifier) PasswordUseCase {
+	return &passwordUseCase{
+		store:    store,
+		config:   cfg,
+		notifier: notifier,
+		policy:   newPasswordPolicy(cfg, blocklist),
+		hasher:   newPasswordHasher(cfg),
+	}
+}
+
+type PasswordPolicyResponse struct {
+	MinLength        int    `json:"minLength"`
+	MaxLength        int    `json:"maxLength"`
+	RequireUppercase bool   `json:"requireUppercase"`
+	RequireLowercase bool   `json:"requireLowercase"`
+	RequireDigit     bool   `json:"requireDigit"`
+	RequireSymbol    bool   `json:"requireSymbol"`
+	DisallowUserInfo bool   `json:"disallowUserInfo"`
+	Blocklist        bool   `json:"blocklist"`
+	HistorySize      int    `json:"historySize"`
+	MaxAgeSeconds    *int64 `json:"maxAgeSeconds"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+type SetPasswordRequest struct {
+	Password           string `json:"password"`
+	MustChangePassword bool   `json:"mustChangePassword"`
+}
+
+func (u *passwordUseCase) ChangePassword(ctx context.Context, userID int32, req ChangePasswordRequest) error {
+	// 1. Get User
+	user, err := u.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	// 2. Verify Current Password. Accounts without one get theirs set by an admin.
+	if !user.PasswordHash.Valid {
+		return ErrInvalidCurrentPassword
+	}
+	if ok, _ := u.hasher.Verify(user.PasswordHash.String, req.CurrentPassword); !ok {
+		return ErrInvalidCurrentPassword
+	}
+
+	// 3. Store the new one
+	return u.updatePassword(ctx, user, req.NewPassword, false)
+}
+
+func (u *passwordUseCase) SetPassword(ctx context.Context, userID int32, req SetPasswordRequest) error {
+	user, err := u.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return u.updatePassword(ctx, user, req.Password, req.MustChangePassword)
+}
+
+func (u *passwordUseCase) GetPolicy() *PasswordPolicyResponse {
+	res := &PasswordPolicyResponse{
+		MinLength:        u.policy.MinLength,
+		MaxLength:        u.policy.MaxLength,
+		RequireUppercase: u.policy.RequireUpper,
+		RequireLowercase: u.policy.RequireLower,
+		RequireDigit:     u.policy.RequireDigit,
+		RequireSymbol:    u.policy.RequireSymbol,
+		DisallowUserInfo: u.policy.DisallowUserInfo,
+		Blocklist:        u.policy.Blocklist != nil,
+		HistorySize:      u.policy.HistorySize,
+	}
+	if u.policy.MaxAge > 0 {
+		seconds := int64(u.policy.MaxAge / time.Second)
+		res.MaxAgeSeconds = &seconds
+	}
+	return res
+}
+
+func (u *passwordUseCase) getUser(ctx context.Context, userID int32) (repository.User, error) {
+	user, err := u.store.GetUserById(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return user, ErrUserNotFound
+	}
+	return user, err
+}
+
+// updatePassword stores the new password and ends every session of the user,
+// so a leaked password stops working everywhere once changed.
+func (u *passwordUseCase) updatePassword(ctx context.Context, user repository.User, newPassword string, mustChange bool) error {
+	hash, err := u.preparePassword(ctx, user, newPassword)
+	if err != nil {
+		return err
+	}
+
+	return u.store.ExecTx(ctx, func(q repository.Querier) error {
+		return storePassword(ctx, q, u.policy, user.ID, hash, mustChange)
+	})
+}
+
+// preparePassword checks a new password of user against the policy and the
+// password history, and returns its hash.
+func (u *passwordUseCase) preparePassword(ctx context.Context, user repository.User, newPassword string) (pgtype.Text, error) {
+	info := password.UserInfo{Username: user.Username, Email: user.Email.String}
+	if err := checkPassword(u.policy, newPassword, info); err != nil {
+		return pgtype.Text{}, err
+	}
+	if err := u.checkPasswordReuse(ctx, user, newPassword); err != nil {
+		return pgtype.Text{}, err
+	}
+	return hashPassword(u.hasher, newPassword)
+}
+
+// checkPasswordReuse refuses the current password and the ones in the history.
+func (u *passwordUseCase) checkPasswordReuse(ctx context.Context, user repository.User, newPassword string) error {
+	if u.policy.HistorySize == 0 {
+		return nil
+	}
+
+	history, err := u.store.ListPasswordHistory(ctx, repository.ListPasswordHistoryParams{
+		UserID: user.ID,
+		Limit:  int32(u.policy.HistorySize),
+	})
+	if err != nil {
+		return err
+	}
+
+	hashes := make([]string, 0, len(history)+1)
+	if user.PasswordHash.Valid {
+		hashes = append(hashes, user.PasswordHash.String)
+	}
+	for _, h := range history {
+		if h.PasswordHash != user.PasswordHash.String {
+			hashes = append(hashes, h.PasswordHash)
+		}
+	}
+	for _, h := range hashes {
+		if ok, _ := u.hasher.Verify(h, newPassword); ok {
+			return fmt.Errorf("%w: must not be one of the last %d passwords", ErrWeakPassword, u.policy.HistorySize)
+		}
+	}
+	return nil
+}
+
+func storePassword(ctx context.Context, q repository.Querier, policy password.Policy, userID int32, hash pgtype.Text, mustChange bool) error {
+	if err := q.UpdateUserPassword(ctx, repository.UpdateUserPasswordParams{
+		ID:                 userID,
+		PasswordHash:       hash,
+		MustChangePassword: mustChange,
+	}); err != nil {
+		return err
+	}
+	if err := recordPasswordHistory(ctx, q, policy, userID, hash); err != nil {
+		return err
+	}
+	return q.RevokeUserRefreshTokens(ctx, userID)
+}
+
+// recordPasswordHistory remembers hash, keeping only as many entries as the policy checks.
+func recordPasswordHistory(ctx context.Context, q repository.Querier, policy password.Policy, userID int32, hash pgtype.Text) error {
+	if policy.HistorySize == 0 {
+		return nil
+	}
+	if err := q.CreatePasswordHistory(ctx, repository.CreatePasswordHistoryParams{
+		UserID:       userID,
+		PasswordHash: hash.String,
+	}); err != nil {
+		return err
+	}
+	return q.PrunePasswordHistory(ctx, repository.PrunePasswordHistoryParams{
+		UserID: userID,
+		Limit:  int32(policy.HistorySize),
+	})
+}
+
+func newPasswordPolicy(cfg *config.Config, blocklist password.Blocklist) password.Policy {
+	return password.Policy{
+		MinLength:        cfg.PasswordMinLength,
+		MaxLength:        cfg.PasswordMaxLength,
+		RequireUpper:     cfg.PasswordRequireUpper,
+		RequireLower:     cfg.PasswordRequireLower,
+		RequireDigit:     cfg.PasswordRequireDigit,
+		RequireSymbol:    cfg.PasswordRequireSymbol,
+		DisallowUserInfo: cfg.PasswordDisallowUserInfo,
+		HistorySize:      cfg.PasswordHistory,
+		MaxAge:           cfg.PasswordMaxAge,
+		Blocklist:        blocklist,
+	}
+}
+
+// checkPassword applies the policy rules that need no stored state.
+func checkPassword(policy password.Policy, newPassword string, info password.UserInfo) error {
+	if violations := policy.Check(newPassword, info); len(violations) > 0 {
+		return fmt.Errorf("%w: %s", ErrWeakPassword, strings.Join(violations, ", "))
+	}
+	return nil
+}
+
+func hashPassword(hasher password.Hasher, newPassword string) (pgtype.Text, error) {
+	hash, err := hasher.Hash(newPassword)
+	if errors.Is(err, password.ErrTooLong) {
+		return pgtype.Text{}, fmt.Errorf("%w: too long for the password hash algorithm", ErrWeakPassword)
+	}
+	if err != nil {
+		return pgtype.Text{}, err
+	}
+	return pgtype.Text{String: hash, Valid: true}, nil
+}
+
+// newPasswordHasher hashes with the configured algorithm and still verifies
+// the other one, so existing hashes keep working and get upgraded on login.
+func newPasswordHasher(cfg *config.Config) password.Hasher {
+	bcryptHasher := password.NewBcryptHasher(cfg.BcryptCost)
+	argon2idHasher := password.NewArgon2idHasher(password.Argon2Params{
+		Memory:      cfg.Argon2Memory,
+		Iterations:  cfg.Argon2Iterations,
+		Parallelism: cfg.Argon2Parallelism,
+		SaltLength:  16,
+		KeyLength:   32,
+	})
+	if cfg.PasswordHashAlgorithm == password.AlgorithmBcrypt {
+		return password.NewMigratingHasher(bcryptHasher, argon2idHasher)
+	}
+	return password.NewMigratingHasher(argon2idHasher, bcryptHasher)
+}
@@ -2,10 +2,17 @@ package usecase
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/zomzem/identity-service/internal/config"
 	"github.com/zomzem/identity-service/internal/repository"
 )
 
+var ErrInvalidTokenTTL = errors.New("invalid token lifetime")
+
 type RoleUseCase interface {
 	ListRoles(ctx context.Context) ([]RoleResponse, error)
 	GetRoleByID(ctx context.Context, id int32) (*RoleResponse, error)
@@ -19,22 +26,26 @@ type RoleUseCase interface {
 }
 
 type roleUseCase struct {
-	store repository.Store
+	store  repository.Store
+	config *config.Config
 }
 
-func NewRoleUseCase(store repository.Store) RoleUseCase {
-	return &roleUseCase{store: store}
+func NewRoleUseCase(store repository.Store, cfg *config.Config) RoleUseCase {
+	return &roleUseCase{store: store, config: cfg}
 }
 
 type RoleResponse struct {
-	ID          int32                    `json:"id"`
-	Code        string                   `json:"code"`
-	Name        string                   `json:"name"`
-	Description *string                  `json:"description"`
-	Level       int32                    `json:"level"`
-	IsSystem    bool                     `json:"isSystem"`
-	Status      string                   `json:"status"`
-	Permissions []RolePermissionResponse `json:"permissions,omitempty"`
+	ID              int32                    `json:"id"`
+	Code            string                   `json:"code"`
+	Name            string                   `json:"name"`
+	Description     *string                  `json:"description"`
+	Level           int32                    `json:"level"`
+	IsSystem        bool                     `json:"isSystem"`
+	Status          string                   `json:"status"`
+	AccessTokenTTL  *int32                   `json:"accessTokenTtl"`  // seconds, nil = global default
+	RefreshTokenTTL *int32                   `json:"refreshTokenTtl"` // seconds, nil = global default
+	RequireMFA      bool                     `json:"requireMfa"`
+	Permissions     []RolePermissionResponse `json:"permissions,omitempty"`
 }
 
 type PermissionResponse struct {
@@ -54,18 +65,24 @@ type RolePermissionResponse struct {
 }
 
 type CreateRoleRequest struct {
-	Code        string  `json:"code"`
-	Name        string  `json:"name"`
-	Description *string `json:"description"`
-	Level       *int32  `json:"level"`
-	Status      *string `json:"status"`
+	Code            string  `json:"code"`
+	Name            string  `json:"name"`
+	Description     *string `json:"description"`
+	Level           *int32  `json:"level"`
+	Status          *string `json:"status"`
+	AccessTokenTTL  *int32  `json:"accessTokenTtl"`
+	RefreshTokenTTL *int32  `json:"refreshTokenTtl"`
+	RequireMFA      bool    `json:"requireMfa"`
 }
 
 type UpdateRoleRequest struct {
-	Name        string  `json:"name"`
-	Description *string `json:"description"`
-	Level       *int32  `json:"level"`
-	Status      *string `json:"status"`
+	Name            string  `json:"name"`
+	Description     *string `json:"description"`
+	Level           *int32  `json:"level"`
+	Status          *string `json:"status"`
+	AccessTokenTTL  *int32  `json:"accessTokenTtl"`  // nil keeps the current override, 0 clears it
+	RefreshTokenTTL *int32  `json:"refreshTokenTtl"` // nil keeps the current override, 0 clears it
+	RequireMFA      *bool   `json:"requireMfa"`      // nil keeps the current setting
 }
 
 type AssignPermissionRequest struct {
@@ -82,7 +99,7 @@ func (u *roleUseCase) ListRoles(ctx context.Context) ([]RoleResponse, error) {
 	res := make([]RoleResponse, 0, len(roles))
 	for _, r := range roles {
 		roleRes := u.mapRoleToResponse(r)
-		
+
 		// Load permissions for each role
 		rp, err := u.store.ListRolePermissions(ctx, r.ID)
 		if err == nil {
@@ -100,7 +117,7 @@ func (u *roleUseCase) ListRoles(ctx context.Context) ([]RoleResponse, error) {
 				})
 			}
 		}
-		
+
 		res = append(res, roleRes)
 	}
 	return res, nil
@@ -113,7 +130,7 @@ func (u *roleUseCase) GetRoleByID(ctx context.Context, id int32) (*RoleResponse,
 	}
 
 	roleRes := u.mapRoleToResponse(r)
-	
+
 	rp, err := u.store.ListRolePermissions(ctx, r.ID)
 	if err == nil {
 		roleRes.Permissions = make([]RolePermissionResponse, 0, len(rp))
@@ -135,6 +152,10 @@ func (u *roleUseCase) GetRoleByID(ctx context.Context, id int32) (*RoleResponse,
 }
 
 func (u *roleUseCase) CreateRole(ctx context.Context, req CreateRoleRequest) (*RoleResponse, error) {
+	if err := u.validateTokenTTLs(req.AccessTokenTTL, req.RefreshTokenTTL, false); err != nil {
+		return nil, err
+	}
+
 	level := int32(100)
 	if req.Level != nil {
 		level = *req.Level
@@ -151,6 +172,10 @@ func (u *roleUseCase) CreateRole(ctx context.Context, req CreateRoleRequest) (*R
 		Level:       pgtype.Int4{Int32: level, Valid: true},
 		IsSystem:    pgtype.Bool{Bool: false, Valid: true},
 		Status:      pgtype.Text{String: status, Valid: true},
+
+		AccessTokenTtlSeconds:  pgtype.Int4{Int32: getInt32(req.AccessTokenTTL), Valid: req.AccessTokenTTL != nil},
+		RefreshTokenTtlSeconds: pgtype.Int4{Int32: getInt32(req.RefreshTokenTTL), Valid: req.RefreshTokenTTL != nil},
+		RequireMfa:             req.RequireMFA,
 	})
 	if err != nil {
 		return nil, err
@@ -161,6 +186,10 @@ func (u *roleUseCase) CreateRole(ctx context.Context, req CreateRoleRequest) (*R
 }
 
 func (u *roleUseCase) UpdateRole(ctx context.Context, id int32, req UpdateRoleRequest) (*RoleResponse, error) {
+	if err := u.validateTokenTTLs(req.AccessTokenTTL, req.RefreshTokenTTL, true); err != nil {
+		return nil, err
+	}
+
 	// Check if role exists
 	existing, err := u.store.GetRoleById(ctx, id)
 	if err != nil {
@@ -175,6 +204,10 @@ func (u *roleUseCase) UpdateRole(ctx context.Context, id int32, req UpdateRoleRe
 	if req.Status != nil {
 		status = *req.Status
 	}
+	requireMFA := existing.RequireMfa
+	if req.RequireMFA != nil {
+		requireMFA = *req.RequireMFA
+	}
 
 	r, err := u.store.UpdateRole(ctx, repository.UpdateRoleParams{
 		ID:          id,
@@ -182,6 +215,10 @@ func (u *roleUseCase) UpdateRole(ctx context.Context, id int32, req UpdateRoleRe
 		Description: pgtype.Text{String: getString(req.Description), Valid: req.Description != nil},
 		Level:       pgtype.Int4{Int32: level, Valid: true},
 		Status:      pgtype.Text{String: status, Valid: true},
+
+		AccessTokenTtlSeconds:  updatedTTL(existing.AccessTokenTtlSeconds, req.AccessTokenTTL),
+		RefreshTokenTtlSeconds: updatedTTL(existing.RefreshTokenTtlSeconds, req.RefreshTokenTTL),
+		RequireMfa:             requireMFA,
 	})
 	if err != nil {
 		return nil, err
@@ -239,7 +276,38 @@ func (u *roleUseCase) mapRoleToResponse(r repository.Role) RoleResponse {
 		Level:       r.Level.Int32,
 		IsSystem:    r.IsSystem.Bool,
 		Status:      r.Status.String,
+
+		AccessTokenTTL:  int32Ptr(r.AccessTokenTtlSeconds.Int32, r.AccessTokenTtlSeconds.Valid),
+		RefreshTokenTTL: int32Ptr(r.RefreshTokenTtlSeconds.Int32, r.RefreshTokenTtlSeconds.Valid),
+		RequireMFA:      r.RequireMfa,
+	}
+}
+
+// validateTokenTTLs checks role overrides, 0 clearing one when allowed.
+// Access tokens must not outlive the publication of their signing key in
+// the JWKS, as JWT_EXPIRES_IN must not.
+func (u *roleUseCase) validateTokenTTLs(accessTTL, refreshTTL *int32, allowClear bool) error {
+	if accessTTL != nil && (*accessTTL < 0 || *accessTTL == 0 && !allowClear) {
+		return fmt.Errorf("%w: accessTokenTtl must be positive", ErrInvalidTokenTTL)
+	}
+	if refreshTTL != nil && (*refreshTTL < 0 || *refreshTTL == 0 && !allowClear) {
+		return fmt.Errorf("%w: refreshTokenTtl must be positive", ErrInvalidTokenTTL)
+	}
+	if accessTTL != nil && u.config.UsesKeyRing() && time.Duration(*accessTTL)*time.Second > u.config.JWTKeyRetireAfter {
+		return fmt.Errorf("%w: accessTokenTtl must not exceed JWT_KEY_RETIRE_AFTER (%s)", ErrInvalidTokenTTL, u.config.JWTKeyRetireAfter)
+	}
+	return nil
+}
+
+// updatedTTL applies an UpdateRoleRequest TTL to the current override.
+func updatedTTL(current pgtype.Int4, req *int32) pgtype.Int4 {
+	switch {
+	case req == nil:
+		return current
+	case *req == 0:
+		return pgtype.Int4{}
 	}
+	return pgtype.Int4{Int32: *req, Valid: true}
 }
 
 func getString(s *string) string {
@@ -0,0 +1,216 @@
+package usecase
+
+import (
+	"context"
+	"crypto"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/zomzem/identity-service/internal/config"
+	"github.com/zomzem/identity-service/internal/idp"
+	"github.com/zomzem/identity-service/internal/repository"
+)
+
+var (
+	ErrUnknownSAMLProvider = errors.New("unknown saml identity provider")
+	ErrInvalidSAMLResponse = errors.New("invalid saml response")
+	ErrInvalidRelayState   = errors.New("invalid or expired saml login")
+)
+
+type SAMLProviderResponse struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// SAMLResponseRequest holds the form the IdP posts to the assertion consumer
+// service and the relay state the starting browser kept in a cookie.
+type SAMLResponseRequest struct {
+	SAMLResponse      string
+	RelayState        string
+	BrowserRelayState string
+}
+
+// addSAMLProviders registers the configured SAML providers, all sharing the
+// service provider key pair.
+func addSAMLProviders(registry *idp.Registry, cfg *config.Config) error {
+	if len(cfg.SAMLProviders) == 0 {
+		return nil
+	}
+	keyPair, err := tls.LoadX509KeyPair(cfg.SAMLCertFile, cfg.SAMLKeyFile)
+	if err != nil {
+		return fmt.Errorf("saml service provider key pair: %w", err)
+	}
+	key, ok := keyPair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return errors.New("saml service provider key cannot sign")
+	}
+
+	for _, p := range cfg.SAMLProviders {
+		var metadata []byte
+		if p.IDPMetadataFile != "" {
+			metadata, err = os.ReadFile(p.IDPMetadataFile)
+			if err != nil {
+				return fmt.Errorf("saml %s metadata: %w", p.Name, err)
+			}
+		}
+		provider, err := idp.NewSAMLProvider(idp.SAMLConfig{
+			Name:        p.Name,
+			DisplayName: p.DisplayName,
+			MetadataURL: p.IDPMetadataURL,
+			Metadata:    metadata,
+			EntityID:    samlURL(cfg, p.Name, "metadata"),
+			ACSURL:      samlURL(cfg, p.Name, "acs"),
+			Key:         key,
+			Certificate: keyPair.Leaf,
+			Attributes: idp.SAMLAttributes{
+				Email:  p.AttrEmail,
+				Name:   p.AttrName,
+				Groups: p.AttrGroups,
+			},
+			TrustEmail:   p.TrustEmail,
+			Provisioning: provisioningRules(p.Provisioning, p.AllowedDomains, p.DefaultRole, p.DomainRoles),
+		})
+		if err != nil {
+			return err
+		}
+		registry.AddSAML(provider)
+	}
+	return nil
+}
+
+func samlURL(cfg *config.Config, provider, endpoint string) string {
+	return strings.TrimRight(cfg.SAMLBaseURL, "/") + "/auth/saml/" + url.PathEscape(provider) + "/" + endpoint
+}
+
+func (u *authUseCase) ListSAMLProviders() []SAMLProviderResponse {
+	res := make([]SAMLProviderResponse, 0)
+	for _, p := range u.providers.SAMLProviders() {
+		cfg := p.Config()
+		res = append(res, SAMLProviderResponse{Name: cfg.Name, DisplayName: cfg.DisplayName})
+	}
+	return res
+}
+
+func (u *authUseCase) SAMLMetadata(provider string) ([]byte, error) {
+	p, err := u.providers.GetSAML(provider)
+	if err != nil {
+		return nil, ErrUnknownSAMLProvider
+	}
+	return p.SPMetadata()
+}
+
+// StartSAMLLogin returns the IdP URL carrying the AuthnRequest and the relay
+// state the browser has to present at the ACS. returnTo is where the browser
+// goes once the login is done.
+func (u *authUseCase) StartSAMLLogin(ctx context.Context, provider, returnTo string) (string, string, error) {
+	return u.startSAMLRequest(ctx, provider, returnTo, pgtype.Int4{})
+}
+
+// StartSAMLLink is StartSAMLLogin for a signed-in user, whose account the
+// identity in the response gets linked to instead of logging in. It is how
+// identities the provider does not vouch an email for get linked.
+func (u *authUseCase) StartSAMLLink(ctx context.Context, userID int32, provider, returnTo string) (string, string, error) {
+	return u.startSAMLRequest(ctx, provider, returnTo, pgtype.Int4{Int32: userID, Valid: true})
+}
+
+func (u *authUseCase) startSAMLRequest(ctx context.Context, provider, returnTo string, linkUserID pgtype.Int4) (string, string, error) {
+	p, err := u.providers.GetSAML(provider)
+	if err != nil {
+		return "", "", ErrUnknownSAMLProvider
+	}
+	if returnTo == "" {
+		returnTo = u.config.OIDCReturnURLs[0]
+	}
+	if !allowedReturnURL(returnTo, u.config.OIDCReturnURLs) {
+		return "", "", ErrInvalidReturnURL
+	}
+
+	// 1. Fresh relay state, also kept by the browser to tie the response to it
+	relayState, err := newOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	authURL, requestID, err := p.AuthnRequestURL(ctx, relayState)
+	if err != nil {
+		return "", "", err
+	}
+
+	// 2. Remember the request until the response
+	err = u.store.CreateSAMLRequest(ctx, repository.CreateSAMLRequestParams{
+		RelayStateHash: hashToken(relayState),
+		Provider:       provider,
+		RequestID:      requestID,
+		ReturnTo:       returnTo,
+		ExpiresAt:      pgtype.Timestamptz{Time: time.Now().Add(u.config.SAMLRequestTTL), Valid: true},
+		LinkUserID:     linkUserID,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, relayState, nil
+}
+
+// FinishSAMLLogin completes a login at the assertion consumer service. The
+// returned URL is where the browser should go next; it is set whenever the
+// relay state was valid, also on error. Responses to StartSAMLLink link the
+// identity and return no login.
+func (u *authUseCase) FinishSAMLLogin(ctx context.Context, provider string, req SAMLResponseRequest, client ClientInfo) (*LoginResponse, string, error) {
+	p, err := u.providers.GetSAML(provider)
+	if err != nil {
+		return nil, "", ErrUnknownSAMLProvider
+	}
+	attempt := loginAttempt{Method: LoginMethodSAML, Outcome: LoginOutcomeFailure}
+
+	// 1. Load the request sent at /login by this browser, IdP-initiated
+	// logins and responses to someone else's login have none
+	if req.BrowserRelayState == "" || subtle.ConstantTimeCompare([]byte(req.BrowserRelayState), []byte(req.RelayState)) != 1 {
+		return nil, "", ErrInvalidRelayState
+	}
+	request, err := u.store.TakeSAMLRequest(ctx, repository.TakeSAMLRequestParams{
+		RelayStateHash: hashToken(req.RelayState),
+		Provider:       provider,
+	})
+	if err != nil || !request.ExpiresAt.Time.After(time.Now()) {
+		return nil, "", ErrInvalidRelayState
+	}
+	if _, err := u.store.DeleteExpiredSAMLRequests(ctx); err != nil {
+		log.Printf("[Auth] Failed to delete expired SAML requests: %v", err)
+	}
+
+	// 2. Verify the response answers that request
+	identity, err := p.ParseResponse(ctx, req.SAMLResponse, request.RequestID)
+	if err != nil {
+		log.Printf("[Auth] SAML %s response validation failed: %v", provider, err)
+		if !request.LinkUserID.Valid {
+			u.recordLoginEvent(ctx, attempt.fail(FailureInvalidSAMLResponse), client)
+		}
+		if errors.Is(err, idp.ErrInvalidSAMLResponse) {
+			err = ErrInvalidSAMLResponse
+		}
+		return nil, request.ReturnTo, err
+	}
+	attempt.Username = identity.Email
+
+	// 3. Link the identity to the user who started the request under /me
+	if request.LinkUserID.Valid {
+		if _, err := linkIdentity(ctx, u.store, u.events, request.LinkUserID.Int32, identity); err != nil {
+			return nil, request.ReturnTo, err
+		}
+		log.Printf("[Auth] Linked %s identity to user %d", identity.Provider, request.LinkUserID.Int32)
+		return nil, request.ReturnTo, nil
+	}
+
+	// 4. Otherwise log in as with an OIDC provider, only trusting verified emails
+	cfg := p.Config()
+	rules := idp.Config{Name: cfg.Name, RequireVerifiedEmail: true, Provisioning: cfg.Provisioning}
+	resp, err := u.loginIdentity(ctx, rules, identity, attempt, client)
+	return resp, request.ReturnTo, err
+}
@@ -0,0 +1,252 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/xml"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/logger"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/zomzem/identity-service/internal/config"
+	"github.com/zomzem/identity-service/internal/idp"
+	"github.com/zomzem/identity-service/internal/repository"
+	"github.com/zomzem/identity-service/internal/signing"
+)
+
+const testReturnURL = "https://app.example.com/"
+
+func newSAMLCertificate(t *testing.T, commonName string) (*rsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+// samlIdP is an identity provider answering the AuthnRequests of the
+// service provider it was given, asserting the NameID jane and an email
+// address it does not vouch for.
+type samlIdP struct {
+	t   *testing.T
+	idp *saml.IdentityProvider
+	sp  *saml.EntityDescriptor
+}
+
+func (i *samlIdP) GetServiceProvider(r *http.Request, serviceProviderID string) (*saml.EntityDescriptor, error) {
+	if i.sp == nil || serviceProviderID != i.sp.EntityID {
+		return nil, os.ErrNotExist
+	}
+	return i.sp, nil
+}
+
+// newSAMLProvider returns the corp provider of this service, registered at a
+// new IdP.
+func newSAMLProvider(t *testing.T) (*idp.SAMLProvider, *samlIdP) {
+	t.Helper()
+	idpKey, idpCert := newSAMLCertificate(t, "idp.example.com")
+	i := &samlIdP{t: t}
+	i.idp = &saml.IdentityProvider{
+		Key:                     idpKey,
+		Certificate:             idpCert,
+		Logger:                  logger.DefaultLogger,
+		MetadataURL:             url.URL{Scheme: "https", Host: "idp.example.com", Path: "/metadata"},
+		SSOURL:                  url.URL{Scheme: "https", Host: "idp.example.com", Path: "/sso"},
+		ServiceProviderProvider: i,
+	}
+	idpMetadata, err := xml.Marshal(i.idp.Metadata())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, cert := newSAMLCertificate(t, "id.example.com")
+	p, err := idp.NewSAMLProvider(idp.SAMLConfig{
+		Name:        "corp",
+		Metadata:    idpMetadata,
+		EntityID:    "https://id.example.com/auth/saml/corp/metadata",
+		ACSURL:      "https://id.example.com/auth/saml/corp/acs",
+		Key:         key,
+		Certificate: cert,
+		Attributes:  idp.SAMLAttributes{Email: "email"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spMetadata, err := p.SPMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.sp = &saml.EntityDescriptor{}
+	if err := xml.Unmarshal(spMetadata, i.sp); err != nil {
+		t.Fatal(err)
+	}
+	return p, i
+}
+
+// respond logs jane in for the AuthnRequest behind authURL and returns the
+// SAMLResponse the browser posts to the ACS.
+func (i *samlIdP) respond(authURL string) string {
+	i.t.Helper()
+	req, err := saml.NewIdpAuthnRequest(i.idp, httptest.NewRequest(http.MethodGet, authURL, nil))
+	if err != nil {
+		i.t.Fatal(err)
+	}
+	if err := req.Validate(); err != nil {
+		i.t.Fatalf("IdP rejected the AuthnRequest: %v", err)
+	}
+	session := &saml.Session{
+		ID:           "session-1",
+		NameID:       "jane",
+		NameIDFormat: string(saml.PersistentNameIDFormat),
+		CustomAttributes: []saml.Attribute{
+			{Name: "email", Values: []saml.AttributeValue{{Type: "xs:string", Value: "jane@example.com"}}},
+		},
+	}
+	if err := (saml.DefaultAssertionMaker{}).MakeAssertion(req, session); err != nil {
+		i.t.Fatal(err)
+	}
+	form, err := req.PostBinding()
+	if err != nil {
+		i.t.Fatal(err)
+	}
+	return form.SAMLResponse
+}
+
+type samlFixture struct {
+	store  *fakeStore
+	events *recordingEvents
+	auth   AuthUseCase
+	idp    *samlIdP
+}
+
+func newSAMLFixture(t *testing.T) *samlFixture {
+	t.Helper()
+	cfg := &config.Config{
+		OIDCReturnURLs:     []string{testReturnURL},
+		SAMLRequestTTL:     5 * time.Minute,
+		JWTExpiresIn:       15 * time.Minute,
+		RefreshTokenExpiry: 24 * time.Hour,
+	}
+	p, i := newSAMLProvider(t)
+	registry := idp.NewRegistry()
+	registry.AddSAML(p)
+	store := newFakeStore(
+		repository.User{ID: 7, Username: "jane", Email: pgtype.Text{String: "jane@example.com", Valid: true}, AuthSource: AuthSourceLocal,
+			PasswordHash: pgtype.Text{String: "hash", Valid: true}},
+		repository.User{ID: 8, Username: "john", AuthSource: AuthSourceLocal, PasswordHash: pgtype.Text{String: "hash", Valid: true}},
+	)
+	events := &recordingEvents{}
+	return &samlFixture{
+		store:  store,
+		events: events,
+		auth:   NewAuthUseCase(store, cfg, signing.NewHMACSigner("test-secret"), events, nil, registry, nil, nil),
+		idp:    i,
+	}
+}
+
+// finish posts the IdP's answer to the request behind authURL to the ACS
+// from the browser holding relayState.
+func (f *samlFixture) finish(t *testing.T, authURL, relayState string) (*LoginResponse, string, error) {
+	t.Helper()
+	return f.auth.FinishSAMLLogin(context.Background(), "corp", SAMLResponseRequest{
+		SAMLResponse:      f.idp.respond(authURL),
+		RelayState:        relayState,
+		BrowserRelayState: relayState,
+	}, ClientInfo{})
+}
+
+func (f *samlFixture) login(t *testing.T) (*LoginResponse, error) {
+	t.Helper()
+	authURL, relayState, err := f.auth.StartSAMLLogin(context.Background(), "corp", "")
+	if err != nil {
+		t.Fatalf("StartSAMLLogin: %v", err)
+	}
+	resp, _, err := f.finish(t, authURL, relayState)
+	return resp, err
+}
+
+func (f *samlFixture) link(t *testing.T, userID int32) (*LoginResponse, string, error) {
+	t.Helper()
+	authURL, relayState, err := f.auth.StartSAMLLink(context.Background(), userID, "corp", testReturnURL)
+	if err != nil {
+		t.Fatalf("StartSAMLLink: %v", err)
+	}
+	return f.finish(t, authURL, relayState)
+}
+
+func TestSAMLLink(t *testing.T) {
+	f := newSAMLFixture(t)
+
+	// The IdP does not vouch for the email, which cannot pick the account
+	if _, err := f.login(t); !errors.Is(err, ErrEmailNotVerified) {
+		t.Fatalf("first login: got %v, want ErrEmailNotVerified", err)
+	}
+
+	resp, returnTo, err := f.link(t, 7)
+	if err != nil {
+		t.Fatalf("link: %v", err)
+	}
+	if resp != nil || returnTo != testReturnURL {
+		t.Errorf("link returned login %v to %q", resp, returnTo)
+	}
+	link, err := f.store.GetUserIdentity(context.Background(), repository.GetUserIdentityParams{Provider: "saml:corp", Subject: "jane"})
+	if err != nil || link.UserID != 7 {
+		t.Fatalf("identity not linked to user 7: %+v, %v", link, err)
+	}
+	if f.events.count(EventIdentityLinked) != 1 {
+		t.Errorf("got %d identity_linked events, want 1", f.events.count(EventIdentityLinked))
+	}
+
+	// Linked, the identity logs in
+	resp, err = f.login(t)
+	if err != nil {
+		t.Fatalf("login after link: %v", err)
+	}
+	if resp.User.ID != 7 {
+		t.Errorf("logged in as user %d, want 7", resp.User.ID)
+	}
+}
+
+func TestSAMLLinkRejectsIdentityOfAnotherUser(t *testing.T) {
+	f := newSAMLFixture(t)
+	if _, _, err := f.link(t, 7); err != nil {
+		t.Fatalf("link: %v", err)
+	}
+
+	_, returnTo, err := f.link(t, 8)
+	if !errors.Is(err, ErrIdentityAlreadyLinked) {
+		t.Fatalf("got %v, want ErrIdentityAlreadyLinked", err)
+	}
+	if returnTo != testReturnURL {
+		t.Errorf("failed link returns to %q, want %q", returnTo, testReturnURL)
+	}
+	if got, _ := f.store.CountUserIdentities(context.Background(), 8); got != 0 {
+		t.Errorf("user 8 got %d identities", got)
+	}
+}
@@ -0,0 +1,56 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// Security event types
+const (
+	EventRefreshTokenReuse  = "refresh_token_reuse"
+	EventAccountLocked      = "account_locked"
+	EventMFAEnabled         = "mfa_enabled"
+	EventMFADisabled        = "mfa_disabled"
+	EventMFAReset           = "mfa_reset"
+	EventRecoveryCodeUsed   = "mfa_recovery_code_used"
+	EventWebAuthnRegistered = "webauthn_registered"
+	EventWebAuthnRemoved    = "webauthn_removed"
+	EventWebAuthnCloned     = "webauthn_clone_warning"
+	EventIdentityLinked     = "identity_linked"
+	EventIdentityUnlinked   = "identity_unlinked"
+)
+
+// SecurityEvent describes something the security team should be able to alert on.
+type SecurityEvent struct {
+	Type    string            `json:"type"`
+	UserID  int32             `json:"userId,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+	Time    time.Time         `json:"time"`
+}
+
+// SecurityEventSink receives security events. Emit must not block the request path.
+type SecurityEventSink interface {
+	Emit(ctx context.Context, event SecurityEvent)
+}
+
+type logSecurityEventSink struct{}
+
+// NewLogSecurityEventSink writes events as single JSON log lines so they can be
+// picked up by the log pipeline.
+func NewLogSecurityEventSink() SecurityEventSink {
+	return logSecurityEventSink{}
+}
+
+func (logSecurityEventSink) Emit(ctx context.Context, event SecurityEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("[SecurityEvent] %s user=%d (marshal failed: %v)", event.Type, event.UserID, err)
+		return
+	}
+	log.Printf("[SecurityEvent] %s", data)
+}
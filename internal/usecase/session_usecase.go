@@ -0,0 +1,90 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/zomzem/identity-service/internal/repository"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+type SessionUseCase interface {
+	// ListSessions returns the live sessions of a user. currentRefreshToken,
+	// when given, marks the caller's own session.
+	ListSessions(ctx context.Context, userID int32, currentRefreshToken string) ([]SessionResponse, error)
+	RevokeSession(ctx context.Context, userID int32, sessionID string) error
+	RevokeAllSessions(ctx context.Context, userID int32) error
+}
+
+type sessionUseCase struct {
+	store repository.Store
+}
+
+func NewSessionUseCase(store repository.Store) SessionUseCase {
+	return &sessionUseCase{store: store}
+}
+
+// SessionResponse is one login, identified by its refresh token family.
+type SessionResponse struct {
+	ID         string     `json:"id"`
+	UserAgent  *string    `json:"userAgent"`
+	IP         *string    `json:"ip"`
+	ClientName *string    `json:"clientName"`
+	CreatedAt  *time.Time `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	Current    bool       `json:"current"`
+}
+
+func (u *sessionUseCase) ListSessions(ctx context.Context, userID int32, currentRefreshToken string) ([]SessionResponse, error) {
+	tokens, err := u.store.ListUserSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	currentHash := ""
+	if currentRefreshToken != "" {
+		currentHash = hashToken(currentRefreshToken)
+	}
+
+	res := make([]SessionResponse, 0, len(tokens))
+	for _, t := range tokens {
+		res = append(res, SessionResponse{
+			ID:         t.FamilyID.String(),
+			UserAgent:  stringPtr(t.UserAgent.String, t.UserAgent.Valid),
+			IP:         stringPtr(t.IpAddress.String, t.IpAddress.Valid),
+			ClientName: stringPtr(t.ClientName.String, t.ClientName.Valid),
+			CreatedAt:  timePtr(t.SessionStartedAt),
+			LastUsedAt: timePtr(t.CreatedAt), // each refresh issues a new token
+			ExpiresAt:  t.ExpiresAt.Time,
+			Current:    t.TokenHash == currentHash,
+		})
+	}
+	return res, nil
+}
+
+func (u *sessionUseCase) RevokeSession(ctx context.Context, userID int32, sessionID string) error {
+	var familyID pgtype.UUID
+	if err := familyID.Scan(sessionID); err != nil {
+		return ErrSessionNotFound
+	}
+
+	rows, err := u.store.RevokeUserSession(ctx, repository.RevokeUserSessionParams{
+		UserID:   userID,
+		FamilyID: familyID,
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (u *sessionUseCase) RevokeAllSessions(ctx context.Context, userID int32) error {
+	return u.store.RevokeUserRefreshTokens(ctx, userID)
+}
@@ -0,0 +1,573 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/zomzem/identity-service/internal/repository"
+)
+
+// fakeStore keeps the rows the use cases under test touch in memory.
+// Queries no test needs panic on the nil Store.
+type fakeStore struct {
+	repository.Store
+
+	mu          sync.Mutex
+	users       map[int32]repository.User
+	credentials []repository.WebauthnCredential
+	sessions    map[string]repository.WebauthnSession
+	identities  []repository.UserIdentity
+	samlReqs    map[string]repository.SamlRequest
+	totps       map[int32]repository.UserTotp
+	challenges  []repository.MfaChallenge
+	emailLogins []repository.EmailLoginToken
+	resets      []repository.PasswordResetToken
+	refresh     []repository.RefreshToken
+	loginEvents []repository.CreateLoginEventParams
+}
+
+func newFakeStore(users ...repository.User) *fakeStore {
+	s := &fakeStore{
+		users:    make(map[int32]repository.User),
+		sessions: make(map[string]repository.WebauthnSession),
+		samlReqs: make(map[string]repository.SamlRequest),
+		totps:    make(map[int32]repository.UserTotp),
+	}
+	for _, u := range users {
+		s.users[u.ID] = u
+	}
+	return s
+}
+
+func (s *fakeStore) ExecTx(ctx context.Context, fn func(repository.Querier) error) error {
+	return fn(s)
+}
+
+func (s *fakeStore) GetUserById(ctx context.Context, id int32) (repository.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[id]
+	if !ok {
+		return repository.User{}, pgx.ErrNoRows
+	}
+	return user, nil
+}
+
+func (s *fakeStore) GetUserByEmail(ctx context.Context, email pgtype.Text) (repository.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.Email.Valid && strings.EqualFold(u.Email.String, email.String) {
+			return u, nil
+		}
+	}
+	return repository.User{}, pgx.ErrNoRows
+}
+
+func (s *fakeStore) GetUserIdentity(ctx context.Context, arg repository.GetUserIdentityParams) (repository.UserIdentity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, i := range s.identities {
+		if i.Provider == arg.Provider && i.Subject == arg.Subject {
+			return i, nil
+		}
+	}
+	return repository.UserIdentity{}, pgx.ErrNoRows
+}
+
+func (s *fakeStore) CreateUserIdentity(ctx context.Context, arg repository.CreateUserIdentityParams) (repository.UserIdentity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := repository.UserIdentity{
+		ID:          int32(len(s.identities) + 1),
+		UserID:      arg.UserID,
+		Provider:    arg.Provider,
+		Subject:     arg.Subject,
+		Email:       arg.Email,
+		LastLoginAt: arg.LastLoginAt,
+	}
+	s.identities = append(s.identities, i)
+	return i, nil
+}
+
+func (s *fakeStore) UpdateUserIdentityLogin(ctx context.Context, arg repository.UpdateUserIdentityLoginParams) error {
+	return nil
+}
+
+func (s *fakeStore) CountUserIdentities(ctx context.Context, userID int32) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for _, i := range s.identities {
+		if i.UserID == userID {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *fakeStore) CountUserWebAuthnCredentials(ctx context.Context, userID int32) (int64, error) {
+	credentials, err := s.ListUserWebAuthnCredentials(ctx, userID)
+	return int64(len(credentials)), err
+}
+
+func (s *fakeStore) GetUserByUsername(ctx context.Context, username string) (repository.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.Username == username {
+			return u, nil
+		}
+	}
+	return repository.User{}, pgx.ErrNoRows
+}
+
+func (s *fakeStore) CreateUser(ctx context.Context, arg repository.CreateUserParams) (repository.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := repository.User{
+		ID:           1,
+		Username:     arg.Username,
+		PasswordHash: arg.PasswordHash,
+		FullName:     arg.FullName,
+		Email:        arg.Email,
+		Avatar:       arg.Avatar,
+		RoleID:       arg.RoleID,
+		Status:       arg.Status,
+		AuthSource:   AuthSourceLocal,
+	}
+	for _, u := range s.users {
+		if u.ID >= user.ID {
+			user.ID = u.ID + 1
+		}
+	}
+	s.users[user.ID] = user
+	return user, nil
+}
+
+func (s *fakeStore) UpdateUserExternalLogin(ctx context.Context, arg repository.UpdateUserExternalLoginParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := s.users[arg.ID]
+	user.ExternalLogin = arg.ExternalLogin
+	s.users[arg.ID] = user
+	return nil
+}
+
+func (s *fakeStore) UpdateUserAuthSource(ctx context.Context, arg repository.UpdateUserAuthSourceParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := s.users[arg.ID]
+	user.AuthSource = arg.AuthSource
+	s.users[arg.ID] = user
+	return nil
+}
+
+func (s *fakeStore) RegisterFailedLogin(ctx context.Context, id int32) (repository.RegisterFailedLoginRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.users[id]
+	u.FailedLoginAttempts++
+	s.users[id] = u
+	return repository.RegisterFailedLoginRow{FailedLoginAttempts: u.FailedLoginAttempts, LockoutCount: u.LockoutCount}, nil
+}
+
+func (s *fakeStore) LockUser(ctx context.Context, arg repository.LockUserParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.users[arg.ID]
+	u.LockedUntil = arg.LockedUntil
+	u.LockoutCount++
+	u.FailedLoginAttempts = 0
+	s.users[arg.ID] = u
+	return nil
+}
+
+func (s *fakeStore) ResetFailedLogins(ctx context.Context, id int32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.users[id]
+	u.FailedLoginAttempts, u.LockoutCount, u.LockedUntil = 0, 0, pgtype.Timestamptz{}
+	s.users[id] = u
+	return nil
+}
+
+func (s *fakeStore) GetUserTOTP(ctx context.Context, userID int32) (repository.UserTotp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	factor, ok := s.totps[userID]
+	if !ok {
+		return repository.UserTotp{}, pgx.ErrNoRows
+	}
+	return factor, nil
+}
+
+func (s *fakeStore) UseUserTOTPStep(ctx context.Context, arg repository.UseUserTOTPStepParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	factor, ok := s.totps[arg.UserID]
+	if !ok || (factor.LastUsedStep.Valid && factor.LastUsedStep.Int64 >= arg.LastUsedStep.Int64) {
+		return 0, nil
+	}
+	factor.LastUsedStep = arg.LastUsedStep
+	s.totps[arg.UserID] = factor
+	return 1, nil
+}
+
+func (s *fakeStore) UseRecoveryCode(ctx context.Context, arg repository.UseRecoveryCodeParams) (int64, error) {
+	return 0, nil
+}
+
+func (s *fakeStore) CountUnusedRecoveryCodes(ctx context.Context, userID int32) (int64, error) {
+	return 0, nil
+}
+
+func (s *fakeStore) CreateMFAChallenge(ctx context.Context, arg repository.CreateMFAChallengeParams) (repository.MfaChallenge, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := repository.MfaChallenge{
+		ID:        int32(len(s.challenges) + 1),
+		UserID:    arg.UserID,
+		TokenHash: arg.TokenHash,
+		ExpiresAt: arg.ExpiresAt,
+		IpAddress: arg.IpAddress,
+	}
+	s.challenges = append(s.challenges, c)
+	return c, nil
+}
+
+func (s *fakeStore) GetMFAChallenge(ctx context.Context, tokenHash string) (repository.MfaChallenge, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.challenges {
+		if c.TokenHash == tokenHash && !c.UsedAt.Valid && c.ExpiresAt.Time.After(time.Now()) {
+			return c, nil
+		}
+	}
+	return repository.MfaChallenge{}, pgx.ErrNoRows
+}
+
+func (s *fakeStore) IncrementMFAChallengeAttempts(ctx context.Context, id int32) (int32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.challenges[id-1].Attempts++
+	return s.challenges[id-1].Attempts, nil
+}
+
+func (s *fakeStore) UseMFAChallenge(ctx context.Context, id int32) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.challenges[id-1].UsedAt.Valid {
+		return 0, nil
+	}
+	s.challenges[id-1].UsedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+	return 1, nil
+}
+
+func (s *fakeStore) DeleteExpiredMFAChallenges(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (s *fakeStore) ListUserWebAuthnCredentials(ctx context.Context, userID int32) ([]repository.WebauthnCredential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []repository.WebauthnCredential
+	for _, c := range s.credentials {
+		if c.UserID == userID {
+			res = append(res, c)
+		}
+	}
+	return res, nil
+}
+
+func (s *fakeStore) CreateWebAuthnCredential(ctx context.Context, arg repository.CreateWebAuthnCredentialParams) (repository.WebauthnCredential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := repository.WebauthnCredential{
+		ID:           int32(len(s.credentials) + 1),
+		UserID:       arg.UserID,
+		CredentialID: arg.CredentialID,
+		Name:         arg.Name,
+		Credential:   arg.Credential,
+		CreatedAt:    pgtype.Timestamptz{Time: time.Now(), Valid: true},
+	}
+	s.credentials = append(s.credentials, c)
+	return c, nil
+}
+
+func (s *fakeStore) UpdateWebAuthnCredentialUsage(ctx context.Context, arg repository.UpdateWebAuthnCredentialUsageParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, c := range s.credentials {
+		if bytes.Equal(c.CredentialID, arg.CredentialID) {
+			s.credentials[i].Credential = arg.Credential
+			s.credentials[i].LastUsedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+		}
+	}
+	return nil
+}
+
+func (s *fakeStore) CreateWebAuthnSession(ctx context.Context, arg repository.CreateWebAuthnSessionParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[arg.TokenHash] = repository.WebauthnSession{
+		TokenHash:   arg.TokenHash,
+		UserID:      arg.UserID,
+		Ceremony:    arg.Ceremony,
+		SessionData: arg.SessionData,
+		ExpiresAt:   arg.ExpiresAt,
+	}
+	return nil
+}
+
+func (s *fakeStore) TakeWebAuthnSession(ctx context.Context, arg repository.TakeWebAuthnSessionParams) (repository.WebauthnSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[arg.TokenHash]
+	if !ok || session.Ceremony != arg.Ceremony {
+		return repository.WebauthnSession{}, pgx.ErrNoRows
+	}
+	delete(s.sessions, arg.TokenHash)
+	return session, nil
+}
+
+func (s *fakeStore) DeleteExpiredWebAuthnSessions(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (s *fakeStore) InvalidateUserEmailLoginTokens(ctx context.Context, userID int32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, lt := range s.emailLogins {
+		if lt.UserID == userID && !lt.UsedAt.Valid {
+			s.emailLogins[i].UsedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+		}
+	}
+	return nil
+}
+
+func (s *fakeStore) CreateEmailLoginToken(ctx context.Context, arg repository.CreateEmailLoginTokenParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.emailLogins = append(s.emailLogins, repository.EmailLoginToken{
+		ID:        int32(len(s.emailLogins) + 1),
+		UserID:    arg.UserID,
+		TokenHash: arg.TokenHash,
+		CodeHash:  arg.CodeHash,
+		ExpiresAt: arg.ExpiresAt,
+		IpAddress: arg.IpAddress,
+		CreatedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true},
+	})
+	return nil
+}
+
+func (s *fakeStore) GetEmailLoginTokenByHash(ctx context.Context, tokenHash string) (repository.EmailLoginToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, lt := range s.emailLogins {
+		if lt.TokenHash == tokenHash && !lt.UsedAt.Valid && lt.ExpiresAt.Time.After(time.Now()) {
+			return lt, nil
+		}
+	}
+	return repository.EmailLoginToken{}, pgx.ErrNoRows
+}
+
+func (s *fakeStore) GetLatestEmailLoginToken(ctx context.Context, userID int32) (repository.EmailLoginToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.emailLogins) - 1; i >= 0; i-- {
+		lt := s.emailLogins[i]
+		if lt.UserID == userID && !lt.UsedAt.Valid && lt.ExpiresAt.Time.After(time.Now()) {
+			return lt, nil
+		}
+	}
+	return repository.EmailLoginToken{}, pgx.ErrNoRows
+}
+
+func (s *fakeStore) IncrementEmailLoginAttempts(ctx context.Context, id int32) (int32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.emailLogins[id-1].Attempts++
+	return s.emailLogins[id-1].Attempts, nil
+}
+
+func (s *fakeStore) UseEmailLoginToken(ctx context.Context, id int32) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.emailLogins[id-1].UsedAt.Valid {
+		return 0, nil
+	}
+	s.emailLogins[id-1].UsedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+	return 1, nil
+}
+
+func (s *fakeStore) DeleteExpiredEmailLoginTokens(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (s *fakeStore) CreateSAMLRequest(ctx context.Context, arg repository.CreateSAMLRequestParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.samlReqs[arg.RelayStateHash] = repository.SamlRequest{
+		RelayStateHash: arg.RelayStateHash,
+		Provider:       arg.Provider,
+		RequestID:      arg.RequestID,
+		ReturnTo:       arg.ReturnTo,
+		ExpiresAt:      arg.ExpiresAt,
+		LinkUserID:     arg.LinkUserID,
+	}
+	return nil
+}
+
+func (s *fakeStore) TakeSAMLRequest(ctx context.Context, arg repository.TakeSAMLRequestParams) (repository.SamlRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	request, ok := s.samlReqs[arg.RelayStateHash]
+	if !ok || request.Provider != arg.Provider {
+		return repository.SamlRequest{}, pgx.ErrNoRows
+	}
+	delete(s.samlReqs, arg.RelayStateHash)
+	return request, nil
+}
+
+func (s *fakeStore) DeleteExpiredSAMLRequests(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (s *fakeStore) CreateRefreshToken(ctx context.Context, arg repository.CreateRefreshTokenParams) (repository.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rt := repository.RefreshToken{ID: int32(len(s.refresh) + 1), UserID: arg.UserID, TokenHash: arg.TokenHash, ExpiresAt: arg.ExpiresAt}
+	s.refresh = append(s.refresh, rt)
+	return rt, nil
+}
+
+func (s *fakeStore) RevokeUserRefreshTokens(ctx context.Context, userID int32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, rt := range s.refresh {
+		if rt.UserID == userID && !rt.RevokedAt.Valid {
+			s.refresh[i].RevokedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+		}
+	}
+	return nil
+}
+
+func (s *fakeStore) UpdateUserPassword(ctx context.Context, arg repository.UpdateUserPasswordParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := s.users[arg.ID]
+	user.PasswordHash = arg.PasswordHash
+	user.MustChangePassword = arg.MustChangePassword
+	s.users[arg.ID] = user
+	return nil
+}
+
+func (s *fakeStore) InvalidateUserPasswordResetTokens(ctx context.Context, userID int32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, rt := range s.resets {
+		if rt.UserID == userID && !rt.UsedAt.Valid {
+			s.resets[i].UsedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+		}
+	}
+	return nil
+}
+
+func (s *fakeStore) CreatePasswordResetToken(ctx context.Context, arg repository.CreatePasswordResetTokenParams) (repository.PasswordResetToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rt := repository.PasswordResetToken{
+		ID:        int32(len(s.resets) + 1),
+		UserID:    arg.UserID,
+		TokenHash: arg.TokenHash,
+		ExpiresAt: arg.ExpiresAt,
+		IpAddress: arg.IpAddress,
+		CreatedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true},
+	}
+	s.resets = append(s.resets, rt)
+	return rt, nil
+}
+
+func (s *fakeStore) GetPasswordResetToken(ctx context.Context, tokenHash string) (repository.PasswordResetToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, rt := range s.resets {
+		if rt.TokenHash == tokenHash && !rt.UsedAt.Valid && rt.ExpiresAt.Time.After(time.Now()) {
+			return rt, nil
+		}
+	}
+	return repository.PasswordResetToken{}, pgx.ErrNoRows
+}
+
+func (s *fakeStore) UsePasswordResetToken(ctx context.Context, id int32) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.resets[id-1].UsedAt.Valid {
+		return 0, nil
+	}
+	s.resets[id-1].UsedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+	return 1, nil
+}
+
+func (s *fakeStore) DeleteExpiredPasswordResetTokens(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (s *fakeStore) GetUserPermissions(ctx context.Context, id int32) ([]repository.GetUserPermissionsRow, error) {
+	return nil, nil
+}
+
+func (s *fakeStore) UpdateUserLastLogin(ctx context.Context, arg repository.UpdateUserLastLoginParams) error {
+	return nil
+}
+
+func (s *fakeStore) CreateLoginEvent(ctx context.Context, arg repository.CreateLoginEventParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loginEvents = append(s.loginEvents, arg)
+	return nil
+}
+
+// storedSignCount returns the sign counter saved for the first credential.
+func (s *fakeStore) storedSignCount(t *testing.T) uint32 {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var credential webauthn.Credential
+	if err := json.Unmarshal(s.credentials[0].Credential, &credential); err != nil {
+		t.Fatal(err)
+	}
+	return credential.Authenticator.SignCount
+}
+
+type recordingEvents struct {
+	mu     sync.Mutex
+	events []SecurityEvent
+}
+
+func (r *recordingEvents) Emit(ctx context.Context, event SecurityEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recordingEvents) count(eventType string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, e := range r.events {
+		if e.Type == eventType {
+			n++
+		}
+	}
+	return n
+}
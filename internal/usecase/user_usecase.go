@@ -2,7 +2,14 @@ package usecase
 
 import (
 	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/zomzem/identity-service/internal/config"
+	"github.com/zomzem/identity-service/internal/password"
 	"github.com/zomzem/identity-service/internal/repository"
 )
 
@@ -12,28 +19,47 @@ type UserUseCase interface {
 	CreateUser(ctx context.Context, req CreateUserRequest) (*UserResponseWithRole, error)
 	UpdateUser(ctx context.Context, id int32, req UpdateUserRequest) (*UserResponseWithRole, error)
 	DeleteUser(ctx context.Context, id int32) error
+	// UnlockUser lifts a lockout and resets the failed login counters.
+	UnlockUser(ctx context.Context, id int32) error
 }
 
+var (
+	ErrUserNotFound      = errors.New("user not found")
+	ErrInvalidAuthSource = errors.New(`auth source must be "LOCAL" or "LDAP"`)
+)
+
 type userUseCase struct {
-	store repository.Store
+	store          repository.Store
+	config         *config.Config
+	passwordPolicy password.Policy
+	passwordHasher password.Hasher
 }
 
-func NewUserUseCase(store repository.Store) UserUseCase {
-	return &userUseCase{store: store}
+func NewUserUseCase(store repository.Store, cfg *config.Config, blocklist password.Blocklist) UserUseCase {
+	return &userUseCase{
+		store:          store,
+		config:         cfg,
+		passwordPolicy: newPasswordPolicy(cfg, blocklist),
+		passwordHasher: newPasswordHasher(cfg),
+	}
 }
 
 type UserResponseWithRole struct {
-	ID           int32   `json:"id"`
-	Username     string  `json:"username"`
-	FullName     string  `json:"fullName"`
-	Email        *string `json:"email"`
-	Phone        *string `json:"phone"`
-	Avatar       *string `json:"avatar"`
-	Status       string  `json:"status"`
-	RoleID       *int32  `json:"roleId"`
-	RoleName     *string `json:"roleName"`
-	RoleCode     *string `json:"roleCode"`
-	EmployeeCode *string `json:"employeeCode"`
+	ID           int32      `json:"id"`
+	Username     string     `json:"username"`
+	FullName     string     `json:"fullName"`
+	Email        *string    `json:"email"`
+	Phone        *string    `json:"phone"`
+	Avatar       *string    `json:"avatar"`
+	Status       string     `json:"status"`
+	RoleID       *int32     `json:"roleId"`
+	RoleName     *string    `json:"roleName"`
+	RoleCode     *string    `json:"roleCode"`
+	EmployeeCode *string    `json:"employeeCode"`
+	LockedUntil  *time.Time `json:"lockedUntil"`
+	AuthSource   string     `json:"authSource"`
+
+	MustChangePassword bool `json:"mustChangePassword"`
 }
 
 type CreateUserRequest struct {
@@ -44,6 +70,10 @@ type CreateUserRequest struct {
 	Avatar   *string `json:"avatar"`
 	RoleID   *int32  `json:"roleId"`
 	Status   *string `json:"status"`
+	// Password is optional, users without one can only log in externally
+	Password           *string `json:"password"`
+	MustChangePassword bool    `json:"mustChangePassword"`
+	AuthSource         *string `json:"authSource"` // LOCAL (default) or LDAP
 }
 
 type UpdateUserRequest struct {
@@ -53,6 +83,8 @@ type UpdateUserRequest struct {
 	Avatar   *string `json:"avatar"`
 	RoleID   *int32  `json:"roleId"`
 	Status   *string `json:"status"`
+	// AuthSource is left unchanged when nil
+	AuthSource *string `json:"authSource"`
 }
 
 func (u *userUseCase) ListUsers(ctx context.Context) ([]UserResponseWithRole, error) {
@@ -64,16 +96,20 @@ func (u *userUseCase) ListUsers(ctx context.Context) ([]UserResponseWithRole, er
 	res := make([]UserResponseWithRole, 0, len(users))
 	for _, user := range users {
 		res = append(res, UserResponseWithRole{
-			ID:       user.ID,
-			Username: user.Username,
-			FullName: user.FullName,
-			Email:    stringPtr(user.Email.String, user.Email.Valid),
-			Phone:    stringPtr(user.Phone.String, user.Phone.Valid),
-			Avatar:   stringPtr(user.Avatar.String, user.Avatar.Valid),
-			Status:   user.Status.String,
-			RoleID:   int32Ptr(user.RoleID.Int32, user.RoleID.Valid),
-			RoleName: stringPtr(user.RoleName.String, user.RoleName.Valid),
-			RoleCode: stringPtr(user.RoleCode.String, user.RoleCode.Valid),
+			ID:          user.ID,
+			Username:    user.Username,
+			FullName:    user.FullName,
+			Email:       stringPtr(user.Email.String, user.Email.Valid),
+			Phone:       stringPtr(user.Phone.String, user.Phone.Valid),
+			Avatar:      stringPtr(user.Avatar.String, user.Avatar.Valid),
+			Status:      user.Status.String,
+			RoleID:      int32Ptr(user.RoleID.Int32, user.RoleID.Valid),
+			RoleName:    stringPtr(user.RoleName.String, user.RoleName.Valid),
+			RoleCode:    stringPtr(user.RoleCode.String, user.RoleCode.Valid),
+			LockedUntil: activeLockout(user.LockedUntil),
+			AuthSource:  user.AuthSource,
+
+			MustChangePassword: user.MustChangePassword,
 		})
 	}
 	return res, nil
@@ -88,16 +124,20 @@ func (u *userUseCase) GetUserByID(ctx context.Context, id int32) (*UserResponseW
 	// For single user, we might want role info, but GetUserById only returns User model.
 	// We could call GetRoleById or update the query. Let's keep it simple for now or update query.
 	// Actually ListUsers is usually enough for the UI.
-	
+
 	res := UserResponseWithRole{
-		ID:       user.ID,
-		Username: user.Username,
-		FullName: user.FullName,
-		Email:    stringPtr(user.Email.String, user.Email.Valid),
-		Phone:    stringPtr(user.Phone.String, user.Phone.Valid),
-		Avatar:   stringPtr(user.Avatar.String, user.Avatar.Valid),
-		Status:   user.Status.String,
-		RoleID:   int32Ptr(user.RoleID.Int32, user.RoleID.Valid),
+		ID:          user.ID,
+		Username:    user.Username,
+		FullName:    user.FullName,
+		Email:       stringPtr(user.Email.String, user.Email.Valid),
+		Phone:       stringPtr(user.Phone.String, user.Phone.Valid),
+		Avatar:      stringPtr(user.Avatar.String, user.Avatar.Valid),
+		Status:      user.Status.String,
+		RoleID:      int32Ptr(user.RoleID.Int32, user.RoleID.Valid),
+		LockedUntil: activeLockout(user.LockedUntil),
+		AuthSource:  user.AuthSource,
+
+		MustChangePassword: user.MustChangePassword,
 	}
 	return &res, nil
 }
@@ -107,29 +147,66 @@ func (u *userUseCase) CreateUser(ctx context.Context, req CreateUserRequest) (*U
 	if req.Status != nil {
 		status = *req.Status
 	}
+	if req.AuthSource != nil && !validAuthSource(*req.AuthSource) {
+		return nil, ErrInvalidAuthSource
+	}
+
+	var passwordHash pgtype.Text
+	var passwordChangedAt pgtype.Timestamptz
+	if req.Password != nil {
+		info := password.UserInfo{Username: req.Username, Email: getString(req.Email)}
+		if err := checkPassword(u.passwordPolicy, *req.Password, info); err != nil {
+			return nil, err
+		}
+		hash, err := hashPassword(u.passwordHasher, *req.Password)
+		if err != nil {
+			return nil, err
+		}
+		passwordHash = hash
+		passwordChangedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+	}
 
 	user, err := u.store.CreateUser(ctx, repository.CreateUserParams{
-		Username: req.Username,
-		FullName: req.FullName,
-		Email:    pgtype.Text{String: getString(req.Email), Valid: req.Email != nil},
-		Phone:    pgtype.Text{String: getString(req.Phone), Valid: req.Phone != nil},
-		Avatar:   pgtype.Text{String: getString(req.Avatar), Valid: req.Avatar != nil},
-		RoleID:   pgtype.Int4{Int32: getInt32(req.RoleID), Valid: req.RoleID != nil},
-		Status:   pgtype.Text{String: status, Valid: true},
+		Username:           req.Username,
+		PasswordHash:       passwordHash,
+		MustChangePassword: req.MustChangePassword && req.Password != nil,
+		PasswordChangedAt:  passwordChangedAt,
+		FullName:           req.FullName,
+		Email:              pgtype.Text{String: getString(req.Email), Valid: req.Email != nil},
+		Phone:              pgtype.Text{String: getString(req.Phone), Valid: req.Phone != nil},
+		Avatar:             pgtype.Text{String: getString(req.Avatar), Valid: req.Avatar != nil},
+		RoleID:             pgtype.Int4{Int32: getInt32(req.RoleID), Valid: req.RoleID != nil},
+		Status:             pgtype.Text{String: status, Valid: true},
 	})
 	if err != nil {
 		return nil, err
 	}
+	if passwordHash.Valid {
+		if err := recordPasswordHistory(ctx, u.store, u.passwordPolicy, user.ID, passwordHash); err != nil {
+			log.Printf("[User] Failed to record password history for user %d: %v", user.ID, err)
+		}
+	}
+	if req.AuthSource != nil && *req.AuthSource != user.AuthSource {
+		if err := u.store.UpdateUserAuthSource(ctx, repository.UpdateUserAuthSourceParams{ID: user.ID, AuthSource: *req.AuthSource}); err != nil {
+			return nil, err
+		}
+		user.AuthSource = *req.AuthSource
+	}
 
 	return &UserResponseWithRole{
-		ID:       user.ID,
-		Username: user.Username,
-		FullName: user.FullName,
-		Status:   user.Status.String,
+		ID:                 user.ID,
+		Username:           user.Username,
+		FullName:           user.FullName,
+		Status:             user.Status.String,
+		AuthSource:         user.AuthSource,
+		MustChangePassword: user.MustChangePassword,
 	}, nil
 }
 
 func (u *userUseCase) UpdateUser(ctx context.Context, id int32, req UpdateUserRequest) (*UserResponseWithRole, error) {
+	if req.AuthSource != nil && !validAuthSource(*req.AuthSource) {
+		return nil, ErrInvalidAuthSource
+	}
 	user, err := u.store.UpdateUser(ctx, repository.UpdateUserParams{
 		ID:       id,
 		FullName: req.FullName,
@@ -142,12 +219,19 @@ func (u *userUseCase) UpdateUser(ctx context.Context, id int32, req UpdateUserRe
 	if err != nil {
 		return nil, err
 	}
+	if req.AuthSource != nil && *req.AuthSource != user.AuthSource {
+		if err := u.store.UpdateUserAuthSource(ctx, repository.UpdateUserAuthSourceParams{ID: user.ID, AuthSource: *req.AuthSource}); err != nil {
+			return nil, err
+		}
+		user.AuthSource = *req.AuthSource
+	}
 
 	return &UserResponseWithRole{
-		ID:       user.ID,
-		Username: user.Username,
-		FullName: user.FullName,
-		Status:   user.Status.String,
+		ID:         user.ID,
+		Username:   user.Username,
+		FullName:   user.FullName,
+		Status:     user.Status.String,
+		AuthSource: user.AuthSource,
 	}, nil
 }
 
@@ -155,6 +239,28 @@ func (u *userUseCase) DeleteUser(ctx context.Context, id int32) error {
 	return u.store.DeleteUser(ctx, id)
 }
 
+func (u *userUseCase) UnlockUser(ctx context.Context, id int32) error {
+	if _, err := u.store.GetUserById(ctx, id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	return u.store.ResetFailedLogins(ctx, id)
+}
+
+func validAuthSource(source string) bool {
+	return source == AuthSourceLocal || source == AuthSourceLDAP
+}
+
+// activeLockout returns the end of a lockout that is still running.
+func activeLockout(t pgtype.Timestamptz) *time.Time {
+	if !t.Valid || !t.Time.After(time.Now()) {
+		return nil
+	}
+	return &t.Time
+}
+
 func int32Ptr(i int32, valid bool) *int32 {
 	if !valid {
 		return nil
@@ -0,0 +1,147 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/zomzem/identity-service/internal/repository"
+)
+
+func (u *authUseCase) BeginWebAuthnLogin(ctx context.Context) (*WebAuthnCeremonyResponse, error) {
+	// Discoverable login: the authenticator picks the account, so nothing
+	// about which users exist is revealed before it answers.
+	assertion, session, err := u.webauthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return startWebAuthnSession(ctx, u.store, u.config, WebAuthnCeremonyLogin, 0, session, assertion)
+}
+
+func (u *authUseCase) FinishWebAuthnLogin(ctx context.Context, req WebAuthnAssertion, client ClientInfo) (*LoginResponse, error) {
+	attempt := loginAttempt{Method: LoginMethodWebAuthn, Outcome: LoginOutcomeFailure}
+
+	// 1. Load the ceremony
+	session, err := takeWebAuthnSession(ctx, u.store, req.SessionToken, WebAuthnCeremonyLogin)
+	if err != nil {
+		u.recordLoginEvent(ctx, attempt.fail(FailureInvalidWebAuthn), client)
+		return nil, err
+	}
+
+	// 2. Verify the assertion against the user named by the user handle.
+	// User verification makes the passkey alone a multi-factor login.
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(req.Credential)
+	if err != nil {
+		u.recordLoginEvent(ctx, attempt.fail(FailureInvalidWebAuthn), client)
+		return nil, ErrInvalidWebAuthnResponse
+	}
+	var owner *webAuthnUser
+	credential, err := u.webauthn.ValidateDiscoverableLogin(func(_, userHandle []byte) (webauthn.User, error) {
+		id, err := strconv.ParseInt(string(userHandle), 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		owner, err = loadWebAuthnUser(ctx, u.store, int32(id))
+		return owner, err
+	}, *session.data, parsed)
+	if owner != nil {
+		attempt.UserID = owner.user.ID
+		attempt.Username = owner.user.Username
+	}
+	if err != nil {
+		u.recordLoginEvent(ctx, attempt.fail(FailureInvalidWebAuthn), client)
+		return nil, ErrInvalidWebAuthnResponse
+	}
+	if err := u.acceptAssertion(ctx, owner.user, credential); err != nil {
+		u.recordLoginEvent(ctx, attempt.fail(FailureInvalidWebAuthn), client)
+		return nil, err
+	}
+
+	// 3. Generate Tokens
+	tokens, err := u.generateTokens(ctx, owner.user, client)
+	if err != nil {
+		return nil, err
+	}
+
+	// 4. Update Last Login
+	u.completeLogin(ctx, owner.user, attempt, client)
+
+	if _, err := u.store.DeleteExpiredWebAuthnSessions(ctx); err != nil {
+		log.Printf("[Auth] Failed to delete expired WebAuthn sessions: %v", err)
+	}
+
+	return u.newLoginResponse(ctx, owner.user, tokens), nil
+}
+
+func (u *authUseCase) BeginMFAWebAuthn(ctx context.Context, mfaToken string) (*WebAuthnCeremonyResponse, error) {
+	challenge, err := u.store.GetMFAChallenge(ctx, hashToken(mfaToken))
+	if err != nil {
+		return nil, ErrInvalidMFAChallenge
+	}
+	user, err := loadWebAuthnUser(ctx, u.store, challenge.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if len(user.credentials) == 0 {
+		return nil, ErrMFANotEnabled
+	}
+
+	assertion, session, err := u.webauthn.BeginLogin(user)
+	if err != nil {
+		return nil, err
+	}
+	return startWebAuthnSession(ctx, u.store, u.config, WebAuthnCeremonyMFA, user.user.ID, session, assertion)
+}
+
+// verifyWebAuthnFactor checks an assertion answering an MFA challenge of user.
+func (u *authUseCase) verifyWebAuthnFactor(ctx context.Context, user repository.User, assertion WebAuthnAssertion) (bool, error) {
+	session, err := takeWebAuthnSession(ctx, u.store, assertion.SessionToken, WebAuthnCeremonyMFA)
+	if err != nil {
+		if errors.Is(err, ErrInvalidWebAuthnSession) {
+			return false, nil
+		}
+		return false, err
+	}
+	if !session.userID.Valid || session.userID.Int32 != user.ID {
+		return false, nil
+	}
+
+	owner, err := loadWebAuthnUser(ctx, u.store, user.ID)
+	if err != nil {
+		return false, err
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(assertion.Credential)
+	if err != nil {
+		return false, nil
+	}
+	credential, err := u.webauthn.ValidateLogin(owner, *session.data, parsed)
+	if err != nil {
+		return false, nil
+	}
+	if err := u.acceptAssertion(ctx, user, credential); err != nil {
+		if errors.Is(err, ErrInvalidWebAuthnResponse) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// acceptAssertion refuses credentials whose sign counter went backwards, a
+// sign of a cloned authenticator, and stores the new counter otherwise.
+func (u *authUseCase) acceptAssertion(ctx context.Context, user repository.User, credential *webauthn.Credential) error {
+	if credential.Authenticator.CloneWarning {
+		u.events.Emit(ctx, SecurityEvent{
+			Type:    EventWebAuthnCloned,
+			UserID:  user.ID,
+			Details: map[string]string{"signCount": strconv.FormatUint(uint64(credential.Authenticator.SignCount), 10)},
+		})
+		return ErrInvalidWebAuthnResponse
+	}
+	return storeWebAuthnUsage(ctx, u.store, credential)
+}
@@ -0,0 +1,334 @@
+package usecase
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/zomzem/identity-service/internal/config"
+	"github.com/zomzem/identity-service/internal/repository"
+	"github.com/zomzem/identity-service/internal/signing"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "http://localhost:3000"
+)
+
+// softAuthenticator is a software passkey: an ES256 key with "none"
+// attestation and user verification. signCount is reported in the next
+// assertion as is, so tests can replay or rewind it.
+type softAuthenticator struct {
+	t            *testing.T
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	origin       string
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		t.Fatal(err)
+	}
+	return &softAuthenticator{t: t, key: key, credentialID: id, origin: testOrigin}
+}
+
+func (a *softAuthenticator) clientData(ceremony string, challenge protocol.URLEncodedBase64) []byte {
+	a.t.Helper()
+	data, err := json.Marshal(map[string]any{
+		"type":      ceremony,
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    a.origin,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return data
+}
+
+// authenticatorData builds the authenticator data with the user present and
+// verified flags, followed by attested, when set.
+func (a *softAuthenticator) authenticatorData(attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	flags := byte(protocol.FlagUserPresent | protocol.FlagUserVerified)
+	if attested != nil {
+		flags |= byte(protocol.FlagAttestedCredentialData)
+	}
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attested...)
+}
+
+// register answers navigator.credentials.create.
+func (a *softAuthenticator) register(options *protocol.CredentialCreation) json.RawMessage {
+	a.t.Helper()
+	a.userHandle = options.Response.User.ID.(protocol.URLEncodedBase64)
+
+	publicKey, err := webauthncbor.Marshal(map[int]any{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	attested := make([]byte, 16) // zero AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, publicKey...)
+
+	attestation, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authenticatorData(attested),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return a.credential(map[string]any{
+		"clientDataJSON":    a.clientData("webauthn.create", options.Response.Challenge),
+		"attestationObject": attestation,
+	})
+}
+
+// assert answers navigator.credentials.get.
+func (a *softAuthenticator) assert(options *protocol.CredentialAssertion) json.RawMessage {
+	a.t.Helper()
+	clientData := a.clientData("webauthn.get", options.Response.Challenge)
+	authData := a.authenticatorData(nil)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return a.credential(map[string]any{
+		"clientDataJSON":    clientData,
+		"authenticatorData": authData,
+		"signature":         signature,
+		"userHandle":        a.userHandle,
+	})
+}
+
+func (a *softAuthenticator) credential(response map[string]any) json.RawMessage {
+	a.t.Helper()
+	encoded := make(map[string]string, len(response))
+	for k, v := range response {
+		encoded[k] = base64.RawURLEncoding.EncodeToString(v.([]byte))
+	}
+	data, err := json.Marshal(map[string]any{
+		"id":       base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"rawId":    base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"type":     "public-key",
+		"response": encoded,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return data
+}
+
+type webAuthnFixture struct {
+	store  *fakeStore
+	events *recordingEvents
+	auth   AuthUseCase
+	keys   WebAuthnUseCase
+}
+
+func newWebAuthnFixture(t *testing.T) *webAuthnFixture {
+	t.Helper()
+	cfg := &config.Config{
+		WebAuthnRPID:       testRPID,
+		WebAuthnRPName:     "Identity Service",
+		WebAuthnRPOrigins:  []string{testOrigin},
+		WebAuthnTimeout:    5 * time.Minute,
+		JWTExpiresIn:       15 * time.Minute,
+		RefreshTokenExpiry: 24 * time.Hour,
+	}
+	wa, err := NewWebAuthn(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := newFakeStore(repository.User{ID: 7, Username: "jane", FullName: "Jane Doe"})
+	events := &recordingEvents{}
+	return &webAuthnFixture{
+		store:  store,
+		events: events,
+		auth:   NewAuthUseCase(store, cfg, signing.NewHMACSigner("test-secret"), events, wa, nil, nil, nil),
+		keys:   NewWebAuthnUseCase(store, cfg, wa, events),
+	}
+}
+
+func (f *webAuthnFixture) register(t *testing.T, a *softAuthenticator) (*WebAuthnCredentialResponse, error) {
+	t.Helper()
+	ctx := context.Background()
+	begin, err := f.keys.BeginRegistration(ctx, 7)
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+	return f.keys.FinishRegistration(ctx, 7, WebAuthnRegistrationRequest{
+		SessionToken: begin.SessionToken,
+		Credential:   a.register(begin.Options.(*protocol.CredentialCreation)),
+	})
+}
+
+func (f *webAuthnFixture) login(t *testing.T, a *softAuthenticator) (*LoginResponse, error) {
+	t.Helper()
+	ctx := context.Background()
+	begin, err := f.auth.BeginWebAuthnLogin(ctx)
+	if err != nil {
+		t.Fatalf("BeginWebAuthnLogin: %v", err)
+	}
+	return f.auth.FinishWebAuthnLogin(ctx, WebAuthnAssertion{
+		SessionToken: begin.SessionToken,
+		Credential:   a.assert(begin.Options.(*protocol.CredentialAssertion)),
+	}, ClientInfo{IP: "127.0.0.1"})
+}
+
+func TestWebAuthnRegistration(t *testing.T) {
+	f := newWebAuthnFixture(t)
+	a := newSoftAuthenticator(t)
+
+	created, err := f.register(t, a)
+	if err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+	if created.Name != "Security key 1" {
+		t.Errorf("default name %q", created.Name)
+	}
+	if string(a.userHandle) != "7" {
+		t.Errorf("user handle %q, want the user ID", a.userHandle)
+	}
+	if f.events.count(EventWebAuthnRegistered) != 1 {
+		t.Error("no registration event")
+	}
+}
+
+func TestWebAuthnRegistrationRejectsOtherOrigin(t *testing.T) {
+	f := newWebAuthnFixture(t)
+	a := newSoftAuthenticator(t)
+	a.origin = "https://evil.example.com"
+
+	if _, err := f.register(t, a); !errors.Is(err, ErrInvalidWebAuthnResponse) {
+		t.Fatalf("got %v, want ErrInvalidWebAuthnResponse", err)
+	}
+	if len(f.store.credentials) != 0 {
+		t.Error("stored a credential created for another origin")
+	}
+}
+
+func TestWebAuthnLoginSignCount(t *testing.T) {
+	f := newWebAuthnFixture(t)
+	a := newSoftAuthenticator(t)
+	if _, err := f.register(t, a); err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+
+	for _, count := range []uint32{1, 5} {
+		a.signCount = count
+		resp, err := f.login(t, a)
+		if err != nil {
+			t.Fatalf("login with counter %d: %v", count, err)
+		}
+		if resp.AccessToken == "" || resp.RefreshToken == "" || resp.User.Username != "jane" {
+			t.Errorf("unexpected login response %+v", resp)
+		}
+		if got := f.store.storedSignCount(t); got != count {
+			t.Errorf("stored counter %d, want %d", got, count)
+		}
+	}
+
+	// A counter that does not move forward means a cloned key is in use
+	for _, count := range []uint32{5, 3} {
+		a.signCount = count
+		if _, err := f.login(t, a); !errors.Is(err, ErrInvalidWebAuthnResponse) {
+			t.Errorf("counter %d after 5: got %v, want ErrInvalidWebAuthnResponse", count, err)
+		}
+	}
+	if got := f.store.storedSignCount(t); got != 5 {
+		t.Errorf("rejected assertion changed the stored counter to %d", got)
+	}
+	if got := f.events.count(EventWebAuthnCloned); got != 2 {
+		t.Errorf("%d clone events, want 2", got)
+	}
+	last := f.store.loginEvents[len(f.store.loginEvents)-1]
+	if last.Outcome != LoginOutcomeFailure || last.FailureReason.String != FailureInvalidWebAuthn || last.UserID.Int32 != 7 {
+		t.Errorf("unexpected login event %+v", last)
+	}
+}
+
+func TestWebAuthnLoginWithoutCounter(t *testing.T) {
+	f := newWebAuthnFixture(t)
+	a := newSoftAuthenticator(t)
+	if _, err := f.register(t, a); err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+
+	// Authenticators without a counter, such as synced passkeys, always send 0
+	for range 2 {
+		if _, err := f.login(t, a); err != nil {
+			t.Fatalf("login without counter: %v", err)
+		}
+	}
+	if f.events.count(EventWebAuthnCloned) != 0 {
+		t.Error("clone event for an authenticator without counter")
+	}
+}
+
+func TestWebAuthnLoginRejectsOtherKey(t *testing.T) {
+	f := newWebAuthnFixture(t)
+	a := newSoftAuthenticator(t)
+	if _, err := f.register(t, a); err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+
+	// Same credential ID and user handle, different private key
+	forged := newSoftAuthenticator(t)
+	forged.credentialID, forged.userHandle = a.credentialID, a.userHandle
+	if _, err := f.login(t, forged); !errors.Is(err, ErrInvalidWebAuthnResponse) {
+		t.Fatalf("got %v, want ErrInvalidWebAuthnResponse", err)
+	}
+}
+
+func TestWebAuthnLoginRejectsReusedCeremony(t *testing.T) {
+	f := newWebAuthnFixture(t)
+	a := newSoftAuthenticator(t)
+	if _, err := f.register(t, a); err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+
+	ctx := context.Background()
+	begin, err := f.auth.BeginWebAuthnLogin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := begin.Options.(*protocol.CredentialAssertion)
+	a.signCount = 1
+	if _, err := f.auth.FinishWebAuthnLogin(ctx, WebAuthnAssertion{SessionToken: begin.SessionToken, Credential: a.assert(options)}, ClientInfo{}); err != nil {
+		t.Fatalf("first finish: %v", err)
+	}
+	a.signCount = 2
+	_, err = f.auth.FinishWebAuthnLogin(ctx, WebAuthnAssertion{SessionToken: begin.SessionToken, Credential: a.assert(options)}, ClientInfo{})
+	if !errors.Is(err, ErrInvalidWebAuthnSession) {
+		t.Fatalf("got %v, want ErrInvalidWebAuthnSession", err)
+	}
+}
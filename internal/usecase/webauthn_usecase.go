@@ -0,0 +1,339 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/zomzem/identity-service/internal/config"
+	"github.com/zomzem/identity-service/internal/repository"
+)
+
+var (
+	ErrInvalidWebAuthnSession    = errors.New("invalid or expired webauthn session")
+	ErrInvalidWebAuthnResponse   = errors.New("webauthn verification failed")
+	ErrWebAuthnCredentialMissing = errors.New("webauthn credential not found")
+)
+
+// WebAuthn ceremonies, each finish only accepts state from its own begin
+const (
+	WebAuthnCeremonyRegistration = "REGISTRATION"
+	WebAuthnCeremonyLogin        = "LOGIN"
+	WebAuthnCeremonyMFA          = "MFA"
+)
+
+type WebAuthnUseCase interface {
+	// BeginRegistration returns the options for navigator.credentials.create.
+	BeginRegistration(ctx context.Context, userID int32) (*WebAuthnCeremonyResponse, error)
+	FinishRegistration(ctx context.Context, userID int32, req WebAuthnRegistrationRequest) (*WebAuthnCredentialResponse, error)
+	ListCredentials(ctx context.Context, userID int32) ([]WebAuthnCredentialResponse, error)
+	DeleteCredential(ctx context.Context, userID, id int32) error
+}
+
+type webAuthnUseCase struct {
+	store    repository.Store
+	config   *config.Config
+	webauthn *webauthn.WebAuthn
+	events   SecurityEventSink
+}
+
+func NewWebAuthnUseCase(store repository.Store, cfg *config.Config, wa *webauthn.WebAuthn, events SecurityEventSink) WebAuthnUseCase {
+	return &webAuthnUseCase{store: store, config: cfg, webauthn: wa, events: events}
+}
+
+// NewWebAuthn configures the relying party shared by registration and login.
+func NewWebAuthn(cfg *config.Config) (*webauthn.WebAuthn, error) {
+	timeout := webauthn.TimeoutConfig{Enforce: true, Timeout: cfg.WebAuthnTimeout, TimeoutUVD: cfg.WebAuthnTimeout}
+	return webauthn.New(&webauthn.Config{
+		RPID:          cfg.WebAuthnRPID,
+		RPDisplayName: cfg.WebAuthnRPName,
+		RPOrigins:     cfg.WebAuthnRPOrigins,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        timeout,
+			Registration: timeout,
+		},
+	})
+}
+
+// WebAuthnCeremonyResponse carries the options to hand to the browser and the
+// token identifying the ceremony in the finish request.
+type WebAuthnCeremonyResponse struct {
+	SessionToken string `json:"sessionToken"`
+	Options      any    `json:"options"`
+}
+
+type WebAuthnRegistrationRequest struct {
+	SessionToken string          `json:"sessionToken"`
+	Name         string          `json:"name"`
+	Credential   json.RawMessage `json:"credential"`
+}
+
+// WebAuthnAssertion answers an assertion ceremony with the PublicKeyCredential
+// returned by navigator.credentials.get.
+type WebAuthnAssertion struct {
+	SessionToken string          `json:"sessionToken"`
+	Credential   json.RawMessage `json:"credential"`
+}
+
+type WebAuthnCredentialResponse struct {
+	ID         int32      `json:"id"`
+	Name       string     `json:"name"`
+	Synced     bool       `json:"synced"` // backup eligible, e.g. a passkey in a password manager
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+func (u *webAuthnUseCase) BeginRegistration(ctx context.Context, userID int32) (*WebAuthnCeremonyResponse, error) {
+	user, err := loadWebAuthnUser(ctx, u.store, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	creation, session, err := u.webauthn.BeginRegistration(user,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+		webauthn.WithExclusions(webauthn.Credentials(user.credentials).CredentialDescriptors()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return startWebAuthnSession(ctx, u.store, u.config, WebAuthnCeremonyRegistration, userID, session, creation)
+}
+
+func (u *webAuthnUseCase) FinishRegistration(ctx context.Context, userID int32, req WebAuthnRegistrationRequest) (*WebAuthnCredentialResponse, error) {
+	// 1. Load the ceremony started by this user
+	session, err := takeWebAuthnSession(ctx, u.store, req.SessionToken, WebAuthnCeremonyRegistration)
+	if err != nil {
+		return nil, err
+	}
+	if !session.userID.Valid || session.userID.Int32 != userID {
+		return nil, ErrInvalidWebAuthnSession
+	}
+	user, err := loadWebAuthnUser(ctx, u.store, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Verify the attestation
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(req.Credential)
+	if err != nil {
+		return nil, ErrInvalidWebAuthnResponse
+	}
+	credential, err := u.webauthn.CreateCredential(user, *session.data, parsed)
+	if err != nil {
+		return nil, ErrInvalidWebAuthnResponse
+	}
+
+	// 3. Store it
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = "Security key " + strconv.Itoa(len(user.credentials)+1)
+	}
+	created, err := u.store.CreateWebAuthnCredential(ctx, repository.CreateWebAuthnCredentialParams{
+		UserID:       userID,
+		CredentialID: credential.ID,
+		Name:         name,
+		Credential:   data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	u.events.Emit(ctx, SecurityEvent{
+		Type:    EventWebAuthnRegistered,
+		UserID:  userID,
+		Details: map[string]string{"credentialId": strconv.Itoa(int(created.ID)), "name": name},
+	})
+	return newWebAuthnCredentialResponse(created), nil
+}
+
+func (u *webAuthnUseCase) ListCredentials(ctx context.Context, userID int32) ([]WebAuthnCredentialResponse, error) {
+	rows, err := u.store.ListUserWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]WebAuthnCredentialResponse, 0, len(rows))
+	for _, row := range rows {
+		res = append(res, *newWebAuthnCredentialResponse(row))
+	}
+	return res, nil
+}
+
+func (u *webAuthnUseCase) DeleteCredential(ctx context.Context, userID, id int32) error {
+	user, err := u.store.GetUserById(ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	// Users of a role requiring MFA must keep at least one factor
+	if roleRequiresMFA(ctx, u.store, user) {
+		count, err := u.store.CountUserWebAuthnCredentials(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if _, enabled := confirmedTOTP(ctx, u.store, userID); !enabled && count <= 1 {
+			return ErrMFARequiredByRole
+		}
+	}
+
+	rows, err := u.store.DeleteWebAuthnCredential(ctx, repository.DeleteWebAuthnCredentialParams{ID: id, UserID: userID})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrWebAuthnCredentialMissing
+	}
+
+	u.events.Emit(ctx, SecurityEvent{
+		Type:    EventWebAuthnRemoved,
+		UserID:  userID,
+		Details: map[string]string{"credentialId": strconv.Itoa(int(id))},
+	})
+	return nil
+}
+
+func newWebAuthnCredentialResponse(c repository.WebauthnCredential) *WebAuthnCredentialResponse {
+	res := &WebAuthnCredentialResponse{
+		ID:        c.ID,
+		Name:      c.Name,
+		CreatedAt: c.CreatedAt.Time,
+	}
+	var credential webauthn.Credential
+	if json.Unmarshal(c.Credential, &credential) == nil {
+		res.Synced = credential.Flags.BackupEligible
+	}
+	if c.LastUsedAt.Valid {
+		res.LastUsedAt = &c.LastUsedAt.Time
+	}
+	return res
+}
+
+// webAuthnUser adapts a user and their credentials to webauthn.User. The user
+// handle is the decimal user ID, so passkey logins can find the user.
+type webAuthnUser struct {
+	user        repository.User
+	credentials []webauthn.Credential
+}
+
+func (w *webAuthnUser) WebAuthnID() []byte {
+	return []byte(strconv.Itoa(int(w.user.ID)))
+}
+
+func (w *webAuthnUser) WebAuthnName() string {
+	return w.user.Username
+}
+
+func (w *webAuthnUser) WebAuthnDisplayName() string {
+	if w.user.FullName != "" {
+		return w.user.FullName
+	}
+	return w.user.Username
+}
+
+func (w *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return w.credentials
+}
+
+func loadWebAuthnUser(ctx context.Context, q repository.Querier, userID int32) (*webAuthnUser, error) {
+	user, err := q.GetUserById(ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	rows, err := q.ListUserWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	res := &webAuthnUser{user: user}
+	for _, row := range rows {
+		var credential webauthn.Credential
+		if err := json.Unmarshal(row.Credential, &credential); err != nil {
+			return nil, err
+		}
+		res.credentials = append(res.credentials, credential)
+	}
+	return res, nil
+}
+
+// storeWebAuthnUsage saves the sign counter and flags after an assertion.
+func storeWebAuthnUsage(ctx context.Context, q repository.Querier, credential *webauthn.Credential) error {
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return err
+	}
+	return q.UpdateWebAuthnCredentialUsage(ctx, repository.UpdateWebAuthnCredentialUsageParams{
+		CredentialID: credential.ID,
+		Credential:   data,
+	})
+}
+
+type webAuthnSession struct {
+	userID pgtype.Int4
+	data   *webauthn.SessionData
+}
+
+// startWebAuthnSession stores the ceremony state and returns the options with
+// the token the client presents when finishing.
+func startWebAuthnSession(ctx context.Context, q repository.Querier, cfg *config.Config, ceremony string, userID int32, session *webauthn.SessionData, options any) (*WebAuthnCeremonyResponse, error) {
+	token, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := session.Expires
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().Add(cfg.WebAuthnTimeout)
+	}
+
+	if err := q.CreateWebAuthnSession(ctx, repository.CreateWebAuthnSessionParams{
+		TokenHash:   hashToken(token),
+		UserID:      pgtype.Int4{Int32: userID, Valid: userID != 0},
+		Ceremony:    ceremony,
+		SessionData: data,
+		ExpiresAt:   pgtype.Timestamptz{Time: expiresAt, Valid: true},
+	}); err != nil {
+		return nil, err
+	}
+	return &WebAuthnCeremonyResponse{SessionToken: token, Options: options}, nil
+}
+
+func takeWebAuthnSession(ctx context.Context, q repository.Querier, token, ceremony string) (*webAuthnSession, error) {
+	row, err := q.TakeWebAuthnSession(ctx, repository.TakeWebAuthnSessionParams{
+		TokenHash: hashToken(token),
+		Ceremony:  ceremony,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInvalidWebAuthnSession
+		}
+		return nil, err
+	}
+	if time.Now().After(row.ExpiresAt.Time) {
+		return nil, ErrInvalidWebAuthnSession
+	}
+
+	var data webauthn.SessionData
+	if err := json.Unmarshal(row.SessionData, &data); err != nil {
+		return nil, err
+	}
+	return &webAuthnSession{userID: row.UserID, data: &data}, nil
+}
@@ -0,0 +1,38 @@
+-- name: CreateEmailLoginToken :exec
+INSERT INTO email_login_tokens (
+    user_id, token_hash, code_hash, expires_at, ip_address
+) VALUES (
+    $1, $2, $3, $4, $5
+);
+
+-- name: GetEmailLoginTokenByHash :one
+SELECT * FROM email_login_tokens
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+LIMIT 1;
+
+-- name: GetLatestEmailLoginToken :one
+-- The code a user types belongs to the last login requested.
+SELECT * FROM email_login_tokens
+WHERE user_id = $1 AND used_at IS NULL AND expires_at > NOW()
+ORDER BY created_at DESC
+LIMIT 1;
+
+-- name: IncrementEmailLoginAttempts :one
+UPDATE email_login_tokens
+SET attempts = attempts + 1
+WHERE id = $1
+RETURNING attempts;
+
+-- name: UseEmailLoginToken :execrows
+UPDATE email_login_tokens
+SET used_at = NOW()
+WHERE id = $1 AND used_at IS NULL;
+
+-- name: InvalidateUserEmailLoginTokens :exec
+UPDATE email_login_tokens
+SET used_at = NOW()
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: DeleteExpiredEmailLoginTokens :execrows
+DELETE FROM email_login_tokens
+WHERE expires_at < NOW();
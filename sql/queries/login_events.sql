@@ -0,0 +1,29 @@
+-- name: CreateLoginEvent :exec
+INSERT INTO login_events (
+    user_id, username, method, outcome, failure_reason, ip_address, user_agent
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7
+);
+
+-- name: ListLoginEvents :many
+-- Every filter is optional: NULL matches all.
+SELECT * FROM login_events
+WHERE (sqlc.narg(user_id)::int IS NULL OR user_id = sqlc.narg(user_id))
+  AND (sqlc.narg(username)::text IS NULL OR username = sqlc.narg(username))
+  AND (sqlc.narg(method)::text IS NULL OR method = sqlc.narg(method))
+  AND (sqlc.narg(outcome)::text IS NULL OR outcome = sqlc.narg(outcome))
+  AND (sqlc.narg(ip_address)::text IS NULL OR ip_address = sqlc.narg(ip_address))
+  AND (sqlc.narg(since)::timestamptz IS NULL OR created_at >= sqlc.narg(since))
+  AND (sqlc.narg(until)::timestamptz IS NULL OR created_at < sqlc.narg(until))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(page_limit) OFFSET sqlc.arg(page_offset);
+
+-- name: CountLoginEvents :one
+SELECT COUNT(*) FROM login_events
+WHERE (sqlc.narg(user_id)::int IS NULL OR user_id = sqlc.narg(user_id))
+  AND (sqlc.narg(username)::text IS NULL OR username = sqlc.narg(username))
+  AND (sqlc.narg(method)::text IS NULL OR method = sqlc.narg(method))
+  AND (sqlc.narg(outcome)::text IS NULL OR outcome = sqlc.narg(outcome))
+  AND (sqlc.narg(ip_address)::text IS NULL OR ip_address = sqlc.narg(ip_address))
+  AND (sqlc.narg(since)::timestamptz IS NULL OR created_at >= sqlc.narg(since))
+  AND (sqlc.narg(until)::timestamptz IS NULL OR created_at < sqlc.narg(until));
@@ -0,0 +1,78 @@
+-- name: UpsertPendingUserTOTP :one
+-- Starts (or restarts) an enrolment. Returns no row when a confirmed factor exists.
+INSERT INTO user_totp (
+    user_id, secret
+) VALUES (
+    $1, $2
+)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, last_used_step = NULL, created_at = NOW()
+WHERE user_totp.confirmed_at IS NULL
+RETURNING *;
+
+-- name: GetUserTOTP :one
+SELECT * FROM user_totp
+WHERE user_id = $1 LIMIT 1;
+
+-- name: ConfirmUserTOTP :execrows
+UPDATE user_totp
+SET confirmed_at = NOW(), last_used_step = $2
+WHERE user_id = $1 AND confirmed_at IS NULL;
+
+-- name: UseUserTOTPStep :execrows
+UPDATE user_totp
+SET last_used_step = $2
+WHERE user_id = $1 AND (last_used_step IS NULL OR last_used_step < $2);
+
+-- name: DeleteUserTOTP :exec
+DELETE FROM user_totp WHERE user_id = $1;
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO mfa_recovery_codes (
+    user_id, code_hash
+) VALUES (
+    $1, $2
+);
+
+-- name: UseRecoveryCode :execrows
+UPDATE mfa_recovery_codes
+SET used_at = NOW()
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+
+-- name: CountUnusedRecoveryCodes :one
+SELECT COUNT(*) FROM mfa_recovery_codes
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: DeleteUserRecoveryCodes :exec
+DELETE FROM mfa_recovery_codes WHERE user_id = $1;
+
+-- name: CreateMFAChallenge :one
+INSERT INTO mfa_challenges (
+    user_id, token_hash, expires_at, ip_address
+) VALUES (
+    $1, $2, $3, $4
+)
+RETURNING *;
+
+-- name: GetMFAChallenge :one
+SELECT * FROM mfa_challenges
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+LIMIT 1;
+
+-- name: IncrementMFAChallengeAttempts :one
+UPDATE mfa_challenges
+SET attempts = attempts + 1
+WHERE id = $1
+RETURNING attempts;
+
+-- name: UseMFAChallenge :execrows
+UPDATE mfa_challenges
+SET used_at = NOW()
+WHERE id = $1 AND used_at IS NULL;
+
+-- name: DeleteUserMFAChallenges :exec
+DELETE FROM mfa_challenges WHERE user_id = $1;
+
+-- name: DeleteExpiredMFAChallenges :execrows
+DELETE FROM mfa_challenges
+WHERE expires_at < NOW();
@@ -0,0 +1,16 @@
+-- name: CreateOIDCLoginState :exec
+INSERT INTO oidc_login_states (
+    state_hash, provider, nonce, code_verifier, return_to, expires_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6
+);
+
+-- name: TakeOIDCLoginState :one
+-- A state answers one callback only.
+DELETE FROM oidc_login_states
+WHERE state_hash = $1 AND provider = $2
+RETURNING *;
+
+-- name: DeleteExpiredOIDCLoginStates :execrows
+DELETE FROM oidc_login_states
+WHERE expires_at < NOW();
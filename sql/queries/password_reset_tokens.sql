@@ -0,0 +1,26 @@
+-- name: CreatePasswordResetToken :one
+INSERT INTO password_reset_tokens (
+    user_id, token_hash, expires_at, ip_address
+) VALUES (
+    $1, $2, $3, $4
+)
+RETURNING *;
+
+-- name: GetPasswordResetToken :one
+SELECT * FROM password_reset_tokens
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+LIMIT 1;
+
+-- name: UsePasswordResetToken :execrows
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE id = $1 AND used_at IS NULL;
+
+-- name: InvalidateUserPasswordResetTokens :exec
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: DeleteExpiredPasswordResetTokens :execrows
+DELETE FROM password_reset_tokens
+WHERE expires_at < NOW();
@@ -1,20 +1,47 @@
 -- name: CreateRefreshToken :one
 INSERT INTO refresh_tokens (
-    user_id, token, expires_at
+    user_id, token_hash, expires_at, family_id, user_agent, ip_address, client_name, session_started_at
 ) VALUES (
-    $1, $2, $3
+    $1, $2, $3, $4, $5, $6, $7, $8
 )
 RETURNING *;
 
 -- name: GetRefreshToken :one
 SELECT * FROM refresh_tokens
-WHERE token = $1 AND revoked_at IS NULL AND expires_at > NOW()
+WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > NOW()
 LIMIT 1;
 
+-- name: FindRefreshToken :one
+-- Unlike GetRefreshToken this also returns revoked tokens, for reuse detection.
+SELECT * FROM refresh_tokens
+WHERE token_hash = $1
+LIMIT 1;
+
+-- name: ListUserSessions :many
+-- The live token of each family is the session.
+SELECT * FROM refresh_tokens
+WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+ORDER BY created_at DESC;
+
+-- name: RotateRefreshToken :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), replaced_by = $2
+WHERE id = $1 AND revoked_at IS NULL;
+
 -- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
 SET revoked_at = NOW()
-WHERE token = $1;
+WHERE token_hash = $1;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeUserSession :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW()
+WHERE user_id = $1 AND family_id = $2 AND revoked_at IS NULL;
 
 -- name: RevokeUserRefreshTokens :exec
 UPDATE refresh_tokens
@@ -8,13 +8,14 @@ SELECT * FROM roles WHERE code = $1 LIMIT 1;
 SELECT * FROM roles ORDER BY level ASC;
 
 -- name: CreateRole :one
-INSERT INTO roles (code, name, description, level, is_system, status)
-VALUES ($1, $2, $3, $4, $5, $6)
+INSERT INTO roles (code, name, description, level, is_system, status, access_token_ttl_seconds, refresh_token_ttl_seconds, require_mfa)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 RETURNING *;
 
 -- name: UpdateRole :one
 UPDATE roles
-SET name = $2, description = $3, level = $4, status = $5, updated_at = NOW()
+SET name = $2, description = $3, level = $4, status = $5,
+    access_token_ttl_seconds = $6, refresh_token_ttl_seconds = $7, require_mfa = $8, updated_at = NOW()
 WHERE id = $1
 RETURNING *;
 
@@ -0,0 +1,16 @@
+-- name: CreateSAMLRequest :exec
+INSERT INTO saml_requests (
+    relay_state_hash, provider, request_id, return_to, expires_at, link_user_id
+) VALUES (
+    $1, $2, $3, $4, $5, $6
+);
+
+-- name: TakeSAMLRequest :one
+-- A request is answered once, a replayed response finds nothing.
+DELETE FROM saml_requests
+WHERE relay_state_hash = $1 AND provider = $2
+RETURNING *;
+
+-- name: DeleteExpiredSAMLRequests :execrows
+DELETE FROM saml_requests
+WHERE expires_at < NOW();
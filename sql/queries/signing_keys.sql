@@ -0,0 +1,39 @@
+-- name: CreateSigningKey :one
+INSERT INTO signing_keys (
+    kid, algorithm, private_key, state, activated_at
+) VALUES (
+    $1, $2, $3, $4, $5
+)
+RETURNING *;
+
+-- name: ListSigningKeys :many
+SELECT * FROM signing_keys
+ORDER BY created_at DESC, id DESC;
+
+-- name: ListPublishedSigningKeys :many
+SELECT * FROM signing_keys
+WHERE state <> 'RETIRED'
+ORDER BY created_at DESC, id DESC;
+
+-- name: LockSigningKeys :exec
+SELECT pg_advisory_xact_lock(hashtext('signing_keys'));
+
+-- name: ActivateSigningKey :exec
+UPDATE signing_keys
+SET state = 'ACTIVE', activated_at = NOW()
+WHERE id = $1;
+
+-- name: RetireActiveSigningKeys :exec
+UPDATE signing_keys
+SET state = 'RETIRING', retire_at = $1
+WHERE state = 'ACTIVE';
+
+-- name: RetireExpiredSigningKeys :execrows
+UPDATE signing_keys
+SET state = 'RETIRED', retired_at = NOW()
+WHERE state = 'RETIRING' AND retire_at <= NOW();
+
+-- name: UpdateSigningKeyPrivateKey :exec
+UPDATE signing_keys
+SET private_key = $2
+WHERE id = $1;
@@ -0,0 +1,28 @@
+-- name: CreateUserIdentity :one
+INSERT INTO user_identities (
+    user_id, provider, subject, email, last_login_at
+) VALUES (
+    $1, $2, $3, $4, $5
+)
+RETURNING *;
+
+-- name: GetUserIdentity :one
+SELECT * FROM user_identities
+WHERE provider = $1 AND subject = $2 LIMIT 1;
+
+-- name: ListUserIdentities :many
+SELECT * FROM user_identities
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: CountUserIdentities :one
+SELECT COUNT(*) FROM user_identities WHERE user_id = $1;
+
+-- name: UpdateUserIdentityLogin :exec
+UPDATE user_identities
+SET email = $2, last_login_at = NOW()
+WHERE id = $1;
+
+-- name: DeleteUserIdentity :execrows
+DELETE FROM user_identities
+WHERE id = $1 AND user_id = $2;
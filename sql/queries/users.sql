@@ -1,8 +1,8 @@
 -- name: CreateUser :one
 INSERT INTO users (
-  username, password_hash, full_name, email, phone, avatar, role_id, status
+  username, password_hash, full_name, email, phone, avatar, role_id, status, must_change_password, password_changed_at
 ) VALUES (
-  $1, $2, $3, $4, $5, $6, $7, $8
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, $10
 )
 RETURNING *;
 
@@ -48,3 +48,39 @@ WHERE email = $1 AND deleted_at IS NULL LIMIT 1;
 UPDATE users
 SET external_login = $2
 WHERE id = $1;
+
+-- name: RegisterFailedLogin :one
+UPDATE users
+SET failed_login_attempts = failed_login_attempts + 1
+WHERE id = $1
+RETURNING failed_login_attempts, lockout_count;
+
+-- name: LockUser :exec
+UPDATE users
+SET locked_until = $2, lockout_count = lockout_count + 1, failed_login_attempts = 0
+WHERE id = $1;
+
+-- name: ResetFailedLogins :exec
+UPDATE users
+SET failed_login_attempts = 0, lockout_count = 0, locked_until = NULL
+WHERE id = $1;
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET password_hash = $2, must_change_password = $3, password_changed_at = NOW(), updated_at = NOW()
+WHERE id = $1;
+
+-- name: RehashUserPassword :execrows
+UPDATE users
+SET password_hash = @new_hash
+WHERE id = @id AND password_hash = @old_hash;
+
+-- name: UpdateUserAuthSource :exec
+UPDATE users
+SET auth_source = $2
+WHERE id = $1;
+
+-- name: UpdateUserRole :exec
+UPDATE users
+SET role_id = $2, updated_at = NOW()
+WHERE id = $1;
@@ -0,0 +1,46 @@
+-- name: CreateWebAuthnCredential :one
+INSERT INTO webauthn_credentials (
+    user_id, credential_id, name, credential
+) VALUES (
+    $1, $2, $3, $4
+)
+RETURNING *;
+
+-- name: ListUserWebAuthnCredentials :many
+SELECT * FROM webauthn_credentials
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: CountUserWebAuthnCredentials :one
+SELECT COUNT(*) FROM webauthn_credentials
+WHERE user_id = $1;
+
+-- name: UpdateWebAuthnCredentialUsage :exec
+-- Stores the sign counter and flags of the last assertion.
+UPDATE webauthn_credentials
+SET credential = $2, last_used_at = NOW()
+WHERE credential_id = $1;
+
+-- name: DeleteWebAuthnCredential :execrows
+DELETE FROM webauthn_credentials
+WHERE id = $1 AND user_id = $2;
+
+-- name: DeleteUserWebAuthnCredentials :exec
+DELETE FROM webauthn_credentials WHERE user_id = $1;
+
+-- name: CreateWebAuthnSession :exec
+INSERT INTO webauthn_sessions (
+    token_hash, user_id, ceremony, session_data, expires_at
+) VALUES (
+    $1, $2, $3, $4, $5
+);
+
+-- name: TakeWebAuthnSession :one
+-- Sessions are single use: finishing a ceremony deletes its state.
+DELETE FROM webauthn_sessions
+WHERE token_hash = $1 AND ceremony = $2
+RETURNING *;
+
+-- name: DeleteExpiredWebAuthnSessions :execrows
+DELETE FROM webauthn_sessions
+WHERE expires_at < NOW();
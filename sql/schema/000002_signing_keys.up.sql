@@ -0,0 +1,17 @@
+-- ==================== SIGNING KEYS ====================
+-- Key lifecycle: NEXT (published, not yet signing) -> ACTIVE (signing) ->
+-- RETIRING (published until tokens it signed have expired) -> RETIRED.
+
+CREATE TABLE signing_keys (
+    id SERIAL PRIMARY KEY,
+    kid VARCHAR(100) UNIQUE NOT NULL,
+    algorithm VARCHAR(20) NOT NULL,
+    private_key TEXT NOT NULL, -- PKCS#8 PEM
+    state VARCHAR(20) NOT NULL DEFAULT 'NEXT',
+    activated_at TIMESTAMP WITH TIME ZONE,
+    retire_at TIMESTAMP WITH TIME ZONE,
+    retired_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_signing_keys_state ON signing_keys(state);
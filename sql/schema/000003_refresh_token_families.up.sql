@@ -0,0 +1,12 @@
+-- Refresh tokens issued by the same login share a family. Rotation links each
+-- token to its successor so presenting an already-rotated token can be
+-- detected and the whole family revoked.
+
+ALTER TABLE refresh_tokens ADD COLUMN family_id UUID;
+ALTER TABLE refresh_tokens ADD COLUMN replaced_by INTEGER REFERENCES refresh_tokens(id) ON DELETE SET NULL;
+
+-- Existing tokens each become their own family
+UPDATE refresh_tokens SET family_id = gen_random_uuid() WHERE family_id IS NULL;
+ALTER TABLE refresh_tokens ALTER COLUMN family_id SET NOT NULL;
+
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
@@ -0,0 +1,9 @@
+-- Plaintext tokens cannot be recovered: every session is invalidated on rollback.
+ALTER TABLE refresh_tokens ADD COLUMN token TEXT;
+UPDATE refresh_tokens SET token = token_hash, revoked_at = COALESCE(revoked_at, NOW());
+ALTER TABLE refresh_tokens ALTER COLUMN token SET NOT NULL;
+ALTER TABLE refresh_tokens ADD CONSTRAINT refresh_tokens_token_key UNIQUE (token);
+CREATE INDEX idx_refresh_tokens_token ON refresh_tokens(token);
+
+DROP INDEX IF EXISTS idx_refresh_tokens_token_hash;
+ALTER TABLE refresh_tokens DROP COLUMN token_hash;
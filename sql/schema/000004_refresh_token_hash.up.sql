@@ -0,0 +1,11 @@
+-- Refresh tokens are stored as a hex SHA-256 only. Existing rows are hashed in
+-- place, so sessions issued before this migration keep working until they
+-- expire: clients still present the plaintext, which hashes to the new value.
+
+ALTER TABLE refresh_tokens ADD COLUMN token_hash VARCHAR(64);
+UPDATE refresh_tokens SET token_hash = encode(sha256(convert_to(token, 'UTF8')), 'hex');
+ALTER TABLE refresh_tokens ALTER COLUMN token_hash SET NOT NULL;
+
+CREATE UNIQUE INDEX idx_refresh_tokens_token_hash ON refresh_tokens(token_hash);
+DROP INDEX IF EXISTS idx_refresh_tokens_token;
+ALTER TABLE refresh_tokens DROP COLUMN token;
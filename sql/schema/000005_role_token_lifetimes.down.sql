@@ -0,0 +1,2 @@
+ALTER TABLE roles DROP COLUMN IF EXISTS refresh_token_ttl_seconds;
+ALTER TABLE roles DROP COLUMN IF EXISTS access_token_ttl_seconds;
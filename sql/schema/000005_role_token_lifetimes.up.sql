@@ -0,0 +1,4 @@
+-- Optional per-role overrides of JWT_EXPIRES_IN / REFRESH_TOKEN_EXPIRY, in seconds.
+-- NULL means the global configuration applies.
+ALTER TABLE roles ADD COLUMN access_token_ttl_seconds INTEGER CHECK (access_token_ttl_seconds > 0);
+ALTER TABLE roles ADD COLUMN refresh_token_ttl_seconds INTEGER CHECK (refresh_token_ttl_seconds > 0);
@@ -0,0 +1,10 @@
+-- Access tokens revoked before their natural expiry (logout), keyed by jti.
+-- Rows are useless once expires_at has passed and are purged.
+CREATE TABLE revoked_access_tokens (
+    jti VARCHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_revoked_access_tokens_expires_at ON revoked_access_tokens(expires_at);
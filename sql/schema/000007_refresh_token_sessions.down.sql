@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_refresh_tokens_user_id;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS session_started_at;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS client_name;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS ip_address;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS user_agent;
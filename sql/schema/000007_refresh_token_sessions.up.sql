@@ -0,0 +1,12 @@
+-- Device metadata for session management. A session is a refresh token
+-- family; session_started_at is carried over on rotation while created_at of
+-- the live token tells when the session was last refreshed.
+ALTER TABLE refresh_tokens ADD COLUMN user_agent TEXT;
+ALTER TABLE refresh_tokens ADD COLUMN ip_address VARCHAR(50);
+ALTER TABLE refresh_tokens ADD COLUMN client_name VARCHAR(100);
+ALTER TABLE refresh_tokens ADD COLUMN session_started_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE refresh_tokens SET session_started_at = created_at WHERE session_started_at IS NULL;
+ALTER TABLE refresh_tokens ALTER COLUMN session_started_at SET DEFAULT NOW();
+
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens(user_id);
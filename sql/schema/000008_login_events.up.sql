@@ -0,0 +1,16 @@
+-- ==================== LOGIN HISTORY ====================
+-- One row per authentication attempt, successful or not. user_id is NULL when
+-- the attempted username could not be resolved to a user.
+
+CREATE TABLE login_events (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    username VARCHAR(255),
+    method VARCHAR(20) NOT NULL, -- PASSWORD, GOOGLE
+    outcome VARCHAR(20) NOT NULL, -- SUCCESS, FAILURE
+    ip_address VARCHAR(50),
+    user_agent TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_login_events_user_id ON login_events(user_id, created_at DESC);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_login_events_username;
+DROP INDEX IF EXISTS idx_login_events_created_at;
+ALTER TABLE login_events DROP COLUMN IF EXISTS failure_reason;
@@ -0,0 +1,6 @@
+-- Audit trail details: why an attempt failed, and indexes for the security
+-- team's queries over all events.
+ALTER TABLE login_events ADD COLUMN failure_reason VARCHAR(50);
+
+CREATE INDEX idx_login_events_created_at ON login_events(created_at DESC);
+CREATE INDEX idx_login_events_username ON login_events(username, created_at DESC);
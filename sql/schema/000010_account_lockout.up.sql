@@ -0,0 +1,5 @@
+-- Failed password attempts since the last success or lockout, the current
+-- lockout and how many consecutive lockouts happened (drives the backoff).
+ALTER TABLE users ADD COLUMN failed_login_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN locked_until TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN lockout_count INTEGER NOT NULL DEFAULT 0;
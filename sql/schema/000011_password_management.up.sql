@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN must_change_password BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN password_changed_at TIMESTAMP WITH TIME ZONE;
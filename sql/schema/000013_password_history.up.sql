@@ -0,0 +1,10 @@
+-- Hashes of the passwords a user has had, newest first by id, so reuse of
+-- recent passwords can be refused. Only the configured number is kept.
+CREATE TABLE password_history (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    password_hash VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_password_history_user_id ON password_history(user_id, id DESC);
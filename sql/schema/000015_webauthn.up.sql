@@ -0,0 +1,29 @@
+-- WebAuthn credentials (security keys and passkeys). The go-webauthn
+-- credential record is kept as JSON; credential_id is the raw credential ID
+-- the authenticator presents.
+CREATE TABLE webauthn_credentials (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    credential_id BYTEA UNIQUE NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    credential JSONB NOT NULL,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_webauthn_credentials_user_id ON webauthn_credentials(user_id);
+
+-- Server side state of a registration or assertion ceremony between its
+-- begin and finish requests. user_id is NULL for passkey logins, where the
+-- user is only known once the authenticator answered.
+CREATE TABLE webauthn_sessions (
+    id SERIAL PRIMARY KEY,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    ceremony VARCHAR(20) NOT NULL, -- REGISTRATION, LOGIN, MFA
+    session_data JSONB NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_webauthn_sessions_expires_at ON webauthn_sessions(expires_at);
@@ -0,0 +1,16 @@
+-- Passwordless email login. Each request mails a numeric code and a link
+-- token; either one logs in once. Only SHA-256 hashes are stored.
+CREATE TABLE email_login_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    code_hash VARCHAR(64) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    ip_address VARCHAR(50),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_email_login_tokens_user_id ON email_login_tokens(user_id);
+CREATE INDEX idx_email_login_tokens_expires_at ON email_login_tokens(expires_at);
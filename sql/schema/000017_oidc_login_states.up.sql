@@ -0,0 +1,15 @@
+-- State of a redirect login at an upstream OIDC provider between
+-- /auth/oidc/{provider}/authorize and its callback. The state parameter is
+-- only stored hashed; nonce and PKCE verifier are needed in clear.
+CREATE TABLE oidc_login_states (
+    id SERIAL PRIMARY KEY,
+    state_hash VARCHAR(64) UNIQUE NOT NULL,
+    provider VARCHAR(20) NOT NULL,
+    nonce VARCHAR(64) NOT NULL,
+    code_verifier VARCHAR(128) NOT NULL,
+    return_to TEXT NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_oidc_login_states_expires_at ON oidc_login_states(expires_at);
@@ -0,0 +1,15 @@
+-- Logins at upstream identity providers linked to a user. Returning users
+-- are matched by the provider's subject, which unlike the email never
+-- changes; email keeps the address the provider reported last.
+CREATE TABLE user_identities (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255),
+    last_login_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE(provider, subject)
+);
+
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
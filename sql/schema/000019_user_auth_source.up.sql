@@ -0,0 +1,2 @@
+-- Where the password of a user is checked: LOCAL (password_hash) or LDAP
+ALTER TABLE users ADD COLUMN auth_source VARCHAR(20) NOT NULL DEFAULT 'LOCAL';
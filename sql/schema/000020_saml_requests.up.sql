@@ -0,0 +1,13 @@
+-- AuthnRequests sent to SAML identity providers, until answered at the ACS.
+-- The relay state is only stored hashed; responses must answer request_id.
+CREATE TABLE saml_requests (
+    id SERIAL PRIMARY KEY,
+    relay_state_hash VARCHAR(64) UNIQUE NOT NULL,
+    provider VARCHAR(20) NOT NULL,
+    request_id VARCHAR(100) NOT NULL,
+    return_to TEXT NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_saml_requests_expires_at ON saml_requests(expires_at);
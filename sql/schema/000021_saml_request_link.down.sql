@@ -0,0 +1 @@
+ALTER TABLE saml_requests DROP COLUMN IF EXISTS link_user_id;
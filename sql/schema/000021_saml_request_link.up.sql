@@ -0,0 +1,3 @@
+-- Set when the request was started under /me to link the responding
+-- identity to that user instead of logging in.
+ALTER TABLE saml_requests ADD COLUMN link_user_id INTEGER REFERENCES users(id) ON DELETE CASCADE;